@@ -0,0 +1,184 @@
+// candecode 使用与流水线相同的解码器解码 CAN 日志，把信号物理值导出为 CSV、JSON Lines 或 Parquet，
+// 便于分析人员查看规则判断时看到的数据。
+//
+// 用法:
+//
+//	candecode -dbc vehicle.dbc [-dbc 2:chassis.dbc] [-signal 'Wheel*'] [-signal 're:^Accel'] \
+//	    [-format csv|jsonl|parquet] [-layout wide|long] [-resample 10ms [-interp linear -max-staleness 50ms]] [-o out.parquet] trace.asc
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"AutoDataHub-monitor/pkg/utils"
+)
+
+// multiFlag 可重复指定的字符串参数
+type multiFlag []string
+
+func (m *multiFlag) String() string { return strings.Join(*m, ",") }
+
+func (m *multiFlag) Set(v string) error {
+	*m = append(*m, v)
+	return nil
+}
+
+// options 命令行参数
+type options struct {
+	logPath  string
+	dbcs     []string
+	patterns []string
+	format   utils.CANExportFormat
+	layout   utils.CANExportLayout
+	resample utils.CANResamplePolicy // 周期为0表示不重采样
+	output   string
+	policy   utils.CANParsePolicy
+}
+
+func main() {
+	var dbcs, patterns multiFlag
+	flag.Var(&dbcs, "dbc", "DBC 文件，可重复指定；channel:path 形式只用于指定通道")
+	flag.Var(&patterns, "signal", "信号过滤，glob 通配符或 re: 开头的正则表达式，可重复指定，默认导出全部信号")
+	format := flag.String("format", "", "输出格式 csv、jsonl 或 parquet，默认按输出文件扩展名判断")
+	layout := flag.String("layout", string(utils.CANExportWide), "输出布局: wide 每个时间点一行，long 每个信号值一行")
+	resample := flag.Duration("resample", 0, "按固定周期重采样，把不同报文的信号对齐到同一时间网格，如 10ms，默认不重采样")
+	interp := flag.String("interp", string(utils.CANResampleHold), "重采样取值方式: hold 保持上一个值，linear 线性插值")
+	staleness := flag.Duration("max-staleness", 0, "信号超过该时长未更新时不再输出，linear 插值时必须指定")
+	output := flag.String("o", "", "输出文件，默认写到标准输出")
+	policy := flag.String("policy", string(utils.CANParseStrict), "异常帧处理方式: strict 或 skip")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "用法: %s -dbc <DBC文件> [选项] <CAN日志>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 || len(dbcs) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	opts := options{
+		logPath:  flag.Arg(0),
+		dbcs:     dbcs,
+		patterns: patterns,
+		format:   utils.CANExportFormat(*format),
+		layout:   utils.CANExportLayout(*layout),
+		resample: utils.CANResamplePolicy{Period: *resample, Method: utils.CANResampleMethod(*interp), MaxStaleness: *staleness},
+		output:   *output,
+		policy:   utils.CANParsePolicy{Mode: utils.CANParseMode(*policy)},
+	}
+	if opts.format == "" {
+		opts.format = utils.CANExportFormatFromPath(opts.output)
+	}
+	if err := opts.resample.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "candecode: %v\n", err)
+		os.Exit(2)
+	}
+
+	report, err := run(opts)
+	if report != nil {
+		summary, _ := json.Marshal(report)
+		fmt.Fprintf(os.Stderr, "解析报告: %s\n", summary)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "candecode: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run 解码日志并写出结果
+func run(opts options) (*utils.CANParseReport, error) {
+	bindings, signals, err := loadDBCs(opts.dbcs, opts.patterns)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := utils.NewCANDecoder(bindings, signals, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	out := io.Writer(os.Stdout)
+	if opts.output != "" {
+		file, err := os.Create(opts.output)
+		if err != nil {
+			return nil, fmt.Errorf("创建输出文件失败: %w", err)
+		}
+		defer file.Close()
+		out = file
+	} else if opts.format == utils.CANExportParquet {
+		return nil, errors.New("parquet 格式需要用 -o 指定输出文件")
+	}
+	writer, err := utils.NewCANSampleWriter(out, opts.format, opts.layout, signals)
+	if err != nil {
+		return nil, err
+	}
+
+	write := writer.WriteSample
+	var resampler *utils.CANResampler
+	if opts.resample.Enabled() {
+		if resampler, err = utils.NewCANResamplerWithPolicy(opts.resample); err != nil {
+			return nil, err
+		}
+		write = func(sample *utils.CANSample) error {
+			return resampler.Push(sample, writer.WriteSample)
+		}
+	}
+
+	var writeErr error
+	report, err := utils.StreamCANLogWithPolicy(opts.logPath, decoder, opts.policy, func(sample *utils.CANSample) bool {
+		writeErr = write(sample)
+		return writeErr == nil
+	})
+	if err == nil {
+		err = writeErr
+	}
+	if err == nil && resampler != nil {
+		err = resampler.Flush(writer.WriteSample)
+	}
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	return report, err
+}
+
+// loadDBCs 加载 DBC 文件并按过滤规则选出要导出的信号
+func loadDBCs(specs, patterns []string) ([]utils.DBCBinding, []string, error) {
+	registry := utils.NewDBCRegistry()
+	var bindings []utils.DBCBinding
+	var names []string
+	seen := make(map[string]struct{})
+	for _, spec := range specs {
+		channel, path := 0, spec
+		if ch, rest, ok := strings.Cut(spec, ":"); ok {
+			if n, err := strconv.Atoi(ch); err == nil {
+				channel, path = n, rest
+			}
+		}
+		db, err := registry.Get(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		bindings = append(bindings, utils.DBCBinding{Channel: channel, DBC: db})
+		for _, name := range db.SignalNames() {
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				names = append(names, name)
+			}
+		}
+	}
+
+	signals, err := utils.MatchSignalNames(names, patterns)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(signals) == 0 {
+		return nil, nil, errors.New("没有匹配过滤规则的信号")
+	}
+	return bindings, signals, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"AutoDataHub-monitor/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDBC = `VERSION ""
+
+BO_ 291 Accel: 8 ACU
+ SG_ LongitudinalAcceleration : 0|8@1+ (0.1,0) [0|25.5] "g" Vector__XXX
+ SG_ LateralAcceleration : 8|8@1+ (0.1,0) [0|25.5] "g" Vector__XXX
+
+BO_ 2566844672 Truck: 8 ECU
+ SG_ EngineSpeed : 0|8@1+ (1,0) [0|255] "rpm" Vector__XXX
+`
+
+const testLog = `(1620000000.000000) can0 123#0102
+(1620000000.010000) can0 18FEF100#64
+(1620000000.020000) can0 123#0304
+`
+
+// writeTestFile 在临时目录中写入测试文件并返回路径
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+// newOptions 返回导出 CSV 宽表到临时文件的参数
+func newOptions(t *testing.T) options {
+	t.Helper()
+	dir := t.TempDir()
+	return options{
+		logPath: writeTestFile(t, dir, "trace.log", testLog),
+		dbcs:    []string{writeTestFile(t, dir, "vehicle.dbc", testDBC)},
+		format:  utils.CANExportCSV,
+		layout:  utils.CANExportWide,
+		output:  filepath.Join(dir, "out.csv"),
+	}
+}
+
+func TestRunCSV(t *testing.T) {
+	opts := newOptions(t)
+	opts.patterns = []string{"*Acceleration"}
+	report, err := run(opts)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.FramesRead)
+
+	out, err := os.ReadFile(opts.output)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	require.Len(t, lines, 3)
+	// 只导出匹配过滤规则的信号，不含 EngineSpeed 的帧不产生样本
+	assert.Equal(t, "timestamp,LongitudinalAcceleration,LateralAcceleration", lines[0])
+	assert.Equal(t, "1620000000000,0.1,0.2", lines[1])
+	assert.Equal(t, "1620000000020,0.30000000000000004,0.4", lines[2])
+}
+
+func TestRunResample(t *testing.T) {
+	opts := newOptions(t)
+	opts.patterns = []string{"LongitudinalAcceleration", "EngineSpeed"}
+	opts.resample = utils.CANResamplePolicy{Period: 10 * time.Millisecond, Method: utils.CANResampleHold}
+	_, err := run(opts)
+	require.NoError(t, err)
+
+	out, err := os.ReadFile(opts.output)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	// 重采样后每个周期一行，各报文的信号对齐到同一时间点
+	assert.Equal(t, []string{
+		"timestamp,LongitudinalAcceleration,EngineSpeed",
+		"1620000000000,0.1,",
+		"1620000000010,0.1,100",
+		"1620000000020,0.30000000000000004,100",
+	}, lines)
+}
+
+func TestRunErrors(t *testing.T) {
+	opts := newOptions(t)
+	opts.patterns = []string{"Wheel*"}
+	_, err := run(opts)
+	assert.ErrorContains(t, err, "没有匹配过滤规则的信号")
+
+	opts = newOptions(t)
+	opts.format, opts.output = utils.CANExportParquet, ""
+	_, err = run(opts)
+	assert.ErrorContains(t, err, "-o")
+
+	// strict 策略下格式错误的行中止解析，并返回已读取部分的报告
+	opts = newOptions(t)
+	opts.logPath = writeTestFile(t, t.TempDir(), "bad.log", testLog+"(1620000000.030000) can0 123#XYZ\n")
+	report, err := run(opts)
+	assert.Error(t, err)
+	require.NotNil(t, report)
+	assert.Equal(t, 1, report.MalformedLines)
+
+	opts.policy = utils.CANParsePolicy{Mode: utils.CANParseSkip}
+	_, err = run(opts)
+	assert.NoError(t, err)
+}
+
+func TestLoadDBCs(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestFile(t, dir, "vehicle.dbc", testDBC)
+	bindings, signals, err := loadDBCs([]string{"2:" + path}, []string{"re:^Engine"})
+	require.NoError(t, err)
+	require.Len(t, bindings, 1)
+	assert.Equal(t, 2, bindings[0].Channel)
+	assert.Equal(t, []string{"EngineSpeed"}, signals)
+
+	// 同一 DBC 绑定到多个通道时信号名不重复
+	_, signals, err = loadDBCs([]string{path, "1:" + path}, nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"LongitudinalAcceleration", "LateralAcceleration", "EngineSpeed"}, signals)
+
+	_, _, err = loadDBCs([]string{filepath.Join(dir, "missing.dbc")}, nil)
+	assert.Error(t, err)
+}
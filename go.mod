@@ -6,6 +6,7 @@ toolchain go1.23.1
 
 require (
 	github.com/go-redis/redis/v8 v8.11.5
+	github.com/klauspost/compress v1.18.0
 	github.com/prometheus/client_golang v1.22.0
 	github.com/redis/go-redis/v9 v9.9.0
 	github.com/stretchr/testify v1.10.0
@@ -6,9 +6,19 @@ import (
 
 	"AutoDataHub-monitor/configs"
 	"AutoDataHub-monitor/pkg/models"
+
+	"go.uber.org/zap"
 )
 
-var logger = configs.Client.Logger
+var logger = packageLogger()
+
+// packageLogger 返回已初始化的日志实例，configs.Client 未创建时（如单元测试）不输出日志
+func packageLogger() *zap.Logger {
+	if configs.Client == nil || configs.Client.Logger == nil {
+		return zap.NewNop()
+	}
+	return configs.Client.Logger
+}
 
 func ProcessCanQueueData(queueName string) {
 	defer func() {
@@ -24,18 +34,28 @@ func ProcessCanQueueData(queueName string) {
 	}
 	// "./configs/can_sig.yaml"
 	processor := NewTriggeFileFromClient(fmt.Sprintf("./configs/can_sig_%s.yaml", queueName))
-	isCrash, crashInfo, err := processor.IsCrash(data.Vin, data.Timestamp)
+	isCrash, crashInfo, err := processor.IsCrash(data)
 	if err != nil {
 		logger.Error(err.Error())
 		return
 	}
 	data.ThresholdLog = data.ThresholdLog + ";" + crashInfo
-	if isCrash != 0 {
-		// 推入数据库队列
-		data.PushToRedisQueue(configs.Cfg.VehicleType.WriteDbQueue)
-	} else {
-		// 推入感知队列
-		data.PushToRedisQueue(configs.Cfg.VehicleType.FusionCarQueue)
+	data.IsCrash = isCrash
+	for _, queue := range resultQueues(isCrash) {
+		data.PushToRedisQueue(queue)
 	}
 	return
 }
+
+// resultQueues 按判定结论返回需要推入的队列：判定碰撞推入数据库队列，未碰撞推入感知队列继续判断，
+// 传感器故障、总线异常等无法判定的结论既入库记录，也推入感知队列由感知数据继续判断
+func resultQueues(isCrash int) []string {
+	switch {
+	case isCrash > 0:
+		return []string{configs.Cfg.VehicleType.WriteDbQueue}
+	case isCrash < 0:
+		return []string{configs.Cfg.VehicleType.WriteDbQueue, configs.Cfg.VehicleType.FusionCarQueue}
+	default:
+		return []string{configs.Cfg.VehicleType.FusionCarQueue}
+	}
+}
@@ -0,0 +1,24 @@
+package can_sig
+
+import (
+	"testing"
+
+	"AutoDataHub-monitor/configs"
+	"AutoDataHub-monitor/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultQueues(t *testing.T) {
+	old := configs.Cfg
+	t.Cleanup(func() { configs.Cfg = old })
+	configs.Cfg = &configs.Config{VehicleType: configs.VehicleTypeConfig{WriteDbQueue: "write_db", FusionCarQueue: "fusion_car"}}
+
+	// 判定碰撞只入库，未碰撞交给感知数据继续判断，无法判定的结论两者都要
+	assert.Equal(t, []string{"write_db"}, resultQueues(1))
+	assert.Equal(t, []string{"write_db"}, resultQueues(7))
+	assert.Equal(t, []string{"fusion_car"}, resultQueues(0))
+	for _, code := range []int{models.CrashSensorFault, models.CrashBusAnomaly, models.CrashNoData, models.CrashParseAborted, models.CrashNoTimeBase} {
+		assert.Equal(t, []string{"write_db", "fusion_car"}, resultQueues(code), "%d", code)
+	}
+}
@@ -1,11 +1,18 @@
 package can_sig
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"AutoDataHub-monitor/configs"
+	"AutoDataHub-monitor/pkg/models"
 	"AutoDataHub-monitor/pkg/utils"
 
 	"gopkg.in/yaml.v3"
@@ -29,16 +36,47 @@ type TriggerFileData struct {
 	} `json:"data"`
 }
 
-// SignalThreshold 定义了单个信号及其阈值
-type SignalThreshold struct {
-	Name       string  `yaml:"name"`        // 信号名称
-	SignalName string  `yaml:"signal_name"` // 信号 ID
-	Threshold  float64 `yaml:"threshold"`   // 信号阈值
-}
-
 // CanSignalConfig 定义了 can_sig.yaml 文件的结构
 type CanSignalConfig struct {
-	Signals []SignalThreshold `yaml:"signals"` // 信号列表
+	Signals     []SignalThreshold        `yaml:"signals"`      // 信号列表
+	Groups      []RuleGroup              `yaml:"groups"`       // 组合规则，配置后按规则组判定碰撞类型，signals 只作为被引用的条件
+	Derived     []utils.DerivedSignal    `yaml:"derived"`      // 派生信号，规则中可以和原始信号一样按名称引用
+	ParsePolicy utils.CANParsePolicy     `yaml:"parse_policy"` // CAN 日志异常帧的容错策略
+	Window      TriggerWindow            `yaml:"window"`       // 评估时间窗口，未配置时评估整个文件
+	BusHealth   utils.CANBusHealthPolicy `yaml:"bus_health"`   // 报文周期和总线负载的诊断阈值，未配置的阈值取 utils 中的默认值
+	Resample    utils.CANResamplePolicy  `yaml:"resample"`     // 把不同报文的信号对齐到固定周期后再判断，period 配置为0时按原始帧判断
+}
+
+// defaultCanSignalConfig 各车型共用的默认配置，YAML 中只需配置与默认值不同的字段
+func defaultCanSignalConfig() CanSignalConfig {
+	return CanSignalConfig{
+		ParsePolicy: utils.CANParsePolicy{Mode: utils.CANParseThreshold, MaxErrorRate: 0.2},
+		Resample:    utils.CANResamplePolicy{Period: 10 * time.Millisecond, Method: utils.CANResampleHold, MaxStaleness: 100 * time.Millisecond},
+	}
+}
+
+// TriggerWindow 定义了围绕触发时间的评估窗口，只有窗口内的帧会被解码和判断
+type TriggerWindow struct {
+	PreTrigger  time.Duration `yaml:"pre_trigger"`  // 触发前的时长，如 5s
+	PostTrigger time.Duration `yaml:"post_trigger"` // 触发后的时长，如 10s
+}
+
+// enabled 判断是否配置了评估窗口
+func (w TriggerWindow) enabled() bool {
+	return w.PreTrigger > 0 || w.PostTrigger > 0
+}
+
+// bounds 返回以触发时间（Unix 毫秒）为基准的窗口起止时间
+func (w TriggerWindow) bounds(trigger int64) (start, end int64) {
+	return trigger - w.PreTrigger.Milliseconds(), trigger + w.PostTrigger.Milliseconds()
+}
+
+// describe 返回判定结论中记录的窗口描述
+func (w TriggerWindow) describe() string {
+	if !w.enabled() {
+		return "评估窗口: 整个文件"
+	}
+	return fmt.Sprintf("评估窗口: -%s/+%s", w.PreTrigger, w.PostTrigger)
 }
 
 // AngleDataPoint 存储方向盘转角数据点及其时间戳
@@ -47,11 +85,20 @@ type AngleDataPoint struct {
 	Value     float64
 }
 
+// signalDBCPath 解析 CAN 信号使用的 DBC 文件
+const signalDBCPath = "./configs/steering_angle.dbc"
+
+// dbcRegistry 所有队列共享的 DBC 注册表，DBC 文件只编译一次并在修改后自动重新加载
+var dbcRegistry = utils.DefaultDBCRegistry()
+
 type TriggeFileFromClient struct {
 	url        string
 	method     string
-	config     *CanSignalConfig // CAN 信号配置
-	signalList []string         // 存储信号名称列表
+	config     *CanSignalConfig              // CAN 信号配置
+	signalList []string                      // 存储信号名称列表
+	vehicles   *VehicleDBCConfig             // 车型与 DBC 映射
+	labels     map[string]map[float64]string // 当前车型 DBC 中信号取值对应的标签
+	converters []func(float64) float64       // 按规则顺序把信号值从 DBC 单位换算为规则单位，不需要换算时为 nil
 }
 
 // NewTriggerFromClient 创建一个新的 TriggeFileFromClient 实例
@@ -65,27 +112,127 @@ func NewTriggeFileFromClient(dbcPath string) *TriggeFileFromClient {
 		return nil
 	}
 	client.config = cfg
-	signalList := make([]string, 0, len(cfg.Signals))
-	for _, signal := range cfg.Signals {
-		signalList = append(signalList, signal.SignalName)
+	vehicles, err := loadVehicleDBCConfig(vehicleDBCPath)
+	if err != nil {
+		logger.Sugar().Errorf("加载车型DBC配置失败: %v", err)
+		return nil
 	}
-	client.signalList = signalList
+	client.vehicles = vehicles
+	client.signalList = cfg.decodedSignals()
 	return client
 }
 
+// decodedSignals 返回需要从 DBC 解码的信号：规则引用的原始信号和计算派生信号所需的信号
+func (c *CanSignalConfig) decodedSignals() []string {
+	derived := make(map[string]bool, len(c.Derived))
+	for _, def := range c.Derived {
+		derived[def.Name] = true
+	}
+	signals := make([]string, 0, len(c.Signals))
+	for _, signal := range c.Signals {
+		if !derived[signal.SignalName] && !slices.Contains(signals, signal.SignalName) {
+			signals = append(signals, signal.SignalName)
+		}
+	}
+	// 配置已在加载时校验
+	if deriver, err := utils.NewCANDeriver(c.Derived, c.Resample.Period); err == nil {
+		for _, name := range deriver.Inputs() {
+			if !slices.Contains(signals, name) {
+				signals = append(signals, name)
+			}
+		}
+	}
+	return signals
+}
+
 func loadCanSignalConfig(path string) (*CanSignalConfig, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("读取 CAN 信号配置文件失败 '%s': %w", path, err)
 	}
 
-	var cfg CanSignalConfig
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("解析 CAN 信号 YAML 配置失败: %w", err)
+	// 先解析为节点树，校验规则时按节点给出行号；拼写错误的字段同样报错
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("解析 CAN 信号 YAML 配置失败 '%s': %w", path, err)
+	}
+	cfg := defaultCanSignalConfig()
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("解析 CAN 信号 YAML 配置失败 '%s': %w", path, err)
+	}
+	var rules []*yaml.Node
+	if seq := yamlMappingValue(&root, "signals"); seq != nil {
+		rules = seq.Content
+	}
+	for i := range cfg.Signals {
+		var node *yaml.Node
+		if i < len(rules) {
+			node = rules[i]
+		}
+		if err := cfg.Signals[i].validate(node); err != nil {
+			return nil, fmt.Errorf("CAN 信号规则配置错误 '%s': %w", path, err)
+		}
+	}
+	if len(cfg.Groups) > 0 {
+		names := make(map[string]int, len(cfg.Signals))
+		for _, signal := range cfg.Signals {
+			names[signal.Name]++
+		}
+		var groups []*yaml.Node
+		if seq := yamlMappingValue(&root, "groups"); seq != nil {
+			groups = seq.Content
+		}
+		for i := range cfg.Groups {
+			var node *yaml.Node
+			if i < len(groups) {
+				node = groups[i]
+			}
+			if err := cfg.Groups[i].validate(node, names); err != nil {
+				return nil, fmt.Errorf("CAN 规则组配置错误 '%s': %w", path, err)
+			}
+		}
+	}
+	var derived []*yaml.Node
+	if seq := yamlMappingValue(&root, "derived"); seq != nil {
+		derived = seq.Content
+	}
+	for i, def := range cfg.Derived {
+		if err := def.Validate(); err != nil {
+			var node *yaml.Node
+			if i < len(derived) {
+				node = derived[i]
+			}
+			return nil, fmt.Errorf("CAN 派生信号配置错误 '%s': 第%d行: 派生信号 %q: %w", path, yamlFieldLine(node, "type"), def.Name, err)
+		}
+	}
+	// 引用关系和滤波参数在创建计算器时检查
+	deriver, err := utils.NewCANDeriver(cfg.Derived, cfg.Resample.Period)
+	if err != nil {
+		return nil, fmt.Errorf("CAN 派生信号配置错误 '%s': %w", path, err)
+	}
+	// cfc 需要缓冲全部样本后反向滤波，评估窗口限制缓冲的样本数
+	if deriver.Buffered() && !cfg.Window.enabled() {
+		return nil, fmt.Errorf("CAN 派生信号配置错误 '%s': cfc 滤波需要配置评估窗口 window", path)
+	}
+	if err := cfg.ParsePolicy.Validate(); err != nil {
+		return nil, fmt.Errorf("CAN 日志解析策略配置错误: %w", err)
+	}
+	if err := cfg.BusHealth.Validate(); err != nil {
+		return nil, fmt.Errorf("总线健康诊断配置错误: %w", err)
+	}
+	if err := cfg.Resample.Validate(); err != nil {
+		return nil, fmt.Errorf("重采样配置错误: %w", err)
+	}
+	if cfg.Window.PreTrigger < 0 || cfg.Window.PostTrigger < 0 {
+		return nil, fmt.Errorf("评估窗口配置错误: pre_trigger 和 post_trigger 不能为负数")
 	}
 	return &cfg, nil
 }
 
+// GetCanFile 下载触发时刻的 CAN 文件。文件可能是 gz/zst 压缩包或按总线分文件的 zip 归档，
+// 保存时不做处理，解析时按文件头透明解压并合并各路总线。
 func (t *TriggeFileFromClient) GetCanFile(path, vin string, ts int64) (outPath string, err error) {
 	var response TriggerFileData
 	requestData := struct {
@@ -119,43 +266,234 @@ func (t *TriggeFileFromClient) GetCanFile(path, vin string, ts int64) (outPath s
 	outPath = path
 	return
 }
-func (t *TriggeFileFromClient) GetSignalListFromFile(path string) (sigMap map[int64]map[string]float64, tsList []int64, err error) {
+func (t *TriggeFileFromClient) GetSignalListFromFile(path string, decoder *utils.CANDecoder) (sigMap map[int64]map[string]float64, tsList []int64, err error) {
 	defer os.Remove(path)
-	sigMap, tsList, err = utils.ParseCANLogWithDBC(path, "./configs/steering_angle.dbc", t.signalList)
+	sigMap, tsList, err = utils.ParseCANLogWithDecoder(path, decoder)
 	return
 }
 
-func (t *TriggeFileFromClient) IsSignalsReachesThreshold(sigMap map[int64]map[string]float64, tsList []int64) (isExceeded int, logStr string, err error) {
-Loop:
+// newDecoder 按车型（及年款）选择 DBC，创建把逻辑信号名映射到实际信号的解码器
+func (t *TriggeFileFromClient) newDecoder(data *models.NegativeTriggerData) (*utils.CANDecoder, error) {
+	modelYear := 0
+	if t.vehicles.needsModelYear(data.CarType) {
+		info, err := models.FindCarUserInfoByVin(configs.Client.MySQL, data.Vin)
+		if err != nil {
+			logger.Sugar().Warnf("查询车辆 %s 年款失败，按未知年款匹配DBC: %v", data.Vin, err)
+		} else {
+			modelYear = info.ModelYear
+		}
+	}
+	vehicle, err := t.vehicles.Lookup(data.CarType, modelYear)
+	if err != nil {
+		return nil, err
+	}
+	return vehicle.NewDecoder(dbcRegistry, t.signalList)
+}
+
+// IsSignalsReachesThreshold 按时间顺序判断各规则，返回判定结论代码、最先触发的规则描述，
+// 以及包含全部规则命中及峰值的结构化结论
+func (t *TriggeFileFromClient) IsSignalsReachesThreshold(sigMap map[int64]map[string]float64, tsList []int64) (isExceeded int, logStr string, verdict *CrashVerdict, err error) {
+	evaluator, err := t.newRuleEvaluator()
+	if err != nil {
+		return
+	}
 	for _, ts := range tsList {
-		signals := sigMap[ts]
-		for index, signal := range t.config.Signals {
-			val := signals[signal.SignalName]
-			if val > signal.Threshold {
-				isExceeded = index + 1
-				logStr += fmt.Sprintf("信号 %s 超过阈值 %f,", signal.Name, signal.Threshold)
-				break Loop
-			}
+		evaluator.push(ts, sigMap[ts])
+	}
+	isExceeded, logStr, verdict = evaluator.result()
+	return
+}
+
+// IsSignalsReachesThresholdStream 流式解码 CAN 文件并逐个样本判断全部规则，读完评估范围后给出判定结论，
+// 结构化结论中记录每个规则的全部超限区间及峰值。
+// 配置了重采样时规则在对齐到固定周期的样本上判断，不同报文中的信号在同一时刻同时可见。
+// 只解码触发时间（Unix 毫秒）前后评估窗口内的帧，异常帧按配置的容错策略处理，解析报告在出错时同样返回。
+// 日志只记录相对时间且文件头没有开始时间时，帧无法与触发时间对齐，返回 models.CrashNoTimeBase。
+// 没有有效值触发规则时，规则信号出现传感器故障值返回 models.CrashSensorFault，
+// 评估窗口内报文周期中断或总线负载过高返回 models.CrashBusAnomaly，
+// 评估窗口内没有任何信号数据时返回 models.CrashNoData，
+// 异常帧超过容错阈值、解析中止时返回 models.CrashParseAborted。无法判定的结论均不作为错误处理，以便照常入库。
+func (t *TriggeFileFromClient) IsSignalsReachesThresholdStream(path string, decoder *utils.CANDecoder, trigger int64) (isExceeded int, logStr string, verdict *CrashVerdict, report *utils.CANParseReport, err error) {
+	defer os.Remove(path)
+	stream, err := utils.OpenCANSampleStream(path, decoder)
+	if err != nil {
+		return
+	}
+	defer stream.Close()
+	if err = stream.SetPolicy(t.config.ParsePolicy); err != nil {
+		return
+	}
+	if err = stream.SetBusHealthPolicy(t.config.BusHealth); err != nil {
+		return
+	}
+	if t.config.Window.enabled() {
+		stream.SetTimeWindow(t.config.Window.bounds(trigger))
+	}
+	var resampler *utils.CANResampler
+	if t.config.Resample.Enabled() {
+		if resampler, err = utils.NewCANResamplerWithPolicy(t.config.Resample); err != nil {
+			return
+		}
+	}
+	evaluator, err := t.newRuleEvaluator()
+	if err != nil {
+		return
+	}
+	evaluate := func(sample *utils.CANSample) error {
+		evaluator.push(sample.Timestamp, sample.Signals)
+		return nil
+	}
+	var faultLog string
+	var evalErr error
+	err = stream.Each(func(sample *utils.CANSample) bool {
+		if faultLog == "" {
+			faultLog = t.describeFaults(sample.Faults)
+		}
+		if resampler != nil {
+			evalErr = resampler.Push(sample, evaluate)
+		} else {
+			evalErr = evaluate(sample)
 		}
+		return evalErr == nil
+	})
+	if err == nil {
+		err = evalErr
+	}
+	noData := errors.Is(err, utils.ErrNoCANSignalData)
+	aborted := errors.Is(err, utils.ErrCANParseAborted)
+	noTimeBase := errors.Is(err, utils.ErrCANRelativeTime)
+	abortErr := err
+	if noData || aborted || noTimeBase {
+		err = nil
+	}
+	if err == nil && resampler != nil {
+		err = resampler.Flush(evaluate)
+	}
+	isExceeded, logStr, verdict = evaluator.result()
+	report = stream.Report()
+	if err != nil || isExceeded != 0 {
+		return
 	}
+	switch {
+	case noTimeBase:
+		isExceeded, logStr = models.CrashNoTimeBase, models.CrashInfoMap[models.CrashNoTimeBase]+","
+	case aborted:
+		isExceeded, logStr = models.CrashParseAborted, describeParseAborted(report, abortErr)
+	case faultLog != "":
+		isExceeded, logStr = models.CrashSensorFault, faultLog
+	case len(report.Bus.Anomalies) > 0:
+		isExceeded, logStr = models.CrashBusAnomaly, describeBusAnomalies(report.Bus.Anomalies)
+	case noData:
+		isExceeded, logStr = models.CrashNoData, describeNoData(report)
+	}
+	verdict.Code, verdict.Reason = isExceeded, models.CrashInfoMap[isExceeded]
 	return
 }
 
-func (t *TriggeFileFromClient) IsCrash(vin string, ts int64) (isCrash int, crashInfo string, err error) {
-	outPath, err := t.GetCanFile(fmt.Sprintf("./logs/%s_%d.can", vin, ts), vin, ts)
+// describeBusAnomalies 返回判定结论中记录的总线异常描述，只列出前几条
+func describeBusAnomalies(anomalies []string) string {
+	const limit = 3
+	desc := models.CrashInfoMap[models.CrashBusAnomaly] + ": " + strings.Join(anomalies[:min(len(anomalies), limit)], "; ")
+	if len(anomalies) > limit {
+		desc += fmt.Sprintf(" 等%d项", len(anomalies))
+	}
+	return desc + ","
+}
+
+// describeNoData 返回评估窗口内没有信号数据时的描述，列出帧数统计便于区分时间不重叠和 DBC 不匹配
+func describeNoData(report *utils.CANParseReport) string {
+	return fmt.Sprintf("%s: 读取%d帧，窗口外%d帧，解码%d帧,", models.CrashInfoMap[models.CrashNoData], report.FramesRead, report.FramesOutsideWindow, report.FramesDecoded)
+}
+
+// describeParseAborted 返回解析中止时的描述，列出异常统计和中止原因
+func describeParseAborted(report *utils.CANParseReport, err error) string {
+	return fmt.Sprintf("%s: 读取%d帧，格式错误%d行，解码失败%d帧，%v,", models.CrashInfoMap[models.CrashParseAborted],
+		report.FramesRead, report.MalformedLines, report.DecodeErrors, err)
+}
+
+// describeFaults 按配置顺序返回首个出现传感器故障的规则信号描述，规则信号均无故障时返回空字符串
+func (t *TriggeFileFromClient) describeFaults(faults map[string]utils.SignalFault) string {
+	if len(faults) == 0 {
+		return ""
+	}
+	for _, signal := range t.config.Signals {
+		if fault, ok := faults[signal.SignalName]; ok {
+			return fmt.Sprintf("%s: 信号 %s %s,", models.CrashInfoMap[models.CrashSensorFault], signal.Name, fault)
+		}
+	}
+	return ""
+}
+
+// saveParseReport 把 CAN 日志解析报告保存到流程日志，用于区分日志问题和规则问题
+func saveParseReport(logID int, report *utils.CANParseReport) {
+	if logID == 0 || report == nil {
+		return
+	}
+	content, err := json.Marshal(report)
 	if err != nil {
-		logger.Error(fmt.Sprintf("获取can文件失败: %v", err))
+		logger.Sugar().Errorf("序列化解析报告失败: %v", err)
 		return
 	}
-	sigMap, tsList, err := t.GetSignalListFromFile(outPath)
+	if err := models.UpdateProcessLog(configs.Client.MySQL, map[string]interface{}{"id": logID, "parse_report": string(content)}); err != nil {
+		logger.Sugar().Errorf("保存解析报告失败: %v", err)
+	}
+}
+
+// encodeDTCs 把解析报告中的诊断故障码序列化为 JSON 随判定结论入库，没有故障码时返回空字符串
+func encodeDTCs(report *utils.CANParseReport) string {
+	if report == nil || report.Diagnostics == nil || len(report.Diagnostics.DTCs) == 0 {
+		return ""
+	}
+	content, err := json.Marshal(report.Diagnostics.DTCs)
 	if err != nil {
-		logger.Error(fmt.Sprintf("解析can文件失败: %v", err))
+		logger.Sugar().Errorf("序列化诊断故障码失败: %v", err)
+		return ""
+	}
+	return string(content)
+}
+
+// unitConverters 按规则配置的单位和 DBC 中信号的单位生成换算函数。
+// DBC 未标注单位时认为与规则单位相同，单位无法换算时返回错误。
+func (t *TriggeFileFromClient) unitConverters(units map[string]string) ([]func(float64) float64, error) {
+	converters := make([]func(float64) float64, len(t.config.Signals))
+	for i, signal := range t.config.Signals {
+		unit := units[signal.SignalName]
+		if signal.Unit == "" || unit == "" || strings.EqualFold(strings.TrimSpace(unit), strings.TrimSpace(signal.Unit)) {
+			continue
+		}
+		convert, err := utils.UnitConverter(unit, signal.Unit)
+		if err != nil {
+			return nil, fmt.Errorf("规则 %s 的单位与 DBC 不一致: %w", signal.Name, err)
+		}
+		converters[i] = convert
+	}
+	return converters, nil
+}
+
+func (t *TriggeFileFromClient) IsCrash(data *models.NegativeTriggerData) (isCrash int, crashInfo string, err error) {
+	decoder, err := t.newDecoder(data)
+	if err != nil {
+		logger.Error(fmt.Sprintf("选择车型DBC失败: %v", err))
 		return
 	}
-	isCrash, crashInfo, err = t.IsSignalsReachesThreshold(sigMap, tsList)
+	t.labels = decoder.ValueLabels()
+	if t.converters, err = t.unitConverters(decoder.Units()); err != nil {
+		logger.Error(fmt.Sprintf("规则单位配置错误: %v", err))
+		return
+	}
+	outPath, err := t.GetCanFile(fmt.Sprintf("./logs/%s_%d.can", data.Vin, data.Timestamp), data.Vin, data.Timestamp)
 	if err != nil {
-		logger.Error(fmt.Sprintf("判断信号是否超过阈值失败: %v", err))
+		logger.Error(fmt.Sprintf("获取can文件失败: %v", err))
+		return
+	}
+	isCrash, crashInfo, verdict, report, err := t.IsSignalsReachesThresholdStream(outPath, decoder, utils.NormalizeEpochMillis(data.Timestamp))
+	saveParseReport(data.LogId, report)
+	data.DTCs = encodeDTCs(report)
+	data.Verdict = encodeVerdict(verdict)
+	if err != nil {
+		logger.Error(fmt.Sprintf("解析can文件失败: %v", err))
 		return
 	}
+	crashInfo += t.config.Window.describe()
 	return
 }
@@ -0,0 +1,238 @@
+package can_sig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"AutoDataHub-monitor/pkg/models"
+	"AutoDataHub-monitor/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// streamTestDBC 加速度报文周期 10ms，物理范围 0~20g，原始值 0xFF 按饱和处理
+const streamTestDBC = `VERSION ""
+
+BO_ 291 Accel: 8 ACU
+ SG_ LongitudinalAcceleration : 0|8@1+ (0.1,0) [0|20] "g" Vector__XXX
+
+BA_DEF_ BO_ "GenMsgCycleTime" INT 0 10000;
+BA_DEF_DEF_ "GenMsgCycleTime" 0;
+BA_ "GenMsgCycleTime" BO_ 291 10;
+`
+
+const streamTestConfig = `signals:
+  - name: LongitudinalAcceleration
+    signal_name: LongitudinalAcceleration
+    threshold: 1.5
+`
+
+// streamTestBase 测试日志的起始时间（Unix 毫秒）
+const streamTestBase = int64(1620000000000)
+
+// candumpLine 返回在 streamTestBase 之后 ms 毫秒的 candump 行，frame 为 ID#数据
+func candumpLine(ms int64, frame string) string {
+	ts := streamTestBase + ms
+	return fmt.Sprintf("(%d.%06d) can0 %s", ts/1000, ts%1000*1000, frame)
+}
+
+// accelFrames 返回从 start 开始每 10ms 一帧加速度报文的 candump 行，raws 为各帧的原始值；
+// extra 不为空时在每帧之后插入一行 extra 帧
+func accelFrames(start int64, extra string, raws ...byte) []string {
+	var lines []string
+	for i, raw := range raws {
+		ms := start + int64(i)*10
+		lines = append(lines, candumpLine(ms, fmt.Sprintf("123#%02X", raw)))
+		if extra != "" {
+			lines = append(lines, candumpLine(ms+5, extra))
+		}
+	}
+	return lines
+}
+
+// repeatRaw 返回 n 个相同的原始值
+func repeatRaw(raw byte, n int) []byte {
+	raws := make([]byte, n)
+	for i := range raws {
+		raws[i] = raw
+	}
+	return raws
+}
+
+// runStream 把日志行写入临时文件，按生产流程流式解码并判断，trigger 为触发时间（Unix 毫秒）
+func runStream(t *testing.T, trigger *TriggeFileFromClient, at int64, lines ...string) (int, string, *CrashVerdict, *utils.CANParseReport, error) {
+	t.Helper()
+	db, err := utils.ParseDBC("stream.dbc", []byte(streamTestDBC))
+	require.NoError(t, err)
+	decoder, err := utils.NewCANDecoder([]utils.DBCBinding{{DBC: utils.CompileDBC(db)}}, trigger.config.decodedSignals(), nil)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "trace.can")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644))
+	return trigger.IsSignalsReachesThresholdStream(path, decoder, at)
+}
+
+func TestStreamParseAborted(t *testing.T) {
+	trigger := newTestTrigger(t, streamTestConfig)
+	// 默认 threshold 策略下异常比例超过 20% 时中止，结论为无法判定而不是错误
+	code, desc, verdict, report, err := runStream(t, trigger, streamTestBase+1000, accelFrames(0, "123#XYZ", repeatRaw(5, 200)...)...)
+	require.NoError(t, err)
+	assert.Equal(t, models.CrashParseAborted, code)
+	assert.Equal(t, models.CrashParseAborted, verdict.Code)
+	assert.Equal(t, models.CrashInfoMap[models.CrashParseAborted], verdict.Reason)
+	assert.Contains(t, desc, "格式错误50行")
+	assert.True(t, report.Aborted)
+
+	// 中止前已确认触发的规则优先
+	code, _, verdict, _, err = runStream(t, trigger, streamTestBase+1000, accelFrames(0, "123#XYZ", append([]byte{20, 20}, repeatRaw(5, 198)...)...)...)
+	require.NoError(t, err)
+	assert.Equal(t, 1, code)
+	assert.Len(t, verdict.Hits, 1)
+
+	// 日志中一半的帧未在 DBC 中定义时不中止
+	code, _, _, report, err = runStream(t, trigger, streamTestBase+1000, accelFrames(0, "7FF#01", repeatRaw(5, 200)...)...)
+	require.NoError(t, err)
+	assert.Zero(t, code)
+	assert.False(t, report.Aborted)
+	assert.Equal(t, map[string]int{"0x7FF": 200}, report.UnknownIDs)
+}
+
+func TestStreamRelativeTime(t *testing.T) {
+	trigger := newTestTrigger(t, streamTestConfig+`window:
+  pre_trigger: 5s
+  post_trigger: 10s
+`)
+	// 只有相对时间的日志不按评估窗口推算开始时间，结论为无法判定
+	code, desc, verdict, report, err := runStream(t, trigger, streamTestBase, "(000.000000) can0 123#14", "(000.010000) can0 123#14")
+	require.NoError(t, err)
+	assert.Equal(t, models.CrashNoTimeBase, code)
+	assert.Equal(t, models.CrashNoTimeBase, verdict.Code)
+	assert.Contains(t, desc, models.CrashInfoMap[models.CrashNoTimeBase])
+	assert.True(t, report.RelativeTime)
+	assert.Empty(t, verdict.Hits)
+
+	// 开始时间取自 ASC 文件头，超限时间为日志中的实际时间
+	start := time.Date(2022, 1, 10, 10, 0, 0, 0, time.Local).UnixMilli()
+	code, _, verdict, _, err = runStream(t, trigger, start+1000,
+		"date Mon Jan 10 10:00:00.000 am 2022",
+		"base hex  timestamps absolute",
+		"   2.000000 1  123             Rx   d 8 14 00 00 00 00 00 00 00",
+		"   2.010000 1  123             Rx   d 8 14 00 00 00 00 00 00 00",
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 1, code)
+	require.Len(t, verdict.Hits, 1)
+	assert.Equal(t, start+2000, verdict.Hits[0].FirstExceed)
+}
+
+func TestStreamSensorFault(t *testing.T) {
+	trigger := newTestTrigger(t, streamTestConfig)
+	// 原始值 0xFF 为 25.5g，超出 DBC 范围，作为传感器故障而不是超限
+	code, desc, verdict, _, err := runStream(t, trigger, streamTestBase, accelFrames(0, "", 5, 5, 0xFF, 0xFF, 5, 5)...)
+	require.NoError(t, err)
+	assert.Equal(t, models.CrashSensorFault, code)
+	assert.Equal(t, models.CrashSensorFault, verdict.Code)
+	assert.Equal(t, models.CrashInfoMap[models.CrashSensorFault], verdict.Reason)
+	assert.Contains(t, desc, "信号 LongitudinalAcceleration 取值 25.5")
+	assert.Empty(t, verdict.Hits)
+
+	// 确认触发的规则优先于传感器故障，无论故障出现在触发之前还是之后
+	for _, raws := range [][]byte{{20, 20, 0xFF, 5}, {0xFF, 5, 20, 20}} {
+		code, _, verdict, _, err = runStream(t, trigger, streamTestBase, accelFrames(0, "", raws...)...)
+		require.NoError(t, err)
+		assert.Equal(t, 1, code, "%v", raws)
+		assert.Equal(t, 1, verdict.Code)
+		assert.Len(t, verdict.Hits, 1)
+	}
+}
+
+func TestStreamBusAnomaly(t *testing.T) {
+	trigger := newTestTrigger(t, streamTestConfig)
+	// 周期 10ms 的报文中断 150ms，判定为总线通信异常
+	gap := func(raws ...byte) []string {
+		return append(accelFrames(0, "", raws[:6]...), accelFrames(200, "", raws[6:]...)...)
+	}
+	code, desc, verdict, report, err := runStream(t, trigger, streamTestBase, gap(repeatRaw(5, 12)...)...)
+	require.NoError(t, err)
+	assert.Equal(t, models.CrashBusAnomaly, code)
+	assert.Equal(t, models.CrashBusAnomaly, verdict.Code)
+	assert.Equal(t, models.CrashInfoMap[models.CrashBusAnomaly], verdict.Reason)
+	assert.Contains(t, desc, "报文 Accel(0x123) 最大间隔 150ms，周期 10ms")
+	assert.Contains(t, desc, "丢帧 14/26")
+	assert.Len(t, report.Bus.Anomalies, 2)
+
+	// 确认触发的规则优先于总线异常
+	code, _, verdict, _, err = runStream(t, trigger, streamTestBase, gap(append(repeatRaw(5, 10), 20, 20)...)...)
+	require.NoError(t, err)
+	assert.Equal(t, 1, code)
+	assert.Equal(t, 1, verdict.Code)
+
+	// 同时有传感器故障时按传感器故障判定
+	code, _, _, _, err = runStream(t, trigger, streamTestBase, gap(append(repeatRaw(5, 10), 0xFF, 5)...)...)
+	require.NoError(t, err)
+	assert.Equal(t, models.CrashSensorFault, code)
+
+	// 报文按周期连续发送时没有异常
+	code, _, _, report, err = runStream(t, trigger, streamTestBase, accelFrames(0, "", repeatRaw(5, 12)...)...)
+	require.NoError(t, err)
+	assert.Zero(t, code)
+	assert.Empty(t, report.Bus.Anomalies)
+}
+
+func TestStreamWindow(t *testing.T) {
+	trigger := newTestTrigger(t, streamTestConfig+`window:
+  pre_trigger: 1s
+  post_trigger: 1s
+`)
+	// 开头 20ms 超限，10s 后恢复正常
+	lines := append(accelFrames(0, "", append([]byte{20, 20}, repeatRaw(5, 10)...)...), accelFrames(10000, "", repeatRaw(5, 12)...)...)
+
+	code, _, verdict, report, err := runStream(t, trigger, streamTestBase+500, lines...)
+	require.NoError(t, err)
+	assert.Equal(t, 1, code)
+	require.Len(t, verdict.Hits, 1)
+	assert.Equal(t, streamTestBase, verdict.Hits[0].FirstExceed)
+	// 读到晚于窗口结束时间加乱序余量的帧后停止读取
+	assert.Equal(t, 13, report.FramesRead)
+	assert.Equal(t, 1, report.FramesOutsideWindow)
+
+	// 窗口外的超限不参与判断
+	code, _, verdict, report, err = runStream(t, trigger, streamTestBase+10050, lines...)
+	require.NoError(t, err)
+	assert.Zero(t, code)
+	assert.Empty(t, verdict.Hits)
+	assert.Equal(t, 12, report.FramesOutsideWindow)
+	assert.Empty(t, report.Bus.Anomalies)
+
+	// 窗口内没有帧时结论为无法判定
+	code, desc, verdict, _, err := runStream(t, trigger, streamTestBase+60000, lines...)
+	require.NoError(t, err)
+	assert.Equal(t, models.CrashNoData, code)
+	assert.Equal(t, models.CrashNoData, verdict.Code)
+	assert.Equal(t, models.CrashInfoMap[models.CrashNoData]+": 读取24帧，窗口外24帧，解码0帧,", desc)
+}
+
+func TestStreamResample(t *testing.T) {
+	// 不等间隔的帧按 10ms 网格零阶保持后判断，超限区间落在网格点上
+	lines := []string{candumpLine(0, "123#05"), candumpLine(13, "123#14"), candumpLine(27, "123#14"), candumpLine(41, "123#05")}
+	code, _, verdict, _, err := runStream(t, newTestTrigger(t, streamTestConfig), streamTestBase, lines...)
+	require.NoError(t, err)
+	assert.Equal(t, 1, code)
+	require.Len(t, verdict.Hits, 1)
+	assert.Equal(t, streamTestBase+20, verdict.Hits[0].FirstExceed)
+	assert.Equal(t, streamTestBase+40, verdict.Hits[0].End)
+
+	// 关闭重采样时按原始帧的时间判断
+	code, _, verdict, _, err = runStream(t, newTestTrigger(t, streamTestConfig+`resample:
+  period: 0s
+`), streamTestBase, lines...)
+	require.NoError(t, err)
+	assert.Equal(t, 1, code)
+	require.Len(t, verdict.Hits, 1)
+	assert.Equal(t, streamTestBase+13, verdict.Hits[0].FirstExceed)
+	assert.Equal(t, streamTestBase+27, verdict.Hits[0].End)
+}
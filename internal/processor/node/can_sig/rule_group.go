@@ -0,0 +1,167 @@
+package can_sig
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"AutoDataHub-monitor/pkg/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxConditionMatches 每个条件最多保留的满足组合数，按时间取最早的，避免多次超限时组合数膨胀
+const maxConditionMatches = 64
+
+// RuleCondition 规则组中的条件：引用 signals 中的单个规则，或由 all/any 组合的子条件，可以嵌套
+type RuleCondition struct {
+	Rule   string          `yaml:"rule"`   // signals 中的规则名称
+	All    []RuleCondition `yaml:"all"`    // 全部满足
+	Any    []RuleCondition `yaml:"any"`    // 任一满足
+	Within time.Duration   `yaml:"within"` // 只用于 all 的子条件：须在前面的子条件都满足后该时长内满足，0 表示不限先后
+}
+
+// RuleGroup 命名的组合规则，满足时判定为对应的碰撞类型
+type RuleGroup struct {
+	Name          string `yaml:"name"`     // 规则组名称
+	Category      string `yaml:"category"` // 碰撞类型，须为 models.CrashInfoMap 中的描述，如 正面碰撞
+	RuleCondition `yaml:",inline"`
+
+	code int // category 对应的判定结论
+}
+
+// validate 校验规则组并解析碰撞类型，rules 为 signals 中各规则名称出现的次数
+func (g *RuleGroup) validate(node *yaml.Node, rules map[string]int) error {
+	if g.Name == "" {
+		return fmt.Errorf("第%d行: 规则组名称不能为空", yamlFieldLine(node, "name"))
+	}
+	g.code = crashCategory(g.Category)
+	if g.code <= 0 {
+		return fmt.Errorf("第%d行: 规则组 %q: 未知的碰撞类型 %q", yamlFieldLine(node, "category"), g.Name, g.Category)
+	}
+	return g.RuleCondition.validate(g.Name, node, rules, false)
+}
+
+// crashCategory 返回碰撞类型描述对应的判定结论，不存在时返回0
+func crashCategory(name string) int {
+	for code, desc := range models.CrashInfoMap {
+		if code > 0 && desc == name {
+			return code
+		}
+	}
+	return 0
+}
+
+// validate 递归校验条件，sequenced 表示该条件是 all 中可以配置 within 的子条件
+func (c *RuleCondition) validate(group string, node *yaml.Node, rules map[string]int, sequenced bool) error {
+	fail := func(field, format string, args ...any) error {
+		return fmt.Errorf("第%d行: 规则组 %q: %s", yamlFieldLine(node, field), group, fmt.Sprintf(format, args...))
+	}
+	kinds := 0
+	for _, set := range []bool{c.Rule != "", c.All != nil, c.Any != nil} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return fail("rule", "条件必须且只能配置 rule、all、any 之一")
+	}
+	if c.Within < 0 || c.Within > 0 && !sequenced {
+		return fail("within", "within 只能配置在 all 的第二个及之后的子条件上，且不能为负数")
+	}
+	if c.Rule != "" {
+		switch rules[c.Rule] {
+		case 0:
+			return fail("rule", "引用的规则 %q 不存在", c.Rule)
+		case 1:
+			return nil
+		default:
+			return fail("rule", "引用的规则 %q 在 signals 中重名", c.Rule)
+		}
+	}
+	key, children := "all", c.All
+	if c.Any != nil {
+		key, children = "any", c.Any
+	}
+	if len(children) == 0 {
+		return fail(key, "%s 不能为空", key)
+	}
+	var nodes []*yaml.Node
+	if seq := yamlMappingValue(node, key); seq != nil {
+		nodes = seq.Content
+	}
+	for i := range children {
+		child := node
+		if i < len(nodes) {
+			child = nodes[i]
+		}
+		if err := children[i].validate(group, child, rules, key == "all" && i > 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// conditionMatch 条件的一次满足
+type conditionMatch struct {
+	time        int64         // 满足的时间（Unix 毫秒），取最后一个超限区间的开始时间
+	exceedances []*exceedance // 使条件满足的超限区间，按条件顺序排列
+}
+
+// matches 按各规则的超限区间返回条件的全部满足组合，按时间排序
+func (c *RuleCondition) matches(exceedances map[string][]*exceedance) []conditionMatch {
+	var result []conditionMatch
+	switch {
+	case c.Rule != "":
+		for _, ex := range exceedances[c.Rule] {
+			result = append(result, conditionMatch{ex.start, []*exceedance{ex}})
+		}
+	case c.Any != nil:
+		for i := range c.Any {
+			result = append(result, c.Any[i].matches(exceedances)...)
+		}
+	default:
+		result = c.All[0].matches(exceedances)
+		for i := 1; i < len(c.All) && len(result) > 0; i++ {
+			child := &c.All[i]
+			next := child.matches(exceedances)
+			var combined []conditionMatch
+			for _, prev := range result {
+				for _, m := range next {
+					if child.Within > 0 && (m.time < prev.time || m.time-prev.time > child.Within.Milliseconds()) {
+						continue
+					}
+					combined = append(combined, conditionMatch{
+						time:        max(prev.time, m.time),
+						exceedances: append(append([]*exceedance(nil), prev.exceedances...), m.exceedances...),
+					})
+				}
+			}
+			result = combined
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].time < result[j].time })
+	if len(result) > maxConditionMatches {
+		result = result[:maxConditionMatches]
+	}
+	return result
+}
+
+// groupResult 按配置顺序返回首个满足的规则组的碰撞类型、描述和名称，描述中列出使其满足的各超限区间
+func (e *ruleEvaluator) groupResult() (int, string, string) {
+	for i := range e.t.config.Groups {
+		g := &e.t.config.Groups[i]
+		matches := g.matches(e.exceedances)
+		if len(matches) == 0 {
+			continue
+		}
+		var desc strings.Builder
+		fmt.Fprintf(&desc, "规则组 %s（%s）满足:", g.Name, g.Category)
+		for _, ex := range matches[0].exceedances {
+			desc.WriteString(" " + ex.describe())
+		}
+		return g.code, desc.String(), g.Name
+	}
+	return 0, "", ""
+}
@@ -0,0 +1,207 @@
+package can_sig
+
+import (
+	"testing"
+	"time"
+
+	"AutoDataHub-monitor/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const groupTestConfig = `signals:
+  - name: Longitudinal
+    signal_name: ax
+    operator: abs>
+    threshold: 4
+  - name: Lateral
+    signal_name: ay
+    operator: abs>
+    threshold: 3
+  - name: Roll
+    signal_name: roll
+    operator: abs>
+    threshold: 60
+  - name: Airbag
+    signal_name: airbag
+    threshold: 0
+groups:
+  - name: Frontal
+    category: 正面碰撞
+    all:
+      - rule: Longitudinal
+      - rule: Airbag
+        within: 100ms
+  - name: Side
+    category: 侧面碰撞
+    any:
+      - all:
+          - rule: Lateral
+          - rule: Airbag
+            within: 100ms
+      - all:
+          - rule: Lateral
+          - rule: Longitudinal
+  - name: Rollover
+    category: 侧翻
+    all:
+      - rule: Roll
+      - any:
+          - rule: Lateral
+          - rule: Airbag
+`
+
+func TestRuleGroups(t *testing.T) {
+	trigger := newTestTrigger(t, groupTestConfig)
+	for _, tc := range []struct {
+		name   string
+		sigMap map[int64]map[string]float64
+		code   int
+		group  string
+	}{
+		{
+			name:   "all 的子条件在 within 内满足",
+			sigMap: map[int64]map[string]float64{1000: {"ax": -5}, 1100: {"airbag": 1}},
+			code:   5, group: "Frontal",
+		},
+		{
+			name:   "all 的子条件超出 within",
+			sigMap: map[int64]map[string]float64{1000: {"ax": -5}, 1101: {"airbag": 1}},
+		},
+		{
+			name:   "within 要求子条件按顺序满足",
+			sigMap: map[int64]map[string]float64{1000: {"airbag": 1}, 1050: {"ax": -5}},
+		},
+		{
+			name:   "any 的第一个嵌套 all 满足",
+			sigMap: map[int64]map[string]float64{1000: {"ay": 3.5}, 1080: {"airbag": 1}},
+			code:   6, group: "Side",
+		},
+		{
+			name:   "any 的第二个嵌套 all 满足，未配置 within 时不限先后",
+			sigMap: map[int64]map[string]float64{1000: {"ax": 4.5}, 3000: {"ay": -3.5}},
+			code:   6, group: "Side",
+		},
+		{
+			name:   "all 中嵌套 any",
+			sigMap: map[int64]map[string]float64{1000: {"roll": 75}, 1500: {"airbag": 1}},
+			code:   7, group: "Rollover",
+		},
+		{
+			name:   "多个规则组满足时取配置在前的",
+			sigMap: map[int64]map[string]float64{1000: {"ax": 5, "ay": 4}, 1050: {"airbag": 1}},
+			code:   5, group: "Frontal",
+		},
+		{
+			name:   "单个规则触发但没有规则组满足",
+			sigMap: map[int64]map[string]float64{1000: {"ay": 3.5}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			code, desc, verdict := evaluate(t, trigger, tc.sigMap)
+			assert.Equal(t, tc.code, code)
+			assert.Equal(t, tc.code, verdict.Code)
+			assert.Equal(t, tc.group, verdict.Group)
+			assert.Equal(t, models.CrashInfoMap[tc.code], verdict.Reason)
+			if tc.code != 0 {
+				assert.Contains(t, desc, "规则组 "+tc.group+"（"+models.CrashInfoMap[tc.code]+"）满足:")
+			} else {
+				assert.Empty(t, desc)
+			}
+		})
+	}
+}
+
+func TestRuleGroupDescribesMatch(t *testing.T) {
+	trigger := newTestTrigger(t, groupTestConfig)
+	// 两次纵向超限，只有第二次与气囊信号在 within 内，描述中列出使规则组满足的超限区间
+	code, desc, verdict := evaluate(t, trigger, map[int64]map[string]float64{
+		1000: {"ax": 5},
+		1010: {"ax": 0},
+		2000: {"ax": 6},
+		2050: {"airbag": 1},
+	})
+	require.Equal(t, 5, code)
+	assert.Contains(t, desc, "信号 Longitudinal 绝对值超过阈值 4.000000, 超限开始 "+formatTestTime(2000))
+	assert.NotContains(t, desc, formatTestTime(1000))
+	assert.Contains(t, desc, "信号 Airbag 超过阈值 0.000000, 超限开始 "+formatTestTime(2050))
+	// 结构化结论中包含全部超限区间
+	assert.Len(t, verdict.Hits, 3)
+}
+
+func TestCrashCategory(t *testing.T) {
+	assert.Equal(t, 5, crashCategory("正面碰撞"))
+	assert.Equal(t, 6, crashCategory("侧面碰撞"))
+	assert.Equal(t, 7, crashCategory("侧翻"))
+	// 无法判定的结论不能作为碰撞类型
+	assert.Zero(t, crashCategory(models.CrashInfoMap[models.CrashSensorFault]))
+	assert.Zero(t, crashCategory("追尾"))
+}
+
+func TestRuleGroupValidation(t *testing.T) {
+	const signals = `signals:
+  - name: A
+    signal_name: a
+    threshold: 1
+  - name: B
+    signal_name: b
+    threshold: 1
+`
+	for _, tc := range []struct {
+		name   string
+		groups string
+		want   string
+	}{
+		{"未知碰撞类型", `groups:
+  - name: G
+    category: 追尾
+    rule: A
+`, `第10行: 规则组 "G": 未知的碰撞类型 "追尾"`},
+		{"引用不存在的规则", `groups:
+  - name: G
+    category: 侧翻
+    all:
+      - rule: A
+      - rule: C
+`, `第13行: 规则组 "G": 引用的规则 "C" 不存在`},
+		{"within 配置在第一个子条件上", `groups:
+  - name: G
+    category: 侧翻
+    all:
+      - rule: A
+        within: 1s
+      - rule: B
+`, `第13行: 规则组 "G": within 只能配置在 all 的第二个及之后的子条件上`},
+		{"within 配置在 any 的子条件上", `groups:
+  - name: G
+    category: 侧翻
+    any:
+      - rule: A
+      - rule: B
+        within: 1s
+`, `第14行: 规则组 "G": within 只能配置在`},
+		{"同时配置 rule 和 all", `groups:
+  - name: G
+    category: 侧翻
+    rule: A
+    all:
+      - rule: B
+`, `第11行: 规则组 "G": 条件必须且只能配置 rule、all、any 之一`},
+		{"all 为空", `groups:
+  - name: G
+    category: 侧翻
+    all: []
+`, `第11行: 规则组 "G": all 不能为空`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTestConfig(t, signals+tc.groups)
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+}
+
+// formatTestTime 按判定描述中的格式输出 Unix 毫秒时间
+func formatTestTime(ms int64) string {
+	return time.UnixMilli(ms).Format(exceedanceTimeLayout)
+}
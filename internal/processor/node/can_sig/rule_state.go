@@ -0,0 +1,239 @@
+package can_sig
+
+import (
+	"fmt"
+	"time"
+
+	"AutoDataHub-monitor/pkg/utils"
+)
+
+// exceedanceTimeLayout 超限区间起止时间的格式
+const exceedanceTimeLayout = "2006-01-02 15:04:05.000"
+
+// ruleState 单个规则按样本顺序跟踪的超限状态
+type ruleState struct {
+	rule   *SignalThreshold
+	active bool // 按阈值和滞回判断当前样本是否超限
+
+	// 最近 sample_window 个样本，循环使用
+	recent []bool
+	times  []int64
+	next   int
+	count  int
+	hits   int // recent 中超限的样本数
+
+	open  bool  // 是否处于满足 samples/sample_window 条件的超限区间
+	start int64 // 超限区间的开始时间（Unix 毫秒）
+	last  int64 // 区间内最后一个超限样本的时间
+
+	// 区间内超出触发条件最多的样本
+	peak       float64
+	peakTs     int64
+	peakMargin float64
+
+	current *exceedance // 已确认触发、尚未结束的超限区间
+}
+
+// update 输入规则信号的一个样本，返回该时刻是否处于超限区间
+func (st *ruleState) update(ts int64, value float64, label string) bool {
+	if st.active {
+		st.active = st.rule.holding(value, label)
+	} else {
+		st.active = st.rule.reached(value, label)
+	}
+	inside := st.active
+	if w := st.rule.SampleWindow; w > 0 {
+		if st.recent == nil {
+			st.recent, st.times = make([]bool, w), make([]int64, w)
+		}
+		if st.count == w && st.recent[st.next] {
+			st.hits--
+		}
+		st.recent[st.next], st.times[st.next] = st.active, ts
+		if st.active {
+			st.hits++
+		}
+		st.next = (st.next + 1) % w
+		st.count = min(st.count+1, w)
+		inside = st.hits >= st.rule.Samples
+	}
+	if !inside {
+		st.open = false
+		return false
+	}
+	margin := st.rule.margin(value)
+	if !st.open {
+		st.open, st.start = true, st.firstHit(ts)
+		st.peak, st.peakTs, st.peakMargin = value, ts, margin
+	} else if margin > st.peakMargin {
+		st.peak, st.peakTs, st.peakMargin = value, ts, margin
+	}
+	if st.active {
+		st.last = ts
+	}
+	return true
+}
+
+// firstHit 返回样本窗口中最早的超限样本时间，未配置样本窗口时返回 ts
+func (st *ruleState) firstHit(ts int64) int64 {
+	if st.recent == nil {
+		return ts
+	}
+	first := ts
+	for i := 0; i < st.count; i++ {
+		// 窗口未满时从0开始，满了之后 next 指向最早的样本
+		k := i
+		if st.count == len(st.recent) {
+			k = (st.next + i) % len(st.recent)
+		}
+		if st.recent[k] {
+			first = min(first, st.times[k])
+		}
+	}
+	return first
+}
+
+// confirmed 判断超限区间是否已满足持续时长
+func (st *ruleState) confirmed(ts int64) bool {
+	return st.open && ts-st.start >= st.rule.Duration.Milliseconds()
+}
+
+// exceedance 规则确认触发的一次超限区间
+type exceedance struct {
+	rule       *SignalThreshold
+	index      int   // 规则序号，从1开始
+	start      int64 // 开始时间（Unix 毫秒）
+	confirmed  int64 // 满足持续条件、确认触发的时间
+	last       int64 // 最后一个超限样本的时间
+	peak       float64
+	peakTs     int64
+	peakMargin float64
+	ended      bool // 信号已退出超限，为 false 时数据结束时仍在超限
+}
+
+// describe 返回超限区间的判定描述
+func (ex *exceedance) describe() string {
+	desc := ex.rule.describe()
+	if cond := ex.rule.conditions(); cond != "" {
+		desc += " 条件: " + cond + ","
+	}
+	desc += fmt.Sprintf(" 超限开始 %s, 结束 %s, 持续 %s, 峰值 %f（%s）",
+		time.UnixMilli(ex.start).Format(exceedanceTimeLayout),
+		time.UnixMilli(ex.last).Format(exceedanceTimeLayout),
+		time.Duration(ex.last-ex.start)*time.Millisecond,
+		ex.peak, time.UnixMilli(ex.peakTs).Format(exceedanceTimeLayout))
+	if !ex.ended {
+		desc += "（数据结束时仍未退出）"
+	}
+	return desc + ","
+}
+
+// ruleEvaluator 按时间顺序逐个样本判断全部规则，记录评估范围内每个规则确认触发的全部超限区间，
+// 读完后再给出判定结论。
+type ruleEvaluator struct {
+	t       *TriggeFileFromClient
+	states  []ruleState
+	deriver *utils.CANDeriver // 在判断规则前计算派生信号
+
+	// 有 cfc 派生信号时先缓冲评估窗口内的全部样本，读完后再计算派生信号和判断规则
+	buffered   []int64
+	bufSignals []map[string]float64
+
+	exceedances map[string][]*exceedance // 各规则的超限区间，key 为规则名称
+	all         []*exceedance            // 全部超限区间，按确认触发的先后排列
+}
+
+func (t *TriggeFileFromClient) newRuleEvaluator() (*ruleEvaluator, error) {
+	deriver, err := utils.NewCANDeriver(t.config.Derived, t.config.Resample.Period)
+	if err != nil {
+		return nil, err
+	}
+	e := &ruleEvaluator{
+		t:           t,
+		states:      make([]ruleState, len(t.config.Signals)),
+		deriver:     deriver,
+		exceedances: make(map[string][]*exceedance),
+	}
+	for i := range t.config.Signals {
+		e.states[i].rule = &t.config.Signals[i]
+	}
+	return e, nil
+}
+
+// push 输入一个时间点的信号，派生信号会写入 signals。需要缓冲时只记录样本，在 result 中判断
+func (e *ruleEvaluator) push(ts int64, signals map[string]float64) {
+	if e.deriver.Buffered() {
+		e.buffered = append(e.buffered, ts)
+		e.bufSignals = append(e.bufSignals, signals)
+		return
+	}
+	e.deriver.Apply(ts, signals)
+	e.evaluate(ts, signals)
+}
+
+// flush 计算缓冲样本的派生信号并逐个判断规则
+func (e *ruleEvaluator) flush() {
+	e.deriver.ApplyAll(e.buffered, e.bufSignals)
+	for i, ts := range e.buffered {
+		e.evaluate(ts, e.bufSignals[i])
+	}
+	e.buffered, e.bufSignals = nil, nil
+}
+
+// evaluate 按一个时间点的信号更新各规则的状态
+func (e *ruleEvaluator) evaluate(ts int64, signals map[string]float64) {
+	for i := range e.states {
+		st := &e.states[i]
+		val, ok := signals[st.rule.SignalName]
+		if !ok {
+			continue
+		}
+		label := e.t.labels[st.rule.SignalName][val]
+		if i < len(e.t.converters) && e.t.converters[i] != nil {
+			val = e.t.converters[i](val)
+		}
+		inside := st.update(ts, val, label)
+		e.record(i, st, ts, inside)
+	}
+}
+
+// record 记录规则的超限区间
+func (e *ruleEvaluator) record(index int, st *ruleState, ts int64, inside bool) {
+	switch {
+	case !inside:
+		if st.current != nil {
+			st.current.ended = true
+			st.current = nil
+		}
+	case st.current != nil:
+		st.current.last = st.last
+		st.current.peak, st.current.peakTs, st.current.peakMargin = st.peak, st.peakTs, st.peakMargin
+	case st.confirmed(ts):
+		st.current = &exceedance{
+			rule: st.rule, index: index + 1, start: st.start, confirmed: ts, last: st.last,
+			peak: st.peak, peakTs: st.peakTs, peakMargin: st.peakMargin,
+		}
+		e.exceedances[st.rule.Name] = append(e.exceedances[st.rule.Name], st.current)
+		e.all = append(e.all, st.current)
+	}
+}
+
+// result 返回判定结论代码、描述和结构化结论，未触发时代码为0。
+// 未配置规则组时代码为最先确认触发的规则序号（从1开始），同时触发时取配置在前的规则；
+// 否则为首个满足的规则组（按配置顺序）的碰撞类型。结构化结论中包含全部规则的超限区间。
+func (e *ruleEvaluator) result() (int, string, *CrashVerdict) {
+	e.flush()
+	code, desc, group := 0, "", ""
+	if len(e.t.config.Groups) > 0 {
+		code, desc, group = e.groupResult()
+	} else if len(e.all) > 0 {
+		first := e.all[0]
+		for _, ex := range e.all[1:] {
+			if ex.confirmed == first.confirmed && ex.index < first.index {
+				first = ex
+			}
+		}
+		code, desc = first.index, first.describe()
+	}
+	return code, desc, newCrashVerdict(code, group, e.all)
+}
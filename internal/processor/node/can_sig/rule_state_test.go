@@ -0,0 +1,155 @@
+package can_sig
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleStateUpdate(t *testing.T) {
+	exit := 1.2
+	for _, tc := range []struct {
+		name      string
+		rule      SignalThreshold
+		values    []float64 // 从0开始每10ms一个样本
+		inside    []bool    // 每个样本之后是否处于超限区间
+		start     []int64   // 处于超限区间时区间的开始时间
+		confirmed []bool    // 每个样本之后是否满足持续时长
+	}{
+		{
+			name:      "无滞回时回到阈值以下即退出",
+			rule:      SignalThreshold{Threshold: 1.5},
+			values:    []float64{1.0, 1.6, 1.3, 1.6},
+			inside:    []bool{false, true, false, true},
+			start:     []int64{0, 10, 0, 30},
+			confirmed: []bool{false, true, false, true},
+		},
+		{
+			name:      "滞回: 高于阈值进入，低于退出阈值才退出，退出后须重新超过阈值",
+			rule:      SignalThreshold{Threshold: 1.5, ExitThreshold: &exit},
+			values:    []float64{1.0, 1.6, 1.3, 1.2, 1.1, 1.3, 1.6},
+			inside:    []bool{false, true, true, true, false, false, true},
+			start:     []int64{0, 10, 10, 10, 0, 0, 60},
+			confirmed: []bool{false, true, true, true, false, false, true},
+		},
+		{
+			name:      "滞回: abs> 按绝对值退出",
+			rule:      SignalThreshold{Operator: "abs>", Threshold: 1.5, ExitThreshold: &exit},
+			values:    []float64{-1.6, -1.3, 1.25, -1.1},
+			inside:    []bool{true, true, true, false},
+			start:     []int64{0, 0, 0, 0},
+			confirmed: []bool{true, true, true, false},
+		},
+		{
+			name:      "持续时长恰好达到时确认",
+			rule:      SignalThreshold{Threshold: 1.5, Duration: 20 * time.Millisecond},
+			values:    []float64{1.6, 1.6, 1.6, 1.6},
+			inside:    []bool{true, true, true, true},
+			start:     []int64{0, 0, 0, 0},
+			confirmed: []bool{false, false, true, true},
+		},
+		{
+			name:      "持续时长未达到时中断，重新计时",
+			rule:      SignalThreshold{Threshold: 1.5, Duration: 20 * time.Millisecond},
+			values:    []float64{1.6, 1.6, 1.0, 1.6, 1.6, 1.6},
+			inside:    []bool{true, true, false, true, true, true},
+			start:     []int64{0, 0, 0, 30, 30, 30},
+			confirmed: []bool{false, false, false, false, false, true},
+		},
+		{
+			name: "N-of-M: 旧的超限样本滑出窗口后区间从窗口内最早的超限样本重新开始",
+			rule: SignalThreshold{Threshold: 1.5, Samples: 2, SampleWindow: 3},
+			// 0、20、40、70 超限
+			values:    []float64{1.6, 1.0, 1.6, 1.0, 1.6, 1.0, 1.0, 1.6},
+			inside:    []bool{false, false, true, false, true, false, false, false},
+			start:     []int64{0, 0, 0, 0, 20, 0, 0, 0},
+			confirmed: []bool{false, false, true, false, true, false, false, false},
+		},
+		{
+			name:      "N-of-M 与持续时长组合: 时长从窗口内最早的超限样本算起",
+			rule:      SignalThreshold{Threshold: 1.5, Samples: 2, SampleWindow: 3, Duration: 30 * time.Millisecond},
+			values:    []float64{1.6, 1.0, 1.6, 1.6, 1.0, 1.6},
+			inside:    []bool{false, false, true, true, true, true},
+			start:     []int64{0, 0, 0, 0, 0, 0},
+			confirmed: []bool{false, false, false, true, true, true},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rule := tc.rule
+			rule.Name, rule.SignalName = "Rule", "Signal"
+			require.NoError(t, rule.validate(nil))
+			st := &ruleState{rule: &rule}
+			for i, v := range tc.values {
+				ts := int64(i * 10)
+				assert.Equal(t, tc.inside[i], st.update(ts, v, ""), "样本 %d", i)
+				assert.Equal(t, tc.confirmed[i], st.confirmed(ts), "样本 %d", i)
+				if tc.inside[i] {
+					assert.Equal(t, tc.start[i], st.start, "样本 %d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestExceedanceInterval(t *testing.T) {
+	trigger := newTestTrigger(t, `signals:
+  - name: Accel
+    signal_name: accel
+    threshold: 1.5
+    exit_threshold: 1.2
+    duration: 20ms
+`)
+	code, desc, verdict := evaluate(t, trigger, series("accel", 1000, 10,
+		1.0, 1.6, 1.7, 2.0, 1.3, 1.1, // 1010 进入，1030 确认，1040 仍在滞回范围内，1050 退出
+		1.6, 1.0, // 1060 只超限一个样本，未满足持续时长
+		1.8, 1.9, 1.8, // 1080 进入，数据结束时仍未退出
+	))
+	assert.Equal(t, 1, code)
+	assert.Contains(t, desc, "条件: 持续至少 20ms, 退出阈值 1.200000,")
+	assert.Contains(t, desc, "持续 30ms")
+	require.Len(t, verdict.Hits, 2)
+
+	first := verdict.Hits[0]
+	assert.Equal(t, int64(1010), first.FirstExceed)
+	assert.Equal(t, int64(1030), first.Confirmed)
+	assert.Equal(t, int64(1040), first.End)
+	assert.Equal(t, int64(30), first.Duration)
+	assert.True(t, first.Ended)
+	assert.Equal(t, 2.0, first.Peak)
+	assert.Equal(t, int64(1030), first.PeakTime)
+	assert.InDelta(t, 0.5, first.Margin, 1e-9)
+
+	last := verdict.Hits[1]
+	assert.Equal(t, int64(1080), last.FirstExceed)
+	assert.Equal(t, int64(1100), last.Confirmed)
+	assert.Equal(t, int64(1100), last.End)
+	assert.Equal(t, int64(20), last.Duration)
+	assert.False(t, last.Ended)
+	assert.Equal(t, int64(1090), last.PeakTime)
+}
+
+func TestEarliestConfirmedRule(t *testing.T) {
+	trigger := newTestTrigger(t, `signals:
+  - name: Slow
+    signal_name: a
+    threshold: 1
+    duration: 30ms
+  - name: Fast
+    signal_name: a
+    threshold: 2
+`)
+	// Slow 先超限但 Fast 先确认触发，判定结论取最先确认的规则
+	sigMap := series("a", 1000, 10, 1.5, 1.5, 2.5, 1.5)
+	code, _, verdict := evaluate(t, trigger, sigMap)
+	assert.Equal(t, 2, code)
+	require.Len(t, verdict.Hits, 2)
+	assert.Equal(t, "Fast", verdict.Hits[0].Rule)
+	assert.Equal(t, "Slow", verdict.Hits[1].Rule)
+
+	// 同时确认时取配置在前的规则
+	trigger.config.Signals[0].Duration = 0
+	code, _, _ = evaluate(t, trigger, series("a", 1000, 10, 2.5))
+	assert.Equal(t, 1, code)
+}
@@ -0,0 +1,266 @@
+package can_sig
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"AutoDataHub-monitor/pkg/utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 规则比较运算符
+const (
+	opGreater      = ">"
+	opGreaterEqual = ">="
+	opLess         = "<"
+	opLessEqual    = "<="
+	opEqual        = "=="
+	opNotEqual     = "!="
+	opAbsGreater   = "abs>"    // 绝对值超过阈值，如左右方向的转角或正负方向的加速度
+	opOutside      = "outside" // 超出 range 配置的 [min, max]
+	opIn           = "in"      // 取值属于 values 中的任一项
+)
+
+// SignalThreshold 定义了单个信号的触发规则
+type SignalThreshold struct {
+	Name           string    `yaml:"name"`            // 信号名称
+	SignalName     string    `yaml:"signal_name"`     // 信号 ID
+	Operator       string    `yaml:"operator"`        // 比较运算符，默认 >；配置 threshold_label 时默认 ==
+	Threshold      float64   `yaml:"threshold"`       // 信号阈值
+	ThresholdLabel string    `yaml:"threshold_label"` // 枚举信号的目标取值（DBC VAL_ 标签），配置后按标签比较，只能与 == 或 != 一起使用
+	Range          []float64 `yaml:"range"`           // outside 的取值范围 [min, max]
+	Values         []string  `yaml:"values"`          // in 的取值列表，数值或 DBC VAL_ 标签
+	Unit           string    `yaml:"unit"`            // 阈值的单位，与 DBC 中信号的单位不同时换算后比较，如 g、m/s^2、deg
+
+	// 持续和去抖条件，未配置时单个样本超限即触发
+	Duration      time.Duration `yaml:"duration"`       // 连续超限至少该时长才触发，如 20ms
+	Samples       int           `yaml:"samples"`        // 最近 sample_window 个样本中至少 samples 个超限才触发
+	SampleWindow  int           `yaml:"sample_window"`  // 统计超限次数的连续样本数
+	ExitThreshold *float64      `yaml:"exit_threshold"` // 滞回的退出阈值，进入超限后信号回到该阈值另一侧才退出，只能与 >, >=, <, <=, abs> 一起使用
+
+	inValues []float64 // values 中的数值
+	inLabels []string  // values 中的标签
+}
+
+// operator 返回规则实际使用的运算符
+func (s *SignalThreshold) operator() string {
+	switch {
+	case s.Operator != "":
+		return s.Operator
+	case s.ThresholdLabel != "":
+		return opEqual
+	default:
+		return opGreater
+	}
+}
+
+// validate 校验规则并解析 values，node 为规则在配置文件中的节点，用于给出行号
+func (s *SignalThreshold) validate(node *yaml.Node) error {
+	fail := func(field, format string, args ...any) error {
+		return fmt.Errorf("第%d行: 规则 %q: %s", yamlFieldLine(node, field), s.Name, fmt.Sprintf(format, args...))
+	}
+	if s.Name == "" || s.SignalName == "" {
+		return fail("name", "name 和 signal_name 不能为空")
+	}
+	op := s.operator()
+	switch op {
+	case opGreater, opGreaterEqual, opLess, opLessEqual, opEqual, opNotEqual, opAbsGreater, opOutside, opIn:
+	default:
+		return fail("operator", "未知的运算符 %q，支持 >, >=, <, <=, ==, !=, abs>, outside, in", s.Operator)
+	}
+	if s.ThresholdLabel != "" && op != opEqual && op != opNotEqual {
+		return fail("threshold_label", "threshold_label 只能与 == 或 != 一起使用")
+	}
+	if op == opAbsGreater && s.Threshold < 0 {
+		return fail("threshold", "abs> 的阈值不能为负数: %g", s.Threshold)
+	}
+	if (op == opOutside) != (s.Range != nil) {
+		return fail("range", "range 必须且只能与 outside 一起使用")
+	}
+	if op == opOutside && (len(s.Range) != 2 || s.Range[0] > s.Range[1]) {
+		return fail("range", "range 必须为 [min, max] 且 min 不大于 max: %v", s.Range)
+	}
+	if (op == opIn) != (s.Values != nil) {
+		return fail("values", "values 必须且只能与 in 一起使用")
+	}
+	if op == opIn && len(s.Values) == 0 {
+		return fail("values", "values 不能为空")
+	}
+	s.inValues, s.inLabels = nil, nil
+	for _, v := range s.Values {
+		if n, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			s.inValues = append(s.inValues, n)
+		} else {
+			s.inLabels = append(s.inLabels, v)
+		}
+	}
+	if s.Unit != "" && !utils.KnownUnit(s.Unit) {
+		return fail("unit", "未知单位 %q", s.Unit)
+	}
+	if s.Duration < 0 {
+		return fail("duration", "duration 不能为负数: %s", s.Duration)
+	}
+	if s.Samples < 0 || s.SampleWindow < 0 || (s.Samples > 0) != (s.SampleWindow > 0) || s.Samples > s.SampleWindow {
+		return fail("samples", "samples 和 sample_window 必须同时配置且 0 < samples <= sample_window: %d/%d", s.Samples, s.SampleWindow)
+	}
+	if s.ExitThreshold != nil {
+		exit := *s.ExitThreshold
+		switch op {
+		case opGreater, opGreaterEqual, opAbsGreater:
+			if exit > s.Threshold {
+				return fail("exit_threshold", "%s 的退出阈值不能大于阈值: %g > %g", op, exit, s.Threshold)
+			}
+		case opLess, opLessEqual:
+			if exit < s.Threshold {
+				return fail("exit_threshold", "%s 的退出阈值不能小于阈值: %g < %g", op, exit, s.Threshold)
+			}
+		default:
+			return fail("exit_threshold", "exit_threshold 只能与 >, >=, <, <=, abs> 一起使用")
+		}
+	}
+	return nil
+}
+
+// reached 判断信号值是否触发该规则。value 已换算为规则的单位，label 为换算前的值在 DBC 中的标签，没有标签时为空
+func (s *SignalThreshold) reached(value float64, label string) bool {
+	switch s.operator() {
+	case opGreater:
+		return value > s.Threshold
+	case opGreaterEqual:
+		return value >= s.Threshold
+	case opLess:
+		return value < s.Threshold
+	case opLessEqual:
+		return value <= s.Threshold
+	case opEqual:
+		if s.ThresholdLabel != "" {
+			return label == s.ThresholdLabel
+		}
+		return value == s.Threshold
+	case opNotEqual:
+		if s.ThresholdLabel != "" {
+			return label != s.ThresholdLabel
+		}
+		return value != s.Threshold
+	case opAbsGreater:
+		return math.Abs(value) > s.Threshold
+	case opOutside:
+		return value < s.Range[0] || value > s.Range[1]
+	case opIn:
+		return slices.Contains(s.inValues, value) || label != "" && slices.Contains(s.inLabels, label)
+	}
+	return false
+}
+
+// holding 判断已进入超限的信号是否仍未退出。配置了 exit_threshold 时信号越过退出阈值才退出，否则不再满足规则即退出
+func (s *SignalThreshold) holding(value float64, label string) bool {
+	if s.ExitThreshold == nil {
+		return s.reached(value, label)
+	}
+	exit := *s.ExitThreshold
+	switch s.operator() {
+	case opLess, opLessEqual:
+		return value <= exit
+	case opAbsGreater:
+		return math.Abs(value) >= exit
+	default:
+		return value >= exit
+	}
+}
+
+// margin 返回信号值超出触发条件的幅度，用于比较超限程度：>、< 等为与阈值之差，abs> 为绝对值与阈值之差，
+// outside 为超出范围的距离；==、!=、in 没有幅度，返回0。值未超限时为负数
+func (s *SignalThreshold) margin(value float64) float64 {
+	switch s.operator() {
+	case opGreater, opGreaterEqual:
+		return value - s.Threshold
+	case opLess, opLessEqual:
+		return s.Threshold - value
+	case opAbsGreater:
+		return math.Abs(value) - s.Threshold
+	case opOutside:
+		return max(s.Range[0]-value, value-s.Range[1])
+	}
+	return 0
+}
+
+// conditions 返回持续和去抖条件的描述，未配置时返回空字符串
+func (s *SignalThreshold) conditions() string {
+	var parts []string
+	if s.Duration > 0 {
+		parts = append(parts, fmt.Sprintf("持续至少 %s", s.Duration))
+	}
+	if s.SampleWindow > 0 {
+		parts = append(parts, fmt.Sprintf("连续 %d 个样本中至少 %d 个", s.SampleWindow, s.Samples))
+	}
+	if s.ExitThreshold != nil {
+		parts = append(parts, fmt.Sprintf("退出阈值 %f", *s.ExitThreshold))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// describe 返回规则触发时的日志描述
+func (s *SignalThreshold) describe() string {
+	unit := ""
+	if s.Unit != "" {
+		unit = " " + s.Unit
+	}
+	switch s.operator() {
+	case opGreaterEqual:
+		return fmt.Sprintf("信号 %s 达到阈值 %f%s,", s.Name, s.Threshold, unit)
+	case opLess:
+		return fmt.Sprintf("信号 %s 低于阈值 %f%s,", s.Name, s.Threshold, unit)
+	case opLessEqual:
+		return fmt.Sprintf("信号 %s 不高于阈值 %f%s,", s.Name, s.Threshold, unit)
+	case opEqual:
+		if s.ThresholdLabel != "" {
+			return fmt.Sprintf("信号 %s 取值为 %s,", s.Name, s.ThresholdLabel)
+		}
+		return fmt.Sprintf("信号 %s 等于 %f%s,", s.Name, s.Threshold, unit)
+	case opNotEqual:
+		if s.ThresholdLabel != "" {
+			return fmt.Sprintf("信号 %s 取值不为 %s,", s.Name, s.ThresholdLabel)
+		}
+		return fmt.Sprintf("信号 %s 不等于 %f%s,", s.Name, s.Threshold, unit)
+	case opAbsGreater:
+		return fmt.Sprintf("信号 %s 绝对值超过阈值 %f%s,", s.Name, s.Threshold, unit)
+	case opOutside:
+		return fmt.Sprintf("信号 %s 超出范围 [%f, %f]%s,", s.Name, s.Range[0], s.Range[1], unit)
+	case opIn:
+		return fmt.Sprintf("信号 %s 取值属于 {%s},", s.Name, strings.Join(s.Values, ", "))
+	default:
+		return fmt.Sprintf("信号 %s 超过阈值 %f%s,", s.Name, s.Threshold, unit)
+	}
+}
+
+// yamlMappingValue 返回映射节点中 key 对应的值节点，不存在时返回 nil
+func yamlMappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node != nil && node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// yamlFieldLine 返回映射节点中某个字段所在的行，字段不存在时返回节点本身的行
+func yamlFieldLine(node *yaml.Node, key string) int {
+	if v := yamlMappingValue(node, key); v != nil {
+		return v.Line
+	}
+	if node == nil {
+		return 0
+	}
+	return node.Line
+}
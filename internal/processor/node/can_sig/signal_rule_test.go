@@ -0,0 +1,336 @@
+package can_sig
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"AutoDataHub-monitor/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadTestConfig 把配置写入临时文件后按正式流程加载和校验
+func loadTestConfig(t *testing.T, config string) (*CanSignalConfig, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "can_sig.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o644))
+	return loadCanSignalConfig(path)
+}
+
+// newTestTrigger 按配置创建判定器，不需要下载地址和车型 DBC
+func newTestTrigger(t *testing.T, config string) *TriggeFileFromClient {
+	t.Helper()
+	cfg, err := loadTestConfig(t, config)
+	require.NoError(t, err)
+	return &TriggeFileFromClient{config: cfg}
+}
+
+// evaluate 按时间顺序判断样本，返回判定结论代码、描述和结构化结论
+func evaluate(t *testing.T, trigger *TriggeFileFromClient, sigMap map[int64]map[string]float64) (int, string, *CrashVerdict) {
+	t.Helper()
+	tsList := make([]int64, 0, len(sigMap))
+	for ts := range sigMap {
+		tsList = append(tsList, ts)
+	}
+	sort.Slice(tsList, func(i, j int) bool { return tsList[i] < tsList[j] })
+	code, desc, verdict, err := trigger.IsSignalsReachesThreshold(sigMap, tsList)
+	require.NoError(t, err)
+	return code, desc, verdict
+}
+
+// series 生成单个信号从 start 开始每 step 毫秒一个值的样本
+func series(signal string, start, step int64, values ...float64) map[int64]map[string]float64 {
+	sigMap := make(map[int64]map[string]float64, len(values))
+	for i, v := range values {
+		sigMap[start+int64(i)*step] = map[string]float64{signal: v}
+	}
+	return sigMap
+}
+
+func TestSignalThresholdReached(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		rule  SignalThreshold
+		value float64
+		label string
+		want  bool
+	}{
+		{"默认运算符为 >", SignalThreshold{Threshold: 1.5}, 1.6, "", true},
+		{"> 不含阈值", SignalThreshold{Threshold: 1.5}, 1.5, "", false},
+		{">= 含阈值", SignalThreshold{Operator: ">=", Threshold: 1.5}, 1.5, "", true},
+		{">= 低于阈值", SignalThreshold{Operator: ">=", Threshold: 1.5}, 1.4, "", false},
+		{"< 低于阈值", SignalThreshold{Operator: "<", Threshold: 10}, 9, "", true},
+		{"< 不含阈值", SignalThreshold{Operator: "<", Threshold: 10}, 10, "", false},
+		{"<= 含阈值", SignalThreshold{Operator: "<=", Threshold: 10}, 10, "", true},
+		{"<= 高于阈值", SignalThreshold{Operator: "<=", Threshold: 10}, 10.1, "", false},
+		{"== 相等", SignalThreshold{Operator: "==", Threshold: 1}, 1, "", true},
+		{"== 不等", SignalThreshold{Operator: "==", Threshold: 1}, 0, "", false},
+		{"!= 不等", SignalThreshold{Operator: "!=", Threshold: 1}, 0, "", true},
+		{"!= 相等", SignalThreshold{Operator: "!=", Threshold: 1}, 1, "", false},
+		{"threshold_label 默认按 == 比较标签", SignalThreshold{ThresholdLabel: "Deployed"}, 2, "Deployed", true},
+		{"threshold_label 标签不同", SignalThreshold{ThresholdLabel: "Deployed"}, 1, "Ready", false},
+		{"threshold_label 与 !=", SignalThreshold{Operator: "!=", ThresholdLabel: "Ready"}, 2, "Deployed", true},
+		{"abs> 正方向", SignalThreshold{Operator: "abs>", Threshold: 0.8}, 0.9, "", true},
+		{"abs> 负方向", SignalThreshold{Operator: "abs>", Threshold: 0.8}, -0.9, "", true},
+		{"abs> 未超过", SignalThreshold{Operator: "abs>", Threshold: 0.8}, -0.8, "", false},
+		{"outside 低于范围", SignalThreshold{Operator: "outside", Range: []float64{-2, 2}}, -2.1, "", true},
+		{"outside 高于范围", SignalThreshold{Operator: "outside", Range: []float64{-2, 2}}, 2.1, "", true},
+		{"outside 边界在范围内", SignalThreshold{Operator: "outside", Range: []float64{-2, 2}}, 2, "", false},
+		{"in 数值", SignalThreshold{Operator: "in", Values: []string{"3", " 5 "}}, 5, "", true},
+		{"in 数值不在列表中", SignalThreshold{Operator: "in", Values: []string{"3", "5"}}, 4, "", false},
+		{"in 标签", SignalThreshold{Operator: "in", Values: []string{"3", "Fault"}}, 7, "Fault", true},
+		{"in 没有标签时不匹配标签项", SignalThreshold{Operator: "in", Values: []string{"Fault"}}, 7, "", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rule := tc.rule
+			rule.Name, rule.SignalName = "Rule", "Signal"
+			require.NoError(t, rule.validate(nil))
+			assert.Equal(t, tc.want, rule.reached(tc.value, tc.label))
+		})
+	}
+}
+
+func TestSignalThresholdMargin(t *testing.T) {
+	margin := func(rule SignalThreshold, value float64) float64 {
+		rule.Name, rule.SignalName = "Rule", "Signal"
+		require.NoError(t, rule.validate(nil))
+		return rule.margin(value)
+	}
+	assert.InDelta(t, 0.5, margin(SignalThreshold{Threshold: 1.5}, 2), 1e-9)
+	assert.InDelta(t, 3, margin(SignalThreshold{Operator: "<", Threshold: 10}, 7), 1e-9)
+	assert.InDelta(t, 0.4, margin(SignalThreshold{Operator: "abs>", Threshold: 0.8}, -1.2), 1e-9)
+	assert.InDelta(t, 1, margin(SignalThreshold{Operator: "outside", Range: []float64{-2, 2}}, -3), 1e-9)
+	assert.InDelta(t, -1, margin(SignalThreshold{Operator: "outside", Range: []float64{-2, 2}}, 1), 1e-9)
+	assert.Zero(t, margin(SignalThreshold{Operator: "in", Values: []string{"1"}}, 1))
+}
+
+func TestLoadCanSignalConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{"名称为空", `signals:
+  - signal_name: a
+    threshold: 1
+`, `第2行: 规则 "": name 和 signal_name 不能为空`},
+		{"未知运算符", `signals:
+  - name: A
+    signal_name: a
+    operator: "=~"
+`, `第4行: 规则 "A": 未知的运算符 "=~"`},
+		{"threshold_label 与 >", `signals:
+  - name: A
+    signal_name: a
+    operator: ">"
+    threshold_label: Deployed
+`, `第5行: 规则 "A": threshold_label 只能与 == 或 != 一起使用`},
+		{"abs> 负阈值", `signals:
+  - name: A
+    signal_name: a
+    operator: abs>
+    threshold: -1
+`, `第5行: 规则 "A": abs> 的阈值不能为负数: -1`},
+		{"outside 缺少 range", `signals:
+  - name: A
+    signal_name: a
+    operator: outside
+`, `第2行: 规则 "A": range 必须且只能与 outside 一起使用`},
+		{"range 上下限颠倒", `signals:
+  - name: A
+    signal_name: a
+    operator: outside
+    range: [3, 1]
+`, `第5行: 规则 "A": range 必须为 [min, max] 且 min 不大于 max: [3 1]`},
+		{"values 缺少 in", `signals:
+  - name: A
+    signal_name: a
+    values: [1, 2]
+`, `第4行: 规则 "A": values 必须且只能与 in 一起使用`},
+		{"in 的 values 为空", `signals:
+  - name: A
+    signal_name: a
+    operator: in
+    values: []
+`, `第5行: 规则 "A": values 不能为空`},
+		{"未知单位", `signals:
+  - name: A
+    signal_name: a
+    threshold: 1
+    unit: furlong
+`, `第5行: 规则 "A": 未知单位 "furlong"`},
+		{"samples 超过 sample_window", `signals:
+  - name: A
+    signal_name: a
+    samples: 3
+    sample_window: 2
+`, `第4行: 规则 "A": samples 和 sample_window 必须同时配置且 0 < samples <= sample_window: 3/2`},
+		{"退出阈值高于阈值", `signals:
+  - name: A
+    signal_name: a
+    threshold: 1.5
+    exit_threshold: 2
+`, `第5行: 规则 "A": > 的退出阈值不能大于阈值: 2 > 1.5`},
+		{"退出阈值与 ==", `signals:
+  - name: A
+    signal_name: a
+    operator: "=="
+    exit_threshold: 1
+`, `第5行: 规则 "A": exit_threshold 只能与 >, >=, <, <=, abs> 一起使用`},
+		{"第二个规则的行号", `signals:
+  - name: A
+    signal_name: a
+    threshold: 1
+  - name: B
+    signal_name: b
+    operator: outside
+    range: [1]
+`, `第8行: 规则 "B": range 必须为 [min, max]`},
+		{"cfc 未配置评估窗口", `signals:
+  - name: A
+    signal_name: Filtered
+    threshold: 1
+derived:
+  - name: Filtered
+    type: cfc
+    source: a
+    class: 60
+resample:
+  period: 1ms
+`, `cfc 滤波需要配置评估窗口 window`},
+		{"拼写错误的字段", `signals:
+  - name: A
+    signal_name: a
+    threshhold: 1
+`, `line 4: field threshhold not found`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTestConfig(t, tc.config)
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+}
+
+func TestLoadCanSignalConfigDefaults(t *testing.T) {
+	cfg, err := loadTestConfig(t, `signals:
+  - name: A
+    signal_name: a
+    threshold: 1
+resample:
+  method: linear
+`)
+	require.NoError(t, err)
+	// 未配置的字段保持代码中的默认值
+	assert.Equal(t, utils.CANParsePolicy{Mode: utils.CANParseThreshold, MaxErrorRate: 0.2}, cfg.ParsePolicy)
+	assert.Equal(t, utils.CANResamplePolicy{Period: 10 * time.Millisecond, Method: utils.CANResampleLinear, MaxStaleness: 100 * time.Millisecond}, cfg.Resample)
+	assert.Equal(t, utils.CANBusHealthPolicy{}, cfg.BusHealth)
+}
+
+func TestLoadShippedConfigs(t *testing.T) {
+	paths, err := filepath.Glob("../../../../configs/can_sig_*.yaml")
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+	for _, path := range paths {
+		cfg, err := loadCanSignalConfig(path)
+		require.NoError(t, err, path)
+		assert.NotEmpty(t, cfg.Signals, path)
+	}
+}
+
+func TestDerivedCFCRule(t *testing.T) {
+	trigger := newTestTrigger(t, `signals:
+  - name: Filtered
+    signal_name: Filtered
+    threshold: 5
+derived:
+  - name: Filtered
+    type: cfc
+    source: accel
+    class: 60
+resample:
+  period: 1ms
+window:
+  pre_trigger: 1s
+  post_trigger: 1s
+`)
+	// 1100ms 处的对称脉冲，正反两次滤波后超限区间仍以脉冲中心对称，没有相位滞后
+	sigMap := make(map[int64]map[string]float64)
+	for ts := int64(1000); ts <= 1200; ts++ {
+		sigMap[ts] = map[string]float64{"accel": max(0, 20-math.Abs(float64(ts-1100)))}
+	}
+	code, _, verdict := evaluate(t, trigger, sigMap)
+	require.Equal(t, 1, code)
+	require.Len(t, verdict.Hits, 1)
+	hit := verdict.Hits[0]
+	assert.Less(t, hit.FirstExceed, int64(1100))
+	assert.Equal(t, int64(1100)-hit.FirstExceed, hit.End-int64(1100))
+	assert.Equal(t, int64(1100), hit.PeakTime)
+}
+
+func TestUnitConversion(t *testing.T) {
+	trigger := newTestTrigger(t, `signals:
+  - name: Accel
+    signal_name: accel
+    threshold: 1.5
+    unit: g
+  - name: Speed
+    signal_name: speed
+    operator: ">="
+    threshold: 100
+    unit: km/h
+`)
+	// DBC 中加速度以 m/s^2、车速以 m/s 标注，比较前换算为规则的单位
+	converters, err := trigger.unitConverters(map[string]string{"accel": "m/s^2", "speed": "m/s"})
+	require.NoError(t, err)
+	trigger.converters = converters
+
+	// 14.7 m/s^2 约 1.499g，不触发
+	code, _, _ := evaluate(t, trigger, series("accel", 1000, 10, 14.7))
+	assert.Zero(t, code)
+	code, desc, verdict := evaluate(t, trigger, series("accel", 1000, 10, 14.7, 19.6))
+	assert.Equal(t, 1, code)
+	assert.Contains(t, desc, "信号 Accel 超过阈值 1.500000 g")
+	require.Len(t, verdict.Hits, 1)
+	assert.InDelta(t, 19.6/9.80665, verdict.Hits[0].Peak, 1e-9)
+	assert.Equal(t, "g", verdict.Hits[0].Unit)
+
+	// 27.78 m/s 为 100.008 km/h
+	code, _, _ = evaluate(t, trigger, series("speed", 1000, 10, 27.7, 27.78))
+	assert.Equal(t, 2, code)
+
+	// DBC 未标注单位或单位相同时不换算
+	converters, err = trigger.unitConverters(map[string]string{"accel": "G"})
+	require.NoError(t, err)
+	assert.Nil(t, converters[0])
+	assert.Nil(t, converters[1])
+
+	_, err = trigger.unitConverters(map[string]string{"accel": "km/h"})
+	assert.ErrorContains(t, err, "规则 Accel 的单位与 DBC 不一致")
+}
+
+func TestValueLabels(t *testing.T) {
+	trigger := newTestTrigger(t, `signals:
+  - name: Airbag
+    signal_name: airbag
+    threshold_label: Deployed
+  - name: Fault
+    signal_name: airbag
+    operator: in
+    values: [Fault, 7]
+`)
+	trigger.labels = map[string]map[float64]string{"airbag": {0: "Ready", 1: "Deployed", 2: "Fault"}}
+
+	code, desc, _ := evaluate(t, trigger, series("airbag", 1000, 10, 0, 1))
+	assert.Equal(t, 1, code)
+	assert.Contains(t, desc, "信号 Airbag 取值为 Deployed")
+	code, desc, _ = evaluate(t, trigger, series("airbag", 1000, 10, 0, 2))
+	assert.Equal(t, 2, code)
+	assert.Contains(t, desc, "信号 Fault 取值属于 {Fault, 7}")
+	code, _, _ = evaluate(t, trigger, series("airbag", 1000, 10, 0, 7))
+	assert.Equal(t, 2, code)
+}
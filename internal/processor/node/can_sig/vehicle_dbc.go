@@ -0,0 +1,125 @@
+package can_sig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"AutoDataHub-monitor/pkg/utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+// vehicleDBCPath 车型与 DBC 映射配置文件
+const vehicleDBCPath = "./configs/vehicle_dbc.yaml"
+
+// VehicleDBCConfig 定义了 vehicle_dbc.yaml 文件的结构
+type VehicleDBCConfig struct {
+	Default  VehicleDBC   `yaml:"default"`  // 未匹配到车型时使用的 DBC
+	Vehicles []VehicleDBC `yaml:"vehicles"` // 各车型的 DBC
+}
+
+// VehicleDBC 定义了单个车型（可按年款区分）使用的 DBC 文件和逻辑信号别名
+type VehicleDBC struct {
+	CarType     string                       `yaml:"car_type"`    // 车辆类型，对应 NegativeTriggerData.CarType
+	ModelYears  []int                        `yaml:"model_years"` // 适用年款，为空表示所有年款
+	DBC         []DBCFileConfig              `yaml:"dbc"`         // DBC 文件列表
+	Aliases     map[string]SignalAliasConfig `yaml:"aliases"`     // 逻辑信号名 -> 实际信号
+	E2E         []utils.E2EMessageConfig     `yaml:"e2e"`         // 报文 E2E 保护配置，覆盖 DBC 属性
+	Diagnostics []utils.DiagnosticPair       `yaml:"diagnostics"` // 诊断请求/响应 ID，用于提取 UDS/OBD-II 故障码
+}
+
+// DBCFileConfig 定义了一个 DBC 文件及其所在总线
+type DBCFileConfig struct {
+	Path    string `yaml:"path"`    // DBC 文件路径
+	Channel int    `yaml:"channel"` // 总线通道，0 表示所有通道
+}
+
+// SignalAliasConfig 定义了逻辑信号在某个平台上的实际信号名和总线
+type SignalAliasConfig struct {
+	Signal  string `yaml:"signal"`  // DBC 中的实际信号名
+	Channel int    `yaml:"channel"` // 总线通道，0 表示不限定
+}
+
+// loadVehicleDBCConfig 加载车型 DBC 映射，配置文件不存在时使用默认 DBC
+func loadVehicleDBCConfig(path string) (*VehicleDBCConfig, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &VehicleDBCConfig{Default: VehicleDBC{DBC: []DBCFileConfig{{Path: signalDBCPath}}}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取车型 DBC 配置文件失败 '%s': %w", path, err)
+	}
+
+	var cfg VehicleDBCConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("解析车型 DBC YAML 配置失败: %w", err)
+	}
+	return &cfg, nil
+}
+
+// needsModelYear 判断该车型是否按年款区分 DBC
+func (c *VehicleDBCConfig) needsModelYear(carType string) bool {
+	for _, v := range c.Vehicles {
+		if v.CarType == carType && len(v.ModelYears) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup 按车型和年款查找 DBC 配置：年款精确匹配优先，其次是不限年款的同车型配置，最后使用默认配置。
+// modelYear 为0表示年款未知。
+func (c *VehicleDBCConfig) Lookup(carType string, modelYear int) (*VehicleDBC, error) {
+	var fallback *VehicleDBC
+	for i := range c.Vehicles {
+		v := &c.Vehicles[i]
+		if v.CarType != carType {
+			continue
+		}
+		if len(v.ModelYears) == 0 {
+			if fallback == nil {
+				fallback = v
+			}
+			continue
+		}
+		if slices.Contains(v.ModelYears, modelYear) {
+			return v, nil
+		}
+	}
+	if fallback != nil {
+		return fallback, nil
+	}
+	if len(c.Default.DBC) > 0 {
+		return &c.Default, nil
+	}
+	return nil, fmt.Errorf("车型 %s（年款 %d）未配置 DBC", carType, modelYear)
+}
+
+// NewDecoder 使用共享的 DBC 注册表为该车型创建解码器
+func (v *VehicleDBC) NewDecoder(registry *utils.DBCRegistry, signals []string) (*utils.CANDecoder, error) {
+	bindings := make([]utils.DBCBinding, 0, len(v.DBC))
+	for _, f := range v.DBC {
+		db, err := registry.Get(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, utils.DBCBinding{Channel: f.Channel, DBC: db})
+	}
+	aliases := make(map[string]utils.SignalAlias, len(v.Aliases))
+	for name, alias := range v.Aliases {
+		aliases[name] = utils.SignalAlias{Signal: alias.Signal, Channel: alias.Channel}
+	}
+	decoder, err := utils.NewCANDecoder(bindings, signals, aliases)
+	if err != nil {
+		return nil, err
+	}
+	if err := decoder.SetE2EConfig(v.E2E); err != nil {
+		return nil, fmt.Errorf("车型 %s E2E 配置错误: %w", v.CarType, err)
+	}
+	if err := decoder.SetDiagnostics(v.Diagnostics); err != nil {
+		return nil, fmt.Errorf("车型 %s 诊断配置错误: %w", v.CarType, err)
+	}
+	return decoder, nil
+}
@@ -0,0 +1,92 @@
+package can_sig
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"AutoDataHub-monitor/pkg/models"
+)
+
+// maxVerdictHits 结构化结论中最多保留的规则命中数，按确认触发的先后取最早的
+const maxVerdictHits = 100
+
+// CrashVerdict 结构化的判定结论，随 IsCrash 代码一起入库
+type CrashVerdict struct {
+	Code      int       `json:"code"`                // 判定结论代码，与 IsCrash 相同
+	Reason    string    `json:"reason"`              // 代码对应的描述
+	Group     string    `json:"group,omitempty"`     // 满足的规则组名称
+	Hits      []RuleHit `json:"hits"`                // 评估范围内全部规则命中，按确认触发的先后排列
+	Truncated bool      `json:"truncated,omitempty"` // 命中数超过上限，只保留了最早的部分
+}
+
+// RuleHit 规则的一次命中，即一个确认触发的超限区间。时间均为 Unix 毫秒
+type RuleHit struct {
+	Rule        string   `json:"rule"`                // 规则名称
+	Index       int      `json:"index"`               // 规则序号，从1开始
+	Signal      string   `json:"signal"`              // 信号名称
+	Operator    string   `json:"operator"`            // 比较运算符
+	Threshold   *float64 `json:"threshold,omitempty"` // 阈值，outside 和 in 等不按阈值比较的规则为空
+	Unit        string   `json:"unit,omitempty"`      // 阈值、峰值和超出幅度的单位
+	FirstExceed int64    `json:"first_exceed"`        // 超限开始时间
+	Confirmed   int64    `json:"confirmed"`           // 满足持续和去抖条件的时间
+	End         int64    `json:"end"`                 // 最后一个超限样本的时间
+	Duration    int64    `json:"duration_ms"`         // 超限持续时长（毫秒）
+	Ended       bool     `json:"ended"`               // 为 false 时数据结束时仍在超限
+	Peak        float64  `json:"peak"`                // 区间内超出触发条件最多的值
+	PeakTime    int64    `json:"peak_time"`           // 峰值出现的时间
+	Margin      float64  `json:"margin"`              // 峰值超出阈值或范围的幅度，==、!=、in 为0
+}
+
+// newCrashVerdict 由判定结论代码和全部超限区间生成结构化结论
+func newCrashVerdict(code int, group string, exceedances []*exceedance) *CrashVerdict {
+	v := &CrashVerdict{Code: code, Reason: models.CrashInfoMap[code], Group: group, Hits: []RuleHit{}}
+	if len(exceedances) > maxVerdictHits {
+		exceedances, v.Truncated = exceedances[:maxVerdictHits], true
+	}
+	for _, ex := range exceedances {
+		hit := RuleHit{
+			Rule:        ex.rule.Name,
+			Index:       ex.index,
+			Signal:      ex.rule.SignalName,
+			Operator:    ex.rule.operator(),
+			Unit:        ex.rule.Unit,
+			FirstExceed: ex.start,
+			Confirmed:   ex.confirmed,
+			End:         ex.last,
+			Duration:    ex.last - ex.start,
+			Ended:       ex.ended,
+			Peak:        ex.peak,
+			PeakTime:    ex.peakTs,
+			Margin:      ex.peakMargin,
+		}
+		switch hit.Operator {
+		case opGreater, opGreaterEqual, opLess, opLessEqual, opAbsGreater:
+			threshold := ex.rule.Threshold
+			hit.Threshold = &threshold
+		case opEqual, opNotEqual:
+			if ex.rule.ThresholdLabel == "" {
+				threshold := ex.rule.Threshold
+				hit.Threshold = &threshold
+			}
+		}
+		v.Hits = append(v.Hits, hit)
+	}
+	return v
+}
+
+// encodeVerdict 把结构化结论序列化为 JSON 随判定结论入库，失败时返回空字符串
+func encodeVerdict(v *CrashVerdict) string {
+	if v == nil {
+		return ""
+	}
+	// 运算符中的 < > 保持原样，便于直接查看数据库中的结论
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		logger.Sugar().Errorf("序列化判定结论失败: %v", err)
+		return ""
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,79 @@
+package can_sig
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeVerdict(t *testing.T) {
+	trigger := newTestTrigger(t, `signals:
+  - name: Accel
+    signal_name: accel
+    operator: abs>
+    threshold: 1.5
+    unit: g
+    duration: 20ms
+    exit_threshold: 1.2
+  - name: Airbag
+    signal_name: airbag
+    operator: ==
+    threshold: 1
+  - name: Speed
+    signal_name: speed
+    operator: outside
+    range: [0, 100]
+groups:
+  - name: Frontal
+    category: 正面碰撞
+    all:
+      - rule: Accel
+      - rule: Airbag
+        within: 100ms
+`)
+	code, _, verdict := evaluate(t, trigger, map[int64]map[string]float64{
+		1000: {"accel": -1.0},
+		1010: {"accel": -1.6}, // 进入超限
+		1020: {"accel": -2.0}, // 峰值
+		1030: {"accel": -1.7}, // 满足持续时长，确认触发
+		1040: {"accel": -1.1, "airbag": 1},
+		1050: {"speed": 120},
+		1060: {"speed": 50},
+	})
+	require.Equal(t, 5, code)
+	// 按确认触发的先后排列；outside 没有阈值；数据结束时气囊信号仍未退出
+	assert.Equal(t, `{"code":5,"reason":"正面碰撞","group":"Frontal","hits":[`+
+		`{"rule":"Accel","index":1,"signal":"accel","operator":"abs>","threshold":1.5,"unit":"g","first_exceed":1010,"confirmed":1030,"end":1030,"duration_ms":20,"ended":true,"peak":-2,"peak_time":1020,"margin":0.5},`+
+		`{"rule":"Airbag","index":2,"signal":"airbag","operator":"==","threshold":1,"first_exceed":1040,"confirmed":1040,"end":1040,"duration_ms":0,"ended":false,"peak":1,"peak_time":1040,"margin":0},`+
+		`{"rule":"Speed","index":3,"signal":"speed","operator":"outside","first_exceed":1050,"confirmed":1050,"end":1050,"duration_ms":0,"ended":true,"peak":120,"peak_time":1050,"margin":20}]}`,
+		encodeVerdict(verdict))
+
+	// 未触发时 hits 为空数组而不是 null
+	code, _, verdict = evaluate(t, trigger, series("accel", 1000, 10, 1.0))
+	require.Zero(t, code)
+	assert.Equal(t, `{"code":0,"reason":"`+verdict.Reason+`","hits":[]}`, encodeVerdict(verdict))
+	assert.Empty(t, encodeVerdict(nil))
+}
+
+func TestVerdictTruncated(t *testing.T) {
+	trigger := newTestTrigger(t, `signals:
+  - name: Accel
+    signal_name: accel
+    threshold: 1.5
+`)
+	values := make([]float64, 0, 2*(maxVerdictHits+1))
+	for i := 0; i <= maxVerdictHits; i++ {
+		values = append(values, 2, 1)
+	}
+	_, _, verdict := evaluate(t, trigger, series("accel", 1000, 10, values...))
+	assert.True(t, verdict.Truncated)
+	require.Len(t, verdict.Hits, maxVerdictHits)
+	// 保留最早的命中
+	assert.Equal(t, int64(1000), verdict.Hits[0].FirstExceed)
+
+	var decoded CrashVerdict
+	require.NoError(t, json.Unmarshal([]byte(encodeVerdict(verdict)), &decoded))
+	assert.True(t, decoded.Truncated)
+}
@@ -98,7 +98,9 @@ func (n *WriteDBNode) handleMessage(msgBody []byte) {
 		TriggerID:         dataLog.TriggerID,
 		IsCrash:           dataLog.IsCrash,
 		CrashReason:       models.CrashInfoMap[dataLog.IsCrash],
-		CriterionJudgment: dataLog.ThresholdLog,
+		CriterionJudgment: models.TruncateCriterionJudgment(dataLog.ThresholdLog),
+		DTCs:              dataLog.DTCs,
+		Verdict:           dataLog.Verdict,
 	}
 
 	// 将数据写入数据库
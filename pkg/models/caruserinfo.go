@@ -17,6 +17,7 @@ type CarUserInfo struct {
 	NowerName   string    `gorm:"column:nower_name;type:varchar(255);default:none" json:"nower_name"`
 	Priority    int       `gorm:"column:priority;type:int(11)" json:"priority"`
 	ProjectName string    `gorm:"column:project_name;type:varchar(255)" json:"project_name"`
+	ModelYear   int       `gorm:"column:model_year;type:int(11)" json:"model_year"`
 }
 
 func (m *CarUserInfo) TableName() string {
@@ -29,4 +30,13 @@ func FindUseTypeOfVinAndTime(db *gorm.DB, vin string, dateTime string) (data Car
 	Where("vin = ? and CreateAt <= ?",vin,dateTime).
 	First(&data).Error
 	return
-}
\ No newline at end of file
+}
+
+// FindCarUserInfoByVin 查询车辆最新的用户信息
+func FindCarUserInfoByVin(db *gorm.DB, vin string) (data CarUserInfo, err error) {
+	err = db.Table("car_user_info").
+		Where("vin = ?", vin).
+		Order("id desc").
+		First(&data).Error
+	return
+}
@@ -4,6 +4,12 @@ import (
 	"time"
 )
 
+// criterionJudgmentMaxLen criterion_judgment 列的最大字符数，与 varchar(2000) 一致
+const criterionJudgmentMaxLen = 2000
+
+// criterionJudgmentTruncated 判定描述超长截断时追加的说明
+const criterionJudgmentTruncated = "...（已截断，完整结论见 verdict）"
+
 // Datalog 表示数据日志的结构体
 type DataLogs struct {
 	ID                int       `gorm:"column:id;type:smallint(6);primary_key;AUTO_INCREMENT" json:"id"`
@@ -17,8 +23,21 @@ type DataLogs struct {
 	IsCrash           int       `gorm:"column:is_crash;type:int(11);NOT NULL" json:"is_crash"`
 	CrashReason       string    `gorm:"column:crash_reason;type:varchar(2000);NOT NULL" json:"crash_reason"`
 	CriterionJudgment string    `gorm:"column:criterion_judgment;type:varchar(2000);NOT NULL" json:"criterion_judgment"`
+	DTCs              string    `gorm:"column:dtcs;type:text" json:"dtcs"`       // 诊断故障码（JSON）
+	Verdict           string    `gorm:"column:verdict;type:text" json:"verdict"` // 结构化判定结论（JSON），is_crash 仍为判定结论代码
 }
 
 func (m *DataLogs) TableName() string {
 	return "data_logs"
 }
+
+// TruncateCriterionJudgment 把判定描述截断到 criterion_judgment 列的长度以内，按字符截断不拆分汉字。
+// 规则命中较多时描述可能超长，完整的命中记录在 verdict 列中
+func TruncateCriterionJudgment(s string) string {
+	runes := []rune(s)
+	if len(runes) <= criterionJudgmentMaxLen {
+		return s
+	}
+	keep := criterionJudgmentMaxLen - len([]rune(criterionJudgmentTruncated))
+	return string(runes[:keep]) + criterionJudgmentTruncated
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncateCriterionJudgment(t *testing.T) {
+	short := strings.Repeat("超", criterionJudgmentMaxLen)
+	assert.Equal(t, short, TruncateCriterionJudgment(short))
+
+	long := strings.Repeat("超限", criterionJudgmentMaxLen)
+	got := TruncateCriterionJudgment(long)
+	assert.Equal(t, criterionJudgmentMaxLen, utf8.RuneCountInString(got))
+	assert.True(t, utf8.ValidString(got))
+	assert.True(t, strings.HasSuffix(got, criterionJudgmentTruncated))
+	assert.True(t, strings.HasPrefix(long, strings.TrimSuffix(got, criterionJudgmentTruncated)))
+}
@@ -22,6 +22,7 @@ type ProcessLogs struct {
 	TriggerID        string    `gorm:"column:trigger_id;type:varchar(255);NOT NULL" json:"trigger_id"`
 	ProcessStatus    string    `gorm:"column:process_status;type:varchar(50);NOT NULL" json:"process_status"`
 	ProcessLog       string    `gorm:"column:process_log;type:varchar(2000);NOT NULL" json:"process_log"`
+	ParseReport      string    `gorm:"column:parse_report;type:text" json:"parse_report"` // CAN 日志解析报告（JSON）
 }
 
 func (m *ProcessLogs) TableName() string {
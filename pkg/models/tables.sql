@@ -9,6 +9,7 @@ CREATE TABLE process_logs (
     trigger_id VARCHAR(255) NOT NULL,
     process_status VARCHAR(50) NOT NULL,
     process_log VARCHAR(2000) NOT NULL,
+    parse_report TEXT,
     
     INDEX idx_vin (vin),
     INDEX idx_vin_trigger (vin, trigger_timestamp),
@@ -28,6 +29,8 @@ CREATE TABLE data_logs (
     is_crash INT NOT NULL,
     crash_reason VARCHAR(2000) NOT NULL,
     criterion_judgment VARCHAR(2000) NOT NULL,
+    dtcs TEXT,
+    verdict TEXT,
 
     INDEX idx_vin (vin),
     INDEX idx_vin_trigger (vin, trigger_timestamp),
@@ -46,6 +49,7 @@ CREATE TABLE car_user_info (
 	`nower_name` VARCHAR(255) DEFAULT 'none',
 	`priority` INTEGER,
 	`project_name` VARCHAR(255),
+	`model_year` INTEGER,
 	PRIMARY KEY(`id`),
 	INDEX idx_vin (vin),
 	INDEX idx_project (project_name)
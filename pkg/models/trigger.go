@@ -11,28 +11,55 @@ import (
 	"go.uber.org/zap"
 )
 
+// 无法按规则判定碰撞时的结论，取负值以区别于规则序号
+const (
+	// CrashSensorFault 判定所用信号出现超范围、无效值或饱和等传感器故障，且没有有效信号触发规则，无法判定是否碰撞
+	CrashSensorFault = -1
+	// CrashBusAnomaly 报文周期中断、丢帧或总线负载过高，ECU 可能在触发前掉线
+	CrashBusAnomaly = -2
+	// CrashNoData 评估窗口内没有解码出任何规则信号，如触发时间与日志不重叠或 DBC 不匹配
+	CrashNoData = -3
+	// CrashParseAborted CAN 日志中格式错误或无法解码的帧超过容错阈值，解析中止，剩余数据未判断
+	CrashParseAborted = -4
+	// CrashNoTimeBase CAN 日志只记录了相对时间且没有开始时间，无法与触发时间和评估窗口对齐
+	CrashNoTimeBase = -5
+)
+
 // CrashInfoMap 定义了不同碰撞状态的描述信息
 var CrashInfoMap = map[int]string{
-	0: "未发生碰撞",
-	1: "横行加速度超限",
-	2: "纵向加速度超限",
-	3: "气囊弹出",
-	4: "方向盘转角超限",
+	CrashNoTimeBase:   "无法判定——CAN 日志没有绝对时间，无法与触发时间对齐",
+	CrashParseAborted: "无法判定——CAN 日志异常过多，解析中止",
+	CrashNoData:       "无法判定——评估窗口内没有信号数据",
+	CrashBusAnomaly:   "总线通信异常",
+	CrashSensorFault:  "无法判定——传感器故障",
+	0:                 "未发生碰撞",
+	1:                 "横行加速度超限",
+	2:                 "纵向加速度超限",
+	3:                 "气囊弹出",
+	4:                 "方向盘转角超限",
+	5:                 "正面碰撞",
+	6:                 "侧面碰撞",
+	7:                 "侧翻",
 }
 
-// 获取Redis客户端实例
-var redisClient = configs.Client.Redis // Use initialized Redis client instance
+// redisClient 获取Redis客户端实例。调用时才读取 configs.Client，
+// 引用本包（如 CrashInfoMap）的包在初始化和单元测试时无需先创建客户端
+func redisClient() *redis.Client {
+	return configs.Client.Redis
+}
 
 // NegativeTriggerData 表示负面触发器数据
 type NegativeTriggerData struct {
-	Vin          string `json:"vin"`           // 车辆识别号
-	Timestamp    int64  `json:"timestamp"`     // 触发时间戳
-	CarType      string `json:"car_type"`      // 车辆类型
-	UsageType    string `json:"usage_type"`    // 使用类型
-	TriggerID    string `json:"trigger_id"`    // 触发器ID
-	LogId        int    `json:"log_id"`        // 日志ID
-	ThresholdLog string `json:"threshold_log"` // 阈值日志
-	IsCrash      int    `json:"is_crash"`      // 是否发生碰撞
+	Vin          string `json:"vin"`               // 车辆识别号
+	Timestamp    int64  `json:"timestamp"`         // 触发时间戳，保持触发源原值，精度可能是秒、毫秒或更高
+	CarType      string `json:"car_type"`          // 车辆类型
+	UsageType    string `json:"usage_type"`        // 使用类型
+	TriggerID    string `json:"trigger_id"`        // 触发器ID
+	LogId        int    `json:"log_id"`            // 日志ID
+	ThresholdLog string `json:"threshold_log"`     // 阈值日志
+	IsCrash      int    `json:"is_crash"`          // 是否发生碰撞
+	DTCs         string `json:"dtcs,omitempty"`    // 诊断响应中提取的 UDS/OBD-II 故障码（JSON）
+	Verdict      string `json:"verdict,omitempty"` // 结构化判定结论（JSON），包含全部规则命中及峰值
 }
 
 // PopToRedisQueue 从指定的Redis队列中弹出一个负面触发器数据。
@@ -40,7 +67,7 @@ type NegativeTriggerData struct {
 // 如果队列为空，则返回 (nil, nil)。
 // 如果发生错误（例如，Redis连接问题或反序列化失败），则返回错误。
 func PopToRedisQueue(ctx context.Context, queueName string) (*NegativeTriggerData, error) {
-	val, err := redisClient.LPop(ctx, queueName).Result()
+	val, err := redisClient().LPop(ctx, queueName).Result()
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil // 队列为空
@@ -132,7 +159,7 @@ func (d *NegativeTriggerData) PushToRedisQueue(queueName string) error {
 	}
 
 	// 推送到Redis列表
-	result := redisClient.RPush(ctx, queueName, jsonData)
+	result := redisClient().RPush(ctx, queueName, jsonData)
 	if result.Err() != nil {
 		configs.Client.Logger.Error("推送数据到Redis队列失败", zap.Error(result.Err())) // Use initialized Logger instance
 		return fmt.Errorf("推送数据到Redis队列失败: %w", result.Err())
@@ -1,76 +1,94 @@
 package utils
 
 import (
-	"bufio"
-	"fmt"
-	"os"
+	"errors"
+	"io"
 	"sort"
-
-	"go.einride.tech/can/pkg/dbc"
 )
 
+// ErrNoCANSignalData 日志中没有解码出任何目标信号
+var ErrNoCANSignalData = errors.New("未找到有效信号数据，请检查DBC匹配和日志格式")
+
+// ErrCANRelativeTime 设置了时间窗口，但日志只记录了相对时间且文件头和 SetStartTime 都未给出开始时间，
+// 帧无法与窗口对齐
+var ErrCANRelativeTime = errors.New("CAN 日志只记录了相对时间，没有开始时间，无法按时间窗口对齐")
+
 // ParseCANLogWithDBC 使用 DBC 文件解析 CAN 日志文件，提取指定信号的值。
 // 参数:
 //
-//	canLogPath: CAN 日志文件的路径 (期望为 CANDump 格式)。
+//	canLogPath: CAN 日志文件的路径 (支持 candump、Vector ASC、PEAK TRC 等已注册格式)。
 //	dbcPath: DBC 文件的路径。
 //	targetSignals: 需要解析的信号名称列表。
 //
 // 返回:
 //
-//	signalData: 一个 map，第一层 key 是时间戳 (int64)，value 是另一个 map。
+//	signalData: 一个 map，第一层 key 是时间戳 (int64，Unix 毫秒，触发时间经 NormalizeEpochMillis 换算后与之对齐)，value 是另一个 map。
 //	            内层 map 的 key 是信号名 (string)，value 是信号值 (float64)。
 //	timestamps: 一个排序后的时间戳数组 (int64)，用于顺序访问数据。
 //	error: 解析过程中发生的任何错误。
 func ParseCANLogWithDBC(canLogPath, dbcPath string, targetSignals []string) (map[int64]map[string]float64, []int64, error) {
-	// 1. 解析 DBC 文件
-	dbcFileContent, err := os.ReadFile(dbcPath)
+	// 1. 从注册表获取编译后的 DBC，同一文件只解析一次
+	db, err := DefaultDBCRegistry().Get(dbcPath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("读取 DBC 文件 '%s' 失败: %w", dbcPath, err)
+		return nil, nil, err
 	}
-	// 创建DBC解析器并解析文件内容
-	dbcParser := dbc.NewParser(dbcPath, dbcFileContent)
-	if err := dbcParser.Parse(); err != nil {
-		return nil, nil, fmt.Errorf("解析 DBC 文件 '%s' 失败: %w", dbcPath, err)
+	return ParseCANLogWithCompiledDBC(canLogPath, db, targetSignals)
+}
+
+// ParseCANLogWithCompiledDBC 使用已编译的 DBC 解析 CAN 日志文件，返回值同 ParseCANLogWithDBC
+func ParseCANLogWithCompiledDBC(canLogPath string, db *CompiledDBC, targetSignals []string) (map[int64]map[string]float64, []int64, error) {
+	decoder, err := NewCANDecoder([]DBCBinding{{DBC: db}}, targetSignals, nil)
+	if err != nil {
+		return nil, nil, err
 	}
-	db := dbcParser.File()
+	return ParseCANLogWithDecoder(canLogPath, decoder)
+}
 
-	// 初始化CAN解析器
-	canParser := NewCANParser(db, targetSignals)
+// ParseCANLogWithDecoder 使用多 DBC 解码器解析 CAN 日志文件，信号名为解码器中的逻辑信号名，
+// 返回值同 ParseCANLogWithDBC
+func ParseCANLogWithDecoder(canLogPath string, decoder *CANDecoder) (map[int64]map[string]float64, []int64, error) {
+	signalData, timestamps, _, err := ParseCANLogWithPolicy(canLogPath, decoder, CANParsePolicy{})
+	return signalData, timestamps, err
+}
 
-	// 3. 打开并读取 CAN 日志文件
-	canFile, err := os.Open(canLogPath)
+// ParseCANLogWithPolicy 按容错策略解析 CAN 日志文件，并返回解析报告。
+// 解析中止或出错时报告仍会返回，记录了出错前的统计信息。
+func ParseCANLogWithPolicy(canLogPath string, decoder *CANDecoder, policy CANParsePolicy) (map[int64]map[string]float64, []int64, *CANParseReport, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, nil, nil, err
+	}
+	// 3. 打开 CAN 日志文件，按文件头和扩展名自动识别格式
+	canLog, err := OpenCANLog(canLogPath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("打开 CAN 日志文件 '%s' 失败: %w", canLogPath, err)
+		return nil, nil, nil, err
 	}
-	defer canFile.Close()
+	defer canLog.Close()
 
+	source := newFrameSource(canLog, canLogPath, decoder, policy)
 	signalData := make(map[int64]map[string]float64)
 	timestampSet := make(map[int64]struct{})
 
-	scanner := bufio.NewScanner(canFile)
-	for scanner.Scan() {
-		timestamp, signals, err := canParser.ParseLine(scanner.Text())
+	for {
+		frame, signals, _, err := source.next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			return nil, nil, fmt.Errorf("解析错误[%s:%d]: %w", canLogPath, canParser.lineNumber, err)
+			return nil, nil, source.report, err
 		}
-		if timestamp == 0 || len(signals) == 0 {
+		if frame.NoTime || len(signals) == 0 {
 			continue
 		}
 
-		// 收集信号数据
-		if _, exists := signalData[timestamp]; !exists {
-			signalData[timestamp] = make(map[string]float64)
+		// 收集信号数据，同一毫秒内的帧合并
+		ts := frameMillis(frame.Timestamp)
+		if _, exists := signalData[ts]; !exists {
+			signalData[ts] = make(map[string]float64)
 		}
 		for sigName, value := range signals {
-			signalData[timestamp][sigName] = value
+			signalData[ts][sigName] = value
 		}
-		timestampSet[timestamp] = struct{}{}
-
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, nil, fmt.Errorf("读取 CAN 日志文件 '%s' 时出错: %w", canLogPath, err)
+		timestampSet[ts] = struct{}{}
 	}
 
 	// 6. 整理并排序时间戳
@@ -81,7 +99,7 @@ func ParseCANLogWithDBC(canLogPath, dbcPath string, targetSignals []string) (map
 	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
 
 	if len(signalData) == 0 {
-		return nil, nil, fmt.Errorf("未找到有效信号数据，请检查DBC匹配和日志格式")
+		return nil, nil, source.report, ErrNoCANSignalData
 	}
-	return signalData, timestamps, nil
+	return signalData, timestamps, source.report, nil
 }
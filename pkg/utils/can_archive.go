@@ -0,0 +1,253 @@
+package utils
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// canCompression 描述一种可透明解压的单文件压缩格式
+type canCompression struct {
+	name      string
+	extension string
+	magic     []byte
+	newReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var canCompressions = []canCompression{
+	{
+		name:      "gzip",
+		extension: ".gz",
+		magic:     []byte{0x1f, 0x8b},
+		newReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	},
+	{
+		name:      "zstd",
+		extension: ".zst",
+		magic:     []byte{0x28, 0xb5, 0x2f, 0xfd},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+	},
+}
+
+// zipMagic zip 文件的本地文件头标识
+var zipMagic = []byte("PK\x03\x04")
+
+// detectCompression 根据文件头判断压缩格式，未压缩时返回 nil
+func detectCompression(header []byte) *canCompression {
+	for i := range canCompressions {
+		if bytes.HasPrefix(header, canCompressions[i].magic) {
+			return &canCompressions[i]
+		}
+	}
+	return nil
+}
+
+// openCANLogStream 从顺序读取的数据流创建日志读取器，gzip/zstd 压缩的数据先透明解压。
+// name 用于按扩展名识别格式；strict 为真时无法识别格式返回 nil 读取器而不是按 candump 处理。
+func openCANLogStream(name string, r io.Reader, strict bool) (CANLogReader, *CANLogFormat, *canCompression, io.Closer, error) {
+	br := bufio.NewReaderSize(r, canLogHeaderSize)
+	header, err := br.Peek(canLogHeaderSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, nil, nil, nil, fmt.Errorf("读取 CAN 日志文件头 '%s' 失败: %w", name, err)
+	}
+
+	var closer io.Closer
+	compression := detectCompression(header)
+	if compression != nil {
+		dr, err := compression.newReader(br)
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("解压 %s 文件 '%s' 失败: %w", compression.name, name, err)
+		}
+		closer = dr
+		name = strings.TrimSuffix(name, compression.extension)
+		br = bufio.NewReaderSize(dr, canLogHeaderSize)
+		if header, err = br.Peek(canLogHeaderSize); err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			dr.Close()
+			return nil, nil, nil, nil, fmt.Errorf("解压 %s 文件 '%s' 失败: %w", compression.name, name, err)
+		}
+	}
+
+	format := detectCANLogFormat(name, header)
+	if format == nil && !strict {
+		format, err = DetectCANLogFormat(name, header)
+		if err != nil {
+			closeIfSet(closer)
+			return nil, nil, nil, nil, err
+		}
+	}
+	if format == nil {
+		closeIfSet(closer)
+		return nil, nil, nil, nil, nil
+	}
+	reader, err := format.NewReader(br)
+	if err != nil {
+		closeIfSet(closer)
+		return nil, nil, nil, nil, fmt.Errorf("创建 %s 读取器失败: %w", format.Name, err)
+	}
+	return reader, format, compression, closer, nil
+}
+
+func closeIfSet(c io.Closer) {
+	if c != nil {
+		c.Close()
+	}
+}
+
+// zipChannelPattern 从归档成员文件名中识别总线通道，如 can0.log、ch2.asc、bus_3.blf
+var zipChannelPattern = regexp.MustCompile(`(?i)(?:^|[^a-z])(can|ch|channel|bus)[_-]?(\d+)`)
+
+// zipMemberChannel 返回归档成员文件名对应的通道号，无法识别时返回0。
+// canN 与 candump 接口名一致按0开始计数，其余写法按1开始计数。
+func zipMemberChannel(name string) int {
+	m := zipChannelPattern.FindStringSubmatch(path.Base(name))
+	if m == nil {
+		return 0
+	}
+	n, err := strconv.Atoi(m[2])
+	if err != nil {
+		return 0
+	}
+	if strings.EqualFold(m[1], "can") {
+		return n + 1
+	}
+	return n
+}
+
+// openCANLogArchive 打开 zip 归档中的所有 CAN 日志，按时间戳合并为一个读取器。
+// 每个成员视为一路总线，无法识别格式的成员（如说明文件）被忽略。
+func openCANLogArchive(r io.ReaderAt, size int64) (CANLogReader, *CANLogFormat, []io.Closer, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("读取 zip 归档失败: %w", err)
+	}
+
+	merged := &mergedCANLogReader{}
+	var closers []io.Closer
+	var formatNames []string
+	fail := func(err error) (CANLogReader, *CANLogFormat, []io.Closer, error) {
+		for _, c := range closers {
+			c.Close()
+		}
+		return nil, nil, nil, err
+	}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fail(fmt.Errorf("打开归档成员 '%s' 失败: %w", f.Name, err))
+		}
+		closers = append(closers, rc)
+		reader, format, _, closer, err := openCANLogStream(f.Name, rc, true)
+		if err != nil {
+			return fail(fmt.Errorf("归档成员 '%s': %w", f.Name, err))
+		}
+		if reader == nil {
+			continue
+		}
+		if closer != nil {
+			closers = append(closers, closer)
+		}
+		member := &canLogMember{name: f.Name, reader: reader, channel: zipMemberChannel(f.Name), index: len(merged.pending)}
+		merged.pending = append(merged.pending, member)
+		if !slices.Contains(formatNames, format.Name) {
+			formatNames = append(formatNames, format.Name)
+		}
+	}
+	if len(merged.pending) == 0 {
+		return fail(fmt.Errorf("zip 归档中没有可识别的 CAN 日志"))
+	}
+	return merged, &CANLogFormat{Name: strings.Join(formatNames, "+")}, closers, nil
+}
+
+// canLogMember 归档中的一路日志
+type canLogMember struct {
+	name    string
+	reader  CANLogReader
+	channel int // 从文件名识别的通道号，0 表示未识别
+	index   int // 成员顺序，帧和文件名都没有通道信息时以 index+1 作为通道号
+	head    *CANFrame
+}
+
+// mergedCANLogReader 把多路已按时间排序的日志合并为一个按时间戳排序的读取器
+type mergedCANLogReader struct {
+	pending []*canLogMember // 需要读取下一帧的成员
+	heads   memberHeap
+}
+
+// Next 返回各路日志中时间戳最早的一帧
+func (r *mergedCANLogReader) Next() (*CANFrame, error) {
+	for len(r.pending) > 0 {
+		m := r.pending[len(r.pending)-1]
+		frame, err := m.reader.Next()
+		if err == io.EOF {
+			r.pending = r.pending[:len(r.pending)-1]
+			continue
+		}
+		if err != nil {
+			// 单行错误后该成员仍可继续读取，保留在待读取列表中
+			var lineErr *CANLogLineError
+			if !errors.As(err, &lineErr) {
+				r.pending = r.pending[:len(r.pending)-1]
+			}
+			return nil, fmt.Errorf("%s: %w", m.name, err)
+		}
+		r.pending = r.pending[:len(r.pending)-1]
+		switch {
+		case m.channel != 0:
+			frame.Channel = m.channel
+		case frame.Channel == 0:
+			frame.Channel = m.index + 1
+		}
+		m.head = frame
+		heap.Push(&r.heads, m)
+	}
+	if len(r.heads) == 0 {
+		return nil, io.EOF
+	}
+	m := heap.Pop(&r.heads).(*canLogMember)
+	frame := m.head
+	m.head = nil
+	r.pending = append(r.pending, m)
+	return frame, nil
+}
+
+// memberHeap 按当前帧时间戳排序的小顶堆，时间戳相同时按成员顺序
+type memberHeap []*canLogMember
+
+func (h memberHeap) Len() int { return len(h) }
+func (h memberHeap) Less(i, j int) bool {
+	if h[i].head.Timestamp != h[j].head.Timestamp {
+		return h[i].head.Timestamp < h[j].head.Timestamp
+	}
+	return h[i].index < h[j].index
+}
+func (h memberHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *memberHeap) Push(x any)   { *h = append(*h, x.(*canLogMember)) }
+func (h *memberHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return x
+}
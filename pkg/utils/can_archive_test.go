@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const archiveTestLog = `(1620000000.001000) can0 123#01
+(1620000000.003000) can0 123#03
+`
+
+func TestOpenCompressedCANLog(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, err := zw.Write([]byte(archiveTestLog))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	enc, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	zst := enc.EncodeAll([]byte(archiveTestLog), nil)
+	require.NoError(t, enc.Close())
+
+	// 下载的文件统一保存为 .can，按文件头识别压缩格式
+	for name, content := range map[string][]byte{"gzip": gz.Bytes(), "zstd": zst} {
+		path := writeTestFile(t, "download.can", string(content))
+		format, frames := readAllFrames(t, path)
+		assert.Equal(t, name+":candump", format, name)
+		require.Len(t, frames, 2, name)
+		assert.Equal(t, int64(1620000000003000), frames[1].Timestamp, name)
+	}
+}
+
+func TestOpenZipCANLog(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name string, content []byte) {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write(content)
+		require.NoError(t, err)
+	}
+	add("README.txt", []byte("bus logs\n"))
+	add("logs/can1.log", []byte(`(1620000000.002000) can0 18FEF100#64
+(1620000000.004000) can0 18FEF100#65
+`))
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	_, err := gw.Write([]byte(archiveTestLog))
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+	add("logs/can0.log.gz", gz.Bytes())
+	require.NoError(t, zw.Close())
+
+	path := writeTestFile(t, "download.can", buf.String())
+
+	format, frames := readAllFrames(t, path)
+	assert.Equal(t, "zip:candump", format)
+	require.Len(t, frames, 4)
+	var timestamps []int64
+	var channels []int
+	for _, f := range frames {
+		timestamps = append(timestamps, f.Timestamp)
+		channels = append(channels, f.Channel)
+	}
+	// 各路日志按时间戳合并，通道号取自成员文件名
+	assert.Equal(t, []int64{1620000000001000, 1620000000002000, 1620000000003000, 1620000000004000}, timestamps)
+	assert.Equal(t, []int{1, 2, 1, 2}, channels)
+
+	decoder := newTestDecoder(t, "LongitudinalAcceleration", "EngineSpeed")
+	var samples []*CANSample
+	require.NoError(t, StreamCANLog(path, decoder, func(sample *CANSample) bool {
+		samples = append(samples, sample)
+		return true
+	}))
+	require.Len(t, samples, 4)
+	assert.Equal(t, 100.0, samples[1].Signals["EngineSpeed"])
+}
@@ -0,0 +1,299 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"go.einride.tech/can/pkg/dbc"
+)
+
+// dbcAttrCycleTime DBC 中报文发送周期的属性（毫秒），0 表示非周期报文
+const dbcAttrCycleTime = "GenMsgCycleTime"
+
+// dbcAttributeDefaults 收集 BA_DEF_DEF_ 定义的属性默认值
+func dbcAttributeDefaults(db *dbc.File) map[string]*dbc.AttributeDefaultValueDef {
+	defaults := make(map[string]*dbc.AttributeDefaultValueDef)
+	for _, def := range db.Defs {
+		if d, ok := def.(*dbc.AttributeDefaultValueDef); ok {
+			defaults[string(d.AttributeName)] = d
+		}
+	}
+	return defaults
+}
+
+// messageCycleTime 读取报文的发送周期（毫秒），未配置或无效时返回0
+func messageCycleTime(attrs map[string]*dbc.AttributeValueForObjectDef, defaults map[string]*dbc.AttributeDefaultValueDef) int64 {
+	if a, ok := attrs[dbcAttrCycleTime]; ok {
+		if n, err := attributeInt(a); err == nil && n > 0 {
+			return n
+		}
+		return 0
+	}
+	if d, ok := defaults[dbcAttrCycleTime]; ok {
+		n := d.DefaultIntValue
+		if n == 0 {
+			n = int64(d.DefaultFloatValue)
+		}
+		return max(n, 0)
+	}
+	return 0
+}
+
+// CANBusHealthPolicy 总线健康诊断的判定阈值，零值字段使用默认值
+type CANBusHealthPolicy struct {
+	Bitrate        int     `yaml:"bitrate" json:"bitrate"`                   // 总线波特率 bit/s，默认 500000
+	GapFactor      float64 `yaml:"gap_factor" json:"gap_factor"`             // 间隔超过周期的多少倍视为通信中断，默认 3
+	MaxMissingRate float64 `yaml:"max_missing_rate" json:"max_missing_rate"` // 丢帧比例上限，默认 0.1
+	MaxBusLoad     float64 `yaml:"max_bus_load" json:"max_bus_load"`         // 总线负载率上限，默认 0.9
+}
+
+// 总线健康诊断的默认阈值
+const (
+	defaultCANBitrate        = 500000
+	defaultCANGapFactor      = 3
+	defaultCANMaxMissingRate = 0.1
+	defaultCANMaxBusLoad     = 0.9
+)
+
+// Validate 检查阈值配置
+func (p CANBusHealthPolicy) Validate() error {
+	if p.Bitrate < 0 || p.GapFactor < 0 || p.MaxMissingRate < 0 || p.MaxBusLoad < 0 {
+		return fmt.Errorf("总线健康诊断阈值不能为负数")
+	}
+	if p.GapFactor != 0 && p.GapFactor <= 1 {
+		return fmt.Errorf("gap_factor 必须大于1: %g", p.GapFactor)
+	}
+	return nil
+}
+
+func (p CANBusHealthPolicy) withDefaults() CANBusHealthPolicy {
+	if p.Bitrate == 0 {
+		p.Bitrate = defaultCANBitrate
+	}
+	if p.GapFactor == 0 {
+		p.GapFactor = defaultCANGapFactor
+	}
+	if p.MaxMissingRate == 0 {
+		p.MaxMissingRate = defaultCANMaxMissingRate
+	}
+	if p.MaxBusLoad == 0 {
+		p.MaxBusLoad = defaultCANMaxBusLoad
+	}
+	return p
+}
+
+// CANBusReport 按通道和报文统计的总线通信情况
+type CANBusReport struct {
+	Channels  []CANChannelStats `json:"channels"`
+	Messages  []CANMessageStats `json:"messages"`
+	Anomalies []string          `json:"anomalies,omitempty"` // 通信异常描述，非空时判定为总线通信异常
+}
+
+// CANChannelStats 单个通道的帧数和负载率
+type CANChannelStats struct {
+	Channel    int     `json:"channel"`
+	Frames     int     `json:"frames"`
+	DurationMs float64 `json:"duration_ms"`
+	BusLoad    float64 `json:"bus_load"` // 按名义位数（不含位填充）估算的负载率，0~1
+}
+
+// CANMessageStats 单个报文的周期统计，时间单位为毫秒
+type CANMessageStats struct {
+	Channel         int     `json:"channel"`
+	ID              string  `json:"id"`
+	Name            string  `json:"name"`
+	Frames          int     `json:"frames"`
+	ExpectedCycleMs int64   `json:"expected_cycle_ms,omitempty"` // DBC 中的 GenMsgCycleTime
+	MeanCycleMs     float64 `json:"mean_cycle_ms"`
+	JitterMs        float64 `json:"jitter_ms"` // 周期的标准差
+	MaxGapMs        float64 `json:"max_gap_ms"`
+	MissingFrames   int     `json:"missing_frames"` // 按 DBC 周期估算的丢帧数
+	SilentMs        float64 `json:"silent_ms"`      // 最后一帧到日志结束的时长
+}
+
+// busMessageKey 报文统计键，相同ID在不同通道上分别统计
+type busMessageKey struct {
+	channel  int
+	id       uint32
+	extended bool
+}
+
+// messageTiming 单个报文的到达时间统计，时间单位为微秒
+type messageTiming struct {
+	msg         *compiledMessage
+	frames      int
+	first, last int64
+	sum, sumSq  float64 // 帧间隔（毫秒）的和与平方和
+	maxGap      int64
+	missing     int
+}
+
+// channelTiming 单个通道的帧数和总位数
+type channelTiming struct {
+	frames      int
+	bits        int64
+	first, last int64
+}
+
+// canBusStats 在读取日志时累计各报文的周期和各通道的负载
+type canBusStats struct {
+	messages map[busMessageKey]*messageTiming
+	channels map[int]*channelTiming
+	end      int64 // 最后一帧的时间戳
+}
+
+func newCANBusStats() *canBusStats {
+	return &canBusStats{messages: make(map[busMessageKey]*messageTiming), channels: make(map[int]*channelTiming)}
+}
+
+// add 记录一帧，msg 为该帧在 DBC 中的报文定义，未定义时为 nil
+func (b *canBusStats) add(frame *CANFrame, msg *compiledMessage) {
+	ts := frame.Timestamp
+	b.end = max(b.end, ts)
+
+	ch := b.channels[frame.Channel]
+	if ch == nil {
+		ch = &channelTiming{first: ts}
+		b.channels[frame.Channel] = ch
+	}
+	ch.frames++
+	ch.bits += canFrameBits(frame)
+	ch.first, ch.last = min(ch.first, ts), max(ch.last, ts)
+
+	if msg == nil || frame.Remote || frame.Error {
+		return
+	}
+	key := busMessageKey{frame.Channel, frame.ID, frame.Extended || frame.ID > canMaxStandardID}
+	m := b.messages[key]
+	if m == nil {
+		b.messages[key] = &messageTiming{msg: msg, frames: 1, first: ts, last: ts}
+		return
+	}
+	gap := ts - m.last
+	if gap <= 0 {
+		// 乱序或重复时间戳的帧不计入周期统计
+		m.frames++
+		return
+	}
+	interval := float64(gap) / 1000
+	m.frames++
+	m.sum += interval
+	m.sumSq += interval * interval
+	m.maxGap = max(m.maxGap, gap)
+	m.last = ts
+	if cycle := msg.cycleTime; cycle > 0 && interval >= 1.5*float64(cycle) {
+		m.missing += int(math.Round(interval/float64(cycle))) - 1
+	}
+}
+
+// canFrameBits 估算一帧在总线上占用的名义位数（帧头、CRC、ACK、EOF 和帧间隔，不含位填充）。
+// CAN FD 数据段按仲裁段波特率计算，负载率会偏高。
+func canFrameBits(frame *CANFrame) int64 {
+	bits := int64(47)
+	if frame.Extended || frame.ID > canMaxStandardID {
+		bits = 67
+	}
+	if !frame.Remote {
+		bits += int64(8 * len(frame.Data))
+	}
+	return bits
+}
+
+// report 生成总线统计报告并按策略判断通信异常。
+// expected 为规则依赖的报文，这些报文为周期报文却完全没有出现时同样判为异常。
+func (b *canBusStats) report(policy CANBusHealthPolicy, expected []busExpectedMessage) *CANBusReport {
+	policy = policy.withDefaults()
+	r := &CANBusReport{Channels: []CANChannelStats{}, Messages: []CANMessageStats{}}
+
+	channels := make([]int, 0, len(b.channels))
+	for ch := range b.channels {
+		channels = append(channels, ch)
+	}
+	sort.Ints(channels)
+	for _, ch := range channels {
+		c := b.channels[ch]
+		duration := float64(c.last-c.first) / 1000
+		stats := CANChannelStats{Channel: ch, Frames: c.frames, DurationMs: duration}
+		if duration > 0 {
+			stats.BusLoad = float64(c.bits) / (duration / 1000) / float64(policy.Bitrate)
+		}
+		if stats.BusLoad > policy.MaxBusLoad {
+			r.Anomalies = append(r.Anomalies, fmt.Sprintf("通道 %d 总线负载率 %.1f%% 超过上限 %.1f%%", ch, stats.BusLoad*100, policy.MaxBusLoad*100))
+		}
+		r.Channels = append(r.Channels, stats)
+	}
+
+	keys := make([]busMessageKey, 0, len(b.messages))
+	for key := range b.messages {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].channel != keys[j].channel {
+			return keys[i].channel < keys[j].channel
+		}
+		return keys[i].id < keys[j].id
+	})
+	seen := make(map[*compiledMessage]map[int]bool)
+	for _, key := range keys {
+		m := b.messages[key]
+		if seen[m.msg] == nil {
+			seen[m.msg] = make(map[int]bool)
+		}
+		seen[m.msg][key.channel] = true
+
+		stats := CANMessageStats{
+			Channel:         key.channel,
+			ID:              canIDKey(key.id, key.extended),
+			Name:            string(m.msg.def.Name),
+			Frames:          m.frames,
+			ExpectedCycleMs: m.msg.cycleTime,
+			MaxGapMs:        float64(m.maxGap) / 1000,
+			MissingFrames:   m.missing,
+			SilentMs:        float64(b.end-m.last) / 1000,
+		}
+		if n := float64(m.frames - 1); n > 0 && m.sum > 0 {
+			stats.MeanCycleMs = m.sum / n
+			stats.JitterMs = math.Sqrt(max(m.sumSq/n-stats.MeanCycleMs*stats.MeanCycleMs, 0))
+		}
+		r.Messages = append(r.Messages, stats)
+		r.Anomalies = append(r.Anomalies, stats.anomalies(policy)...)
+	}
+
+	for _, e := range expected {
+		if e.msg.cycleTime <= 0 || len(b.channels) == 0 {
+			continue
+		}
+		if chs := seen[e.msg]; chs[e.channel] || e.channel == 0 && len(chs) > 0 {
+			continue
+		}
+		r.Anomalies = append(r.Anomalies, fmt.Sprintf("报文 %s(%s) 未出现在日志中", e.msg.def.Name,
+			canIDKey(e.msg.def.MessageID.ToCAN(), e.msg.def.MessageID.IsExtended())))
+	}
+	return r
+}
+
+// anomalies 按 DBC 周期判断报文的通信异常，非周期报文不判断
+func (s *CANMessageStats) anomalies(policy CANBusHealthPolicy) []string {
+	if s.ExpectedCycleMs <= 0 {
+		return nil
+	}
+	limit := policy.GapFactor * float64(s.ExpectedCycleMs)
+	var out []string
+	if s.SilentMs > limit {
+		out = append(out, fmt.Sprintf("通道 %d 报文 %s(%s) 在日志结束前 %.0fms 停止发送，周期 %dms", s.Channel, s.Name, s.ID, s.SilentMs, s.ExpectedCycleMs))
+	}
+	if s.MaxGapMs > limit {
+		out = append(out, fmt.Sprintf("通道 %d 报文 %s(%s) 最大间隔 %.0fms，周期 %dms", s.Channel, s.Name, s.ID, s.MaxGapMs, s.ExpectedCycleMs))
+	}
+	if total := s.Frames + s.MissingFrames; total > 0 && float64(s.MissingFrames)/float64(total) > policy.MaxMissingRate {
+		out = append(out, fmt.Sprintf("通道 %d 报文 %s(%s) 丢帧 %d/%d", s.Channel, s.Name, s.ID, s.MissingFrames, total))
+	}
+	return out
+}
+
+// busExpectedMessage 规则依赖的报文及其所在通道，通道为0表示任意通道
+type busExpectedMessage struct {
+	msg     *compiledMessage
+	channel int
+}
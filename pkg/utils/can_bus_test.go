@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const busTestDBC = `VERSION ""
+
+BO_ 291 Accel: 8 ACU
+ SG_ LongitudinalAcceleration : 0|8@1+ (0.1,0) [0|25.5] "g" Vector__XXX
+
+BO_ 292 Airbag: 8 ACU
+ SG_ CrashDetected : 0|8@1+ (1,0) [0|1] "" Vector__XXX
+
+BO_ 293 Gateway: 8 GW
+ SG_ Heartbeat : 0|8@1+ (1,0) [0|255] "" Vector__XXX
+
+BA_DEF_ BO_ "GenMsgCycleTime" INT 0 10000;
+BA_DEF_DEF_ "GenMsgCycleTime" 0;
+BA_ "GenMsgCycleTime" BO_ 291 10;
+BA_ "GenMsgCycleTime" BO_ 292 20;
+`
+
+func TestCANBusHealthReport(t *testing.T) {
+	db, err := ParseDBC("bus.dbc", []byte(busTestDBC))
+	require.NoError(t, err)
+	compiled := CompileDBC(db)
+	assert.Equal(t, int64(10), compiled.messages[messageKey{id: 291}].cycleTime)
+	assert.Equal(t, int64(0), compiled.messages[messageKey{id: 293}].cycleTime)
+	decoder, err := NewCANDecoder([]DBCBinding{{DBC: compiled}}, []string{"LongitudinalAcceleration", "CrashDetected"}, nil)
+	require.NoError(t, err)
+
+	// ACU 在 50ms 后丢了两帧，80ms 后掉线；网关报文持续到 200ms，CrashDetected 所在报文从未出现
+	var log strings.Builder
+	for _, ms := range []int{0, 10, 20, 30, 40, 50, 80} {
+		fmt.Fprintf(&log, "(1620000000.%06d) can0 123#05\n", ms*1000)
+	}
+	for ms := 0; ms <= 200; ms += 50 {
+		fmt.Fprintf(&log, "(1620000000.%06d) can0 125#01\n", ms*1000)
+	}
+	path := writeTestFile(t, "trace.can", log.String())
+
+	report, err := StreamCANLogWithPolicy(path, decoder, CANParsePolicy{}, func(*CANSample) bool { return true })
+	require.NoError(t, err)
+	bus := report.Bus
+	require.NotNil(t, bus)
+	require.Len(t, bus.Channels, 1)
+	assert.Equal(t, 12, bus.Channels[0].Frames)
+	// 单字节标准帧名义位数为 47+8
+	assert.InDelta(t, 12*55/0.2/500000, bus.Channels[0].BusLoad, 1e-9)
+
+	require.Len(t, bus.Messages, 2)
+	accel := bus.Messages[0]
+	assert.Equal(t, "Accel", accel.Name)
+	assert.Equal(t, 7, accel.Frames)
+	assert.Equal(t, 2, accel.MissingFrames)
+	assert.InDelta(t, 80.0/6, accel.MeanCycleMs, 1e-9)
+	assert.Equal(t, 30.0, accel.MaxGapMs)
+	assert.Equal(t, 120.0, accel.SilentMs)
+	assert.Zero(t, bus.Messages[1].ExpectedCycleMs)
+
+	require.Len(t, bus.Anomalies, 3)
+	assert.Contains(t, bus.Anomalies[0], "停止发送")
+	assert.Contains(t, bus.Anomalies[1], "丢帧 2/9")
+	assert.Contains(t, bus.Anomalies[2], "Airbag(0x124) 未出现")
+
+	// 放宽阈值后只剩缺失报文
+	stream, err := OpenCANSampleStream(path, decoder)
+	require.NoError(t, err)
+	defer stream.Close()
+	require.NoError(t, stream.SetBusHealthPolicy(CANBusHealthPolicy{GapFactor: 20, MaxMissingRate: 0.5}))
+	require.NoError(t, stream.Each(func(*CANSample) bool { return true }))
+	assert.Len(t, stream.Report().Bus.Anomalies, 1)
+	assert.Error(t, stream.SetBusHealthPolicy(CANBusHealthPolicy{GapFactor: 0.5}))
+}
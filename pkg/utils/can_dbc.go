@@ -0,0 +1,353 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+
+	"go.einride.tech/can/pkg/dbc"
+)
+
+// CompiledDBC 是编译后的 DBC：报文按 CAN ID 索引，信号的位布局、浮点类型和
+// 多路复用条件都预先计算好，解码每一帧时不再扫描 DBC 定义。
+// 编译结果只读，可在多个 goroutine 间共享。
+type CompiledDBC struct {
+	File     *dbc.File
+	messages map[messageKey]*compiledMessage
+	labels   map[string]map[float64]string
+	units    map[string]string           // 信号名 -> DBC 中的单位，同名信号取第一个定义
+	j1939    bool                        // 是否为 J1939 DBC，扩展帧按 PGN 匹配报文
+	pgns     map[uint32]*compiledMessage // J1939 报文按 PGN 索引，忽略源地址和优先级
+}
+
+// messageKey 报文索引键，标准帧与扩展帧的相同数值ID视为不同报文
+type messageKey struct {
+	id       uint32
+	extended bool
+}
+
+// compiledMessage 编译后的报文定义
+type compiledMessage struct {
+	def       *dbc.MessageDef
+	signals   []*compiledSignal
+	e2e       *E2EConfig // DBC 属性中配置的 E2E 保护，为空表示未保护
+	e2eErr    error      // E2E 属性配置错误，解码该报文时返回
+	cycleTime int64      // DBC 中的发送周期（毫秒），0 表示非周期报文
+}
+
+// compiledSignal 编译后的信号定义
+type compiledSignal struct {
+	name        string
+	index       int // 在所属报文信号列表中的下标
+	size        int
+	layout      bitLayout
+	signed      bool
+	valueType   dbc.SignalValueType // SIG_VALTYPE_ 声明的浮点类型，默认为整数
+	factor      float64
+	offset      float64
+	multiplexed bool                   // 是否被多路复用
+	mux         []compiledMuxCondition // 多路复用条件，任一满足即有效
+	validity    signalValidity         // 物理范围和无效值，用于识别传感器故障
+	err         error                  // 编译时发现的定义错误，解码该信号时返回
+}
+
+// compiledMuxCondition 开关信号已解析为指针的多路复用条件
+type compiledMuxCondition struct {
+	sw     *compiledSignal
+	ranges [][2]uint64
+}
+
+// bitSegment 信号在单个字节中占用的连续位
+type bitSegment struct {
+	index    int   // 字节下标
+	shift    uint8 // 字节内最低位的位置
+	mask     byte  // 右移后的掩码
+	outShift uint8 // 在原始值中的位置
+}
+
+// bitLayout 预先计算的信号位布局，按字节批量提取
+type bitLayout struct {
+	segments []bitSegment
+	minLen   int // 数据段至少需要的字节数
+}
+
+// newBitLayout 按 DBC 位编号计算信号的字节分段。
+// Intel 字节序从 start 开始向高位递增；Motorola 字节序从 start（最高位）开始，
+// 在字节内向低位移动，越过字节边界后跳到下一字节的最高位。
+func newBitLayout(start, size int, bigEndian bool) (bitLayout, error) {
+	if size < 1 || size > 64 {
+		return bitLayout{}, fmt.Errorf("长度无效: %d", size)
+	}
+	var l bitLayout
+	remaining := size
+	pos := start
+	for remaining > 0 {
+		index, bit := pos/8, pos%8
+		seg := bitSegment{index: index}
+		var width int
+		if bigEndian {
+			// Motorola：从字节内的 bit 位向低位取，取完跳到下一字节的最高位
+			width = min(bit+1, remaining)
+			remaining -= width
+			seg.shift = uint8(bit - width + 1)
+			seg.outShift = uint8(remaining)
+			pos = (index+1)*8 + 7
+		} else {
+			width = min(8-bit, remaining)
+			seg.shift = uint8(bit)
+			seg.outShift = uint8(size - remaining)
+			remaining -= width
+			pos += width
+		}
+		seg.mask = byte(1<<width - 1)
+		l.segments = append(l.segments, seg)
+		l.minLen = max(l.minLen, index+1)
+	}
+	return l, nil
+}
+
+// extract 提取原始位，数据段长度不足时返回 false
+func (l *bitLayout) extract(data []byte) (uint64, bool) {
+	if len(data) < l.minLen {
+		return 0, false
+	}
+	var value uint64
+	for _, seg := range l.segments {
+		value |= uint64(data[seg.index]>>seg.shift&seg.mask) << seg.outShift
+	}
+	return value, true
+}
+
+// raw 提取信号的原始位
+func (s *compiledSignal) raw(data []byte) (uint64, error) {
+	if s.err != nil {
+		return 0, fmt.Errorf("信号 %s %w", s.name, s.err)
+	}
+	bits, ok := s.layout.extract(data)
+	if !ok {
+		return 0, fmt.Errorf("信号 %s 超出数据范围: 需要%d字节 数据%d字节", s.name, s.layout.minLen, len(data))
+	}
+	return bits, nil
+}
+
+// physical 把原始位换算为物理值：原始值 * factor + offset
+func (s *compiledSignal) physical(bits uint64) float64 {
+	var value float64
+	switch s.valueType {
+	case dbc.SignalValueTypeFloat32:
+		value = float64(math.Float32frombits(uint32(bits)))
+	case dbc.SignalValueTypeFloat64:
+		value = math.Float64frombits(bits)
+	default:
+		if s.signed {
+			value = float64(signExtend(bits, s.size))
+		} else {
+			value = float64(bits)
+		}
+	}
+	return value*s.factor + s.offset
+}
+
+// CompileDBC 把解析后的 DBC 编译为按ID索引的解码器
+func CompileDBC(db *dbc.File) *CompiledDBC {
+	valueTypes := dbcSignalValueTypes(db)
+	// SG_MUL_VAL_ 已在 ParseDBC 中校验过，这里出错时按无扩展多路复用处理
+	muxValues, _ := parseMuxValues(db.Data)
+	attributes := dbcMessageAttributes(db)
+	defaults := dbcAttributeDefaults(db)
+
+	c := &CompiledDBC{
+		File:     db,
+		messages: make(map[messageKey]*compiledMessage),
+		labels:   DBCValueLabels(db),
+		units:    make(map[string]string),
+		j1939:    isJ1939DBC(db),
+		pgns:     make(map[uint32]*compiledMessage),
+	}
+	for _, def := range db.Defs {
+		m, ok := def.(*dbc.MessageDef)
+		if !ok {
+			continue
+		}
+		key := messageKey{m.MessageID.ToCAN(), m.MessageID.IsExtended()}
+		if _, exists := c.messages[key]; exists {
+			continue
+		}
+		msg := compileMessage(m, valueTypes, muxValues, c.labels)
+		for _, sig := range m.Signals {
+			if _, ok := c.units[string(sig.Name)]; !ok && sig.Unit != "" {
+				c.units[string(sig.Name)] = sig.Unit
+			}
+		}
+		msg.e2e, msg.e2eErr = e2eConfigFromAttributes(attributes[m.MessageID])
+		msg.cycleTime = messageCycleTime(attributes[m.MessageID], defaults)
+		c.messages[key] = msg
+		if c.j1939 && key.extended {
+			if pgn := parseJ1939ID(key.id).pgn; c.pgns[pgn] == nil {
+				c.pgns[pgn] = msg
+			}
+		}
+	}
+	return c
+}
+
+// lookup 按 CAN ID 查找报文：先精确匹配；J1939 DBC 中的扩展帧再按 PGN 匹配，
+// 同一参数组由不同源地址发送时都能解码。
+func (c *CompiledDBC) lookup(id uint32, extended bool) *compiledMessage {
+	if msg, ok := c.messages[messageKey{id, extended}]; ok {
+		return msg
+	}
+	if c.j1939 && extended {
+		return c.pgns[parseJ1939ID(id).pgn]
+	}
+	return nil
+}
+
+func compileMessage(m *dbc.MessageDef, valueTypes map[signalKey]dbc.SignalValueType, muxValues map[signalKey][]muxCondition, labels map[string]map[float64]string) *compiledMessage {
+	msg := &compiledMessage{def: m, signals: make([]*compiledSignal, len(m.Signals))}
+	byName := make(map[string]*compiledSignal, len(m.Signals))
+	var simpleSwitch *compiledSignal
+	for i := range m.Signals {
+		sig := &m.Signals[i]
+		cs := &compiledSignal{
+			name:        string(sig.Name),
+			index:       i,
+			size:        int(sig.Size),
+			multiplexed: sig.IsMultiplexed,
+			signed:      sig.IsSigned,
+			valueType:   valueTypes[signalKey{m.MessageID, string(sig.Name)}],
+			factor:      sig.Factor,
+			offset:      sig.Offset,
+		}
+		cs.layout, cs.err = newBitLayout(int(sig.StartBit), int(sig.Size), sig.IsBigEndian)
+		cs.validity = newSignalValidity(sig, cs.valueType, labels[cs.name])
+		switch {
+		case cs.valueType == dbc.SignalValueTypeFloat32 && sig.Size != 32:
+			cs.err = fmt.Errorf("声明为 float32 但长度为 %d", sig.Size)
+		case cs.valueType == dbc.SignalValueTypeFloat64 && sig.Size != 64:
+			cs.err = fmt.Errorf("声明为 double 但长度为 %d", sig.Size)
+		}
+		if sig.IsMultiplexerSwitch && !sig.IsMultiplexed {
+			simpleSwitch = cs
+		}
+		msg.signals[i] = cs
+		byName[cs.name] = cs
+	}
+
+	for i := range m.Signals {
+		sig, cs := &m.Signals[i], msg.signals[i]
+		if !sig.IsMultiplexed {
+			continue
+		}
+		conditions, extended := muxValues[signalKey{m.MessageID, cs.name}]
+		if !extended {
+			// 简单多路复用：由报文唯一的开关（M）取值决定
+			if simpleSwitch == nil {
+				cs.err = fmt.Errorf("缺少多路复用开关")
+				continue
+			}
+			cs.mux = []compiledMuxCondition{{simpleSwitch, [][2]uint64{{sig.MultiplexerSwitch, sig.MultiplexerSwitch}}}}
+			continue
+		}
+		for _, cond := range conditions {
+			sw, ok := byName[cond.switchName]
+			if !ok {
+				cs.err = fmt.Errorf("的多路复用开关 %s 未定义", cond.switchName)
+				break
+			}
+			cs.mux = append(cs.mux, compiledMuxCondition{sw, cond.ranges})
+		}
+	}
+	return msg
+}
+
+// Message 按 CAN ID 和帧类型查找报文，J1939 DBC 按 PGN 匹配
+func (c *CompiledDBC) Message(id uint32, extended bool) (*dbc.MessageDef, bool) {
+	msg := c.lookup(id, extended)
+	if msg == nil {
+		return nil, false
+	}
+	return msg.def, true
+}
+
+// SignalNames 按 DBC 中报文和信号的定义顺序返回所有信号名，重名信号只保留一次
+func (c *CompiledDBC) SignalNames() []string {
+	seen := make(map[string]struct{})
+	var names []string
+	for _, def := range c.File.Defs {
+		m, ok := def.(*dbc.MessageDef)
+		if !ok {
+			continue
+		}
+		for _, sig := range m.Signals {
+			if _, ok := seen[string(sig.Name)]; ok {
+				continue
+			}
+			seen[string(sig.Name)] = struct{}{}
+			names = append(names, string(sig.Name))
+		}
+	}
+	return names
+}
+
+// ValueLabels 返回 VAL_ 定义的信号取值标签，见 DBCValueLabels
+func (c *CompiledDBC) ValueLabels() map[string]map[float64]string {
+	return c.labels
+}
+
+// 信号在单帧内的多路复用状态
+const (
+	muxUnknown uint8 = iota
+	muxVisiting
+	muxActive
+	muxInactive
+)
+
+// isActive 判断信号在当前帧的多路复用值下是否有效，states 缓存本帧已判断过的信号。
+// 扩展多路复用时开关本身也可能被复用，需要沿开关链逐级判断。
+func (s *compiledSignal) isActive(data []byte, states []uint8) (bool, error) {
+	if !s.multiplexed {
+		return true, nil
+	}
+	if len(s.mux) == 0 {
+		return false, fmt.Errorf("信号 %s %w", s.name, s.err)
+	}
+	switch states[s.index] {
+	case muxActive:
+		return true, nil
+	case muxInactive:
+		return false, nil
+	case muxVisiting:
+		return false, fmt.Errorf("信号 %s 的多路复用关系存在循环", s.name)
+	}
+	states[s.index] = muxVisiting
+
+	active := false
+	for _, cond := range s.mux {
+		swActive, err := cond.sw.isActive(data, states)
+		if err != nil {
+			return false, err
+		}
+		if !swActive {
+			continue
+		}
+		value, err := cond.sw.raw(data)
+		if err != nil {
+			return false, fmt.Errorf("多路复用开关 %w", err)
+		}
+		for _, r := range cond.ranges {
+			if value >= r[0] && value <= r[1] {
+				active = true
+				break
+			}
+		}
+		if active {
+			break
+		}
+	}
+	if active {
+		states[s.index] = muxActive
+	} else {
+		states[s.index] = muxInactive
+	}
+	return active, nil
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DBCRegistry 进程级的 DBC 注册表。每个 DBC 文件只解析编译一次，
+// 之后按文件修改时间和大小判断是否需要重新加载，所有解析任务共享同一份编译结果。
+type DBCRegistry struct {
+	mu      sync.Mutex
+	entries map[string]*dbcRegistryEntry
+}
+
+type dbcRegistryEntry struct {
+	compiled *CompiledDBC
+	modTime  time.Time
+	size     int64
+}
+
+var defaultDBCRegistry = NewDBCRegistry()
+
+// NewDBCRegistry 创建一个空的 DBC 注册表
+func NewDBCRegistry() *DBCRegistry {
+	return &DBCRegistry{entries: make(map[string]*dbcRegistryEntry)}
+}
+
+// DefaultDBCRegistry 返回进程级共享的 DBC 注册表
+func DefaultDBCRegistry() *DBCRegistry {
+	return defaultDBCRegistry
+}
+
+// Get 返回 DBC 文件的编译结果，文件在磁盘上变化后自动重新加载。
+// 重新加载失败时（例如文件正在被写入）继续使用上一次成功编译的版本。
+func (r *DBCRegistry) Get(path string) (*CompiledDBC, error) {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		key = filepath.Clean(path)
+	}
+	info, err := os.Stat(path)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry := r.entries[key]
+	if err != nil {
+		if entry != nil {
+			log.Printf("DBC 文件 '%s' 不可访问，继续使用已加载版本: %v", path, err)
+			return entry.compiled, nil
+		}
+		return nil, fmt.Errorf("读取 DBC 文件 '%s' 失败: %w", path, err)
+	}
+	if entry != nil && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry.compiled, nil
+	}
+
+	db, err := LoadDBCFile(path)
+	if err != nil {
+		if entry != nil {
+			log.Printf("重新加载 DBC 文件失败，继续使用已加载版本: %v", err)
+			return entry.compiled, nil
+		}
+		return nil, err
+	}
+	entry = &dbcRegistryEntry{compiled: CompileDBC(db), modTime: info.ModTime(), size: info.Size()}
+	r.entries[key] = entry
+	return entry.compiled, nil
+}
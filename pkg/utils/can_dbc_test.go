@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitLayoutMatchesExtractBits(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	data := make([]byte, 64)
+	for n := 0; n < 20000; n++ {
+		rng.Read(data)
+		start := rng.Intn(512)
+		size := 1 + rng.Intn(64)
+		bigEndian := rng.Intn(2) == 1
+
+		want, wantErr := extractBits(data, start, size, bigEndian)
+		layout, err := newBitLayout(start, size, bigEndian)
+		require.NoError(t, err)
+		got, ok := layout.extract(data)
+		require.Equal(t, wantErr == nil, ok, "start=%d size=%d bigEndian=%v", start, size, bigEndian)
+		require.Equal(t, want, got, "start=%d size=%d bigEndian=%v", start, size, bigEndian)
+	}
+}
+
+func TestDBCRegistryReload(t *testing.T) {
+	path := writeTestFile(t, "registry.dbc", testDBC)
+	registry := NewDBCRegistry()
+
+	first, err := registry.Get(path)
+	require.NoError(t, err)
+	_, ok := first.Message(0x123, false)
+	assert.True(t, ok)
+	_, ok = first.Message(0x18FEF100, true)
+	assert.True(t, ok)
+	_, ok = first.Message(0x123, true)
+	assert.False(t, ok)
+
+	again, err := registry.Get(path)
+	require.NoError(t, err)
+	assert.Same(t, first, again)
+
+	// 修改文件后重新编译
+	updated := testDBC + "\nBO_ 292 Brake: 8 ESC\n SG_ Pressure : 0|8@1+ (1,0) [0|255] \"bar\" Vector__XXX\n"
+	require.NoError(t, os.WriteFile(path, []byte(updated), 0o644))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+	reloaded, err := registry.Get(path)
+	require.NoError(t, err)
+	assert.NotSame(t, first, reloaded)
+	_, ok = reloaded.Message(0x124, false)
+	assert.True(t, ok)
+
+	// 文件损坏时继续使用上一次成功编译的版本
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(updated, "BO_ 292", "BO_ x", 1)), 0o644))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second)))
+	kept, err := registry.Get(path)
+	require.NoError(t, err)
+	assert.Same(t, reloaded, kept)
+
+	_, err = registry.Get(path + ".missing")
+	assert.Error(t, err)
+}
+
+func TestCANDecoderAliases(t *testing.T) {
+	chassis, err := ParseDBC("chassis.dbc", []byte(`VERSION ""
+
+BO_ 256 ACU: 8 ACU
+ SG_ ACU_LongAccel : 0|8@1+ (0.1,0) [0|25.5] "g" Vector__XXX
+ SG_ ACU_Deploy : 8|1@1+ (1,0) [0|1] "" Vector__XXX
+
+VAL_ 256 ACU_Deploy 0 "Off" 1 "On" ;
+`))
+	require.NoError(t, err)
+	body, err := ParseDBC("body.dbc", []byte(`VERSION ""
+
+BO_ 256 Door: 8 BCM
+ SG_ DoorOpen : 0|8@1+ (1,0) [0|1] "" Vector__XXX
+`))
+	require.NoError(t, err)
+
+	decoder, err := NewCANDecoder(
+		[]DBCBinding{{Channel: 1, DBC: CompileDBC(chassis)}, {Channel: 2, DBC: CompileDBC(body)}},
+		[]string{"LongitudinalAcceleration", "AirbagDeployed", "DoorOpen"},
+		map[string]SignalAlias{
+			"LongitudinalAcceleration": {Signal: "ACU_LongAccel", Channel: 1},
+			"AirbagDeployed":           {Signal: "ACU_Deploy"},
+		})
+	require.NoError(t, err)
+
+	// 相同ID在不同通道上按各自的 DBC 解码
+	signals, err := decoder.Decode(&CANFrame{Channel: 1, ID: 0x100, Data: []byte{15, 1}})
+	require.NoError(t, err)
+	assert.InDelta(t, 1.5, signals["LongitudinalAcceleration"], 1e-9)
+	assert.Equal(t, 1.0, signals["AirbagDeployed"])
+	assert.NotContains(t, signals, "DoorOpen")
+
+	signals, err = decoder.Decode(&CANFrame{Channel: 2, ID: 0x100, Data: []byte{1}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"DoorOpen": 1}, signals)
+
+	_, err = decoder.Decode(&CANFrame{Channel: 3, ID: 0x100, Data: []byte{1}})
+	assert.Error(t, err)
+
+	assert.Equal(t, "On", decoder.ValueLabels()["AirbagDeployed"][1])
+}
@@ -0,0 +1,240 @@
+package utils
+
+import "fmt"
+
+// DBCBinding 把一个已编译的 DBC 绑定到指定通道，Channel 为0表示适用于所有通道
+type DBCBinding struct {
+	Channel int
+	DBC     *CompiledDBC
+}
+
+// SignalAlias 逻辑信号到某个平台实际信号的映射，Channel 为0表示不限定总线
+type SignalAlias struct {
+	Signal  string // DBC 中的实际信号名
+	Channel int    // 信号所在的总线通道
+}
+
+// CANDecoder 按通道组合多个 DBC 解码CAN帧，并把实际信号名换算为规则中使用的逻辑信号名。
+// 规则只需写一次逻辑信号名（如 LongitudinalAcceleration），由别名映射到各平台的实际信号和总线。
+type CANDecoder struct {
+	buses   []decoderBus
+	logical map[string][]aliasTarget // 实际信号名 -> 逻辑信号
+	faults  map[string]SignalFault   // 上一帧被判为传感器故障的逻辑信号
+	e2e     *E2EFailure              // 上一帧的 E2E 校验失败信息
+	diag    *diagnosticState         // 诊断报文的 ISO-TP 重组和故障码，未配置时为空
+}
+
+type decoderBus struct {
+	channel int
+	parser  *CANParser
+}
+
+type aliasTarget struct {
+	logical string
+	channel int
+}
+
+// NewCANDecoder 创建多 DBC 解码器。targetSignals 为逻辑信号名，
+// 未配置别名的逻辑信号按同名实际信号解码。
+func NewCANDecoder(bindings []DBCBinding, targetSignals []string, aliases map[string]SignalAlias) (*CANDecoder, error) {
+	if len(bindings) == 0 {
+		return nil, fmt.Errorf("未配置 DBC 文件")
+	}
+	d := &CANDecoder{logical: make(map[string][]aliasTarget, len(targetSignals))}
+	realSignals := make([]string, 0, len(targetSignals))
+	for _, name := range targetSignals {
+		target := aliasTarget{logical: name}
+		realName := name
+		if alias, ok := aliases[name]; ok && alias.Signal != "" {
+			realName, target.channel = alias.Signal, alias.Channel
+		}
+		if _, exists := d.logical[realName]; !exists {
+			realSignals = append(realSignals, realName)
+		}
+		d.logical[realName] = append(d.logical[realName], target)
+	}
+	for _, b := range bindings {
+		if b.DBC == nil {
+			return nil, fmt.Errorf("通道 %d 的 DBC 为空", b.Channel)
+		}
+		d.buses = append(d.buses, decoderBus{channel: b.Channel, parser: NewCompiledCANParser(b.DBC, realSignals)})
+	}
+	return d, nil
+}
+
+// Decode 解码一帧报文，返回以逻辑信号名为 key 的信号值。
+// 按配置顺序选取第一个适用于该通道且定义了该报文的 DBC。
+func (d *CANDecoder) Decode(frame *CANFrame) (map[string]float64, error) {
+	d.faults, d.e2e = nil, nil
+	parser := d.parserFor(frame)
+	if parser == nil {
+		if frame.Remote || frame.Error {
+			return nil, nil
+		}
+		return nil, &UnknownCANIDError{ID: frame.ID, Extended: frame.Extended || frame.ID > canMaxStandardID}
+	}
+	signals, err := parser.ParseFrame(frame)
+	if err != nil {
+		return nil, err
+	}
+	d.e2e = parser.E2EFailure()
+	for realName, fault := range parser.Faults() {
+		for _, target := range d.logical[realName] {
+			if target.channel == 0 || target.channel == frame.Channel {
+				if d.faults == nil {
+					d.faults = make(map[string]SignalFault)
+				}
+				d.faults[target.logical] = fault
+			}
+		}
+	}
+	if len(signals) == 0 {
+		return nil, nil
+	}
+
+	result := make(map[string]float64, len(signals))
+	for realName, value := range signals {
+		for _, target := range d.logical[realName] {
+			if target.channel == 0 || target.channel == frame.Channel {
+				result[target.logical] = value
+			}
+		}
+	}
+	return result, nil
+}
+
+// Faults 返回上一次 Decode 中被判为传感器故障的逻辑信号，无故障时为 nil
+func (d *CANDecoder) Faults() map[string]SignalFault {
+	return d.faults
+}
+
+// E2EFailure 返回上一次 Decode 的 E2E 校验失败信息，见 CANParser.E2EFailure
+func (d *CANDecoder) E2EFailure() *E2EFailure {
+	return d.e2e
+}
+
+// SetE2EConfig 在 DBC 属性之外按报文配置 E2E 校验，应用到定义了该报文且通道匹配的 DBC。
+// 报文在所有 DBC 中都未定义时返回错误。
+func (d *CANDecoder) SetE2EConfig(configs []E2EMessageConfig) error {
+	for _, c := range configs {
+		found := false
+		for _, bus := range d.buses {
+			if c.Channel != 0 && bus.channel != 0 && bus.channel != c.Channel {
+				continue
+			}
+			ok, err := bus.parser.SetE2EConfig(c.ID, c.Extended, c.Channel, c.E2EConfig)
+			if err != nil {
+				return err
+			}
+			found = found || ok
+		}
+		if !found {
+			return fmt.Errorf("E2E 配置的报文 CAN ID %X 未在DBC中定义", c.ID)
+		}
+	}
+	return nil
+}
+
+// message 返回该帧在所选 DBC 中的报文定义，未定义时返回 nil
+func (d *CANDecoder) message(frame *CANFrame) *compiledMessage {
+	parser := d.parserFor(frame)
+	if parser == nil {
+		return nil
+	}
+	return parser.db.lookup(frame.ID, frame.Extended || frame.ID > canMaxStandardID)
+}
+
+// j1939Report 汇总各 J1939 DBC 解析器的多包传输和故障码统计，没有 J1939 DBC 时返回 nil
+func (d *CANDecoder) j1939Report() *J1939Report {
+	var r *J1939Report
+	for _, bus := range d.buses {
+		if bus.parser.j1939 == nil {
+			continue
+		}
+		s := bus.parser.j1939.snapshot()
+		if r == nil {
+			r = s
+			continue
+		}
+		r.Transfers += s.Transfers
+		r.TransportErrors += s.TransportErrors
+		r.ActiveFaults = append(r.ActiveFaults, s.ActiveFaults...)
+		r.Lamps = append(r.Lamps, s.Lamps...)
+	}
+	return r
+}
+
+// expectedMessages 返回包含目标信号的报文，用于判断规则依赖的报文是否缺失
+func (d *CANDecoder) expectedMessages() []busExpectedMessage {
+	var expected []busExpectedMessage
+	for _, bus := range d.buses {
+		for _, msg := range bus.parser.db.messages {
+			for _, sig := range msg.signals {
+				if _, ok := bus.parser.targetSigs[sig.name]; ok {
+					expected = append(expected, busExpectedMessage{msg, bus.channel})
+					break
+				}
+			}
+		}
+	}
+	return expected
+}
+
+// parserFor 选择解码该帧使用的解析器。
+// J1939 的多包传输和 DM1 报文通常不在 DBC 中定义，交给第一个通道匹配的 J1939 DBC 处理。
+func (d *CANDecoder) parserFor(frame *CANFrame) *CANParser {
+	extended := frame.Extended || frame.ID > canMaxStandardID
+	var j1939 *CANParser
+	for _, bus := range d.buses {
+		if bus.channel != 0 && bus.channel != frame.Channel {
+			continue
+		}
+		if bus.parser.db.lookup(frame.ID, extended) != nil {
+			return bus.parser
+		}
+		if j1939 == nil && bus.parser.j1939 != nil && extended && isJ1939Transport(parseJ1939ID(frame.ID).pgn) {
+			j1939 = bus.parser
+		}
+	}
+	return j1939
+}
+
+// ValueLabels 返回以逻辑信号名为 key 的 VAL_ 取值标签，取第一个定义了该信号标签的 DBC
+func (d *CANDecoder) ValueLabels() map[string]map[float64]string {
+	labels := make(map[string]map[float64]string)
+	for realName, targets := range d.logical {
+		for _, bus := range d.buses {
+			table, ok := bus.parser.db.labels[realName]
+			if !ok {
+				continue
+			}
+			for _, target := range targets {
+				if _, exists := labels[target.logical]; !exists {
+					labels[target.logical] = table
+				}
+			}
+			break
+		}
+	}
+	return labels
+}
+
+// Units 返回以逻辑信号名为 key 的 DBC 单位，取第一个定义了该信号单位的 DBC
+func (d *CANDecoder) Units() map[string]string {
+	units := make(map[string]string)
+	for realName, targets := range d.logical {
+		for _, bus := range d.buses {
+			unit, ok := bus.parser.db.units[realName]
+			if !ok {
+				continue
+			}
+			for _, target := range targets {
+				if _, exists := units[target.logical]; !exists {
+					units[target.logical] = unit
+				}
+			}
+			break
+		}
+	}
+	return units
+}
@@ -0,0 +1,314 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// DerivedKind 派生信号的计算方式
+type DerivedKind string
+
+const (
+	DerivedDerivative DerivedKind = "derivative" // 对时间求导，单位为输入单位每秒，如加速度求导得到 jerk
+	DerivedIntegral   DerivedKind = "integral"   // 对时间梯形积分，单位为输入单位乘秒，如加速度积分得到速度变化量
+	DerivedMean       DerivedKind = "mean"       // window 时间窗口内的滑动平均
+	DerivedMin        DerivedKind = "min"        // window 时间窗口内的最小值
+	DerivedMax        DerivedKind = "max"        // window 时间窗口内的最大值
+	DerivedLowPass    DerivedKind = "lowpass"    // 二阶 Butterworth 低通滤波，截止频率为 cutoff
+	DerivedCFC        DerivedKind = "cfc"        // 按 SAE J211 的 CFC 等级（如 60、180）正反两次二阶 Butterworth 滤波，见 cfcCutoffRatio
+	DerivedExpr       DerivedKind = "expr"       // 任意算术表达式，如 sqrt(ax^2 + ay^2)
+)
+
+// cfcCutoffRatio 滤波器设计频率与 CFC 等级之比，取自 SAE J211 附录 C。
+// 与 J211 相同，用该设计频率的二阶滤波器正反各滤波一次，合成的四阶零相位响应在约 1.65×CFC 处衰减 3dB。
+// 反向滤波需要全部样本，cfc 只能由 ApplyAll 计算。
+const cfcCutoffRatio = 2.0775
+
+// DerivedSignal 由已解码信号计算得到的派生信号，可以和原始信号一样在规则中按名称引用。
+// source 和 expr 可以引用原始信号或在此之前定义的派生信号。
+type DerivedSignal struct {
+	Name   string        `yaml:"name" json:"name"`                         // 派生信号名称
+	Kind   DerivedKind   `yaml:"type" json:"type"`                         // 计算方式
+	Source string        `yaml:"source,omitempty" json:"source,omitempty"` // 输入信号，expr 以外的方式必须配置
+	Window time.Duration `yaml:"window,omitempty" json:"window,omitempty"` // mean、min、max 的时间窗口，如 50ms
+	Cutoff float64       `yaml:"cutoff,omitempty" json:"cutoff,omitempty"` // lowpass 的截止频率 Hz
+	Class  int           `yaml:"class,omitempty" json:"class,omitempty"`   // cfc 的等级，如 60、180、600、1000
+	Expr   string        `yaml:"expr,omitempty" json:"expr,omitempty"`     // expr 的表达式
+}
+
+// Validate 检查单个派生信号的配置，不检查引用的信号是否存在
+func (s DerivedSignal) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("派生信号名称不能为空")
+	}
+	switch s.Kind {
+	case DerivedExpr:
+		if s.Expr == "" {
+			return fmt.Errorf("expr 不能为空")
+		}
+		_, err := CompileSignalExpr(s.Expr)
+		return err
+	case DerivedDerivative, DerivedIntegral, DerivedMean, DerivedMin, DerivedMax, DerivedLowPass, DerivedCFC:
+	default:
+		return fmt.Errorf("未知的派生信号类型: %q", s.Kind)
+	}
+	if s.Source == "" {
+		return fmt.Errorf("%s 需要配置 source", s.Kind)
+	}
+	switch s.Kind {
+	case DerivedMean, DerivedMin, DerivedMax:
+		if s.Window <= 0 {
+			return fmt.Errorf("%s 需要配置大于0的 window", s.Kind)
+		}
+	case DerivedLowPass:
+		if s.Cutoff <= 0 {
+			return fmt.Errorf("lowpass 需要配置大于0的 cutoff")
+		}
+	case DerivedCFC:
+		if s.Class <= 0 {
+			return fmt.Errorf("cfc 需要配置大于0的 class")
+		}
+	}
+	return nil
+}
+
+// cutoff 返回滤波器的设计频率 Hz，非滤波类型返回0
+func (s DerivedSignal) cutoff() float64 {
+	switch s.Kind {
+	case DerivedLowPass:
+		return s.Cutoff
+	case DerivedCFC:
+		return float64(s.Class) * cfcCutoffRatio
+	}
+	return 0
+}
+
+// CANDeriver 按定义顺序逐个样本计算派生信号，并把结果写入样本。
+// 输入信号在某个样本中缺失时，该样本不输出对应的派生信号，状态保持不变。
+type CANDeriver struct {
+	signals []*derivedState
+	inputs  []string
+}
+
+// derivedState 单个派生信号的计算状态
+type derivedState struct {
+	DerivedSignal
+	expr *SignalExpr
+
+	lastTs    int64
+	lastValue float64
+	started   bool
+	integral  float64
+
+	window []resamplePoint // mean/min/max 窗口内的样本
+
+	filter *butterworth
+}
+
+// NewCANDeriver 创建派生信号计算器。period 为样本的固定周期（即重采样周期），
+// lowpass 和 cfc 按该周期设计滤波器，未重采样时为0，此时不能使用滤波。
+func NewCANDeriver(defs []DerivedSignal, period time.Duration) (*CANDeriver, error) {
+	d := &CANDeriver{}
+	defined := make(map[string]bool, len(defs))
+	addInput := func(name string) {
+		if !defined[name] && !slices.Contains(d.inputs, name) {
+			d.inputs = append(d.inputs, name)
+		}
+	}
+	for _, def := range defs {
+		if err := def.Validate(); err != nil {
+			return nil, fmt.Errorf("派生信号 %s: %w", def.Name, err)
+		}
+		if defined[def.Name] {
+			return nil, fmt.Errorf("派生信号 %s 重复定义", def.Name)
+		}
+		state := &derivedState{DerivedSignal: def}
+		switch {
+		case def.Kind == DerivedExpr:
+			state.expr, _ = CompileSignalExpr(def.Expr)
+			for _, name := range state.expr.Vars() {
+				if name == def.Name {
+					return nil, fmt.Errorf("派生信号 %s 不能引用自身", def.Name)
+				}
+				addInput(name)
+			}
+		case def.Source == def.Name:
+			return nil, fmt.Errorf("派生信号 %s 不能引用自身", def.Name)
+		default:
+			addInput(def.Source)
+		}
+		if fc := def.cutoff(); fc > 0 {
+			if period <= 0 {
+				return nil, fmt.Errorf("派生信号 %s: %s 滤波需要固定的采样周期，请配置重采样", def.Name, def.Kind)
+			}
+			filter, err := newButterworth(fc, period.Seconds())
+			if err != nil {
+				return nil, fmt.Errorf("派生信号 %s: %w", def.Name, err)
+			}
+			state.filter = filter
+		}
+		defined[def.Name] = true
+		d.signals = append(d.signals, state)
+	}
+	return d, nil
+}
+
+// Inputs 返回计算派生信号需要解码的原始信号，不含派生信号本身
+func (d *CANDeriver) Inputs() []string {
+	return d.inputs
+}
+
+// Buffered 判断是否有需要全部样本才能计算的派生信号（cfc），此时须缓冲样本后调用 ApplyAll
+func (d *CANDeriver) Buffered() bool {
+	return slices.ContainsFunc(d.signals, func(s *derivedState) bool { return s.Kind == DerivedCFC })
+}
+
+// Apply 计算一个样本时间点（Unix 毫秒）的派生信号并写入 signals。
+// cfc 需要反向滤波，逐个样本计算时不输出，见 ApplyAll。
+func (d *CANDeriver) Apply(ts int64, signals map[string]float64) {
+	for _, s := range d.signals {
+		if s.Kind == DerivedCFC {
+			continue
+		}
+		if value, ok := s.next(ts, signals); ok {
+			s.set(signals, value)
+		}
+	}
+}
+
+// ApplyAll 计算按时间顺序排列的一组样本的派生信号并写入各样本，timestamps 与 samples 一一对应。
+// 派生信号按定义顺序逐个计算，每个派生信号依次处理全部样本，结果与逐个样本调用 Apply 相同；
+// cfc 先正向滤波全部样本，再从最后一个样本开始反向滤波一次，输出没有相位滞后。
+func (d *CANDeriver) ApplyAll(timestamps []int64, samples []map[string]float64) {
+	for _, s := range d.signals {
+		if s.Kind != DerivedCFC {
+			for i, signals := range samples {
+				if value, ok := s.next(timestamps[i], signals); ok {
+					s.set(signals, value)
+				}
+			}
+			continue
+		}
+		// 与 next 相同，跳过输入缺失、时间戳重复或回退的样本
+		var used []int
+		var values []float64
+		for i, signals := range samples {
+			value, ok := signals[s.Source]
+			if !ok || len(used) > 0 && timestamps[i] <= timestamps[used[len(used)-1]] {
+				continue
+			}
+			used = append(used, i)
+			values = append(values, s.filter.next(value))
+		}
+		backward := *s.filter
+		backward.started = false
+		for j := len(values) - 1; j >= 0; j-- {
+			s.set(samples[used[j]], backward.next(values[j]))
+		}
+	}
+}
+
+// set 把派生信号写入样本，NaN 和无穷大不输出
+func (s *derivedState) set(signals map[string]float64, value float64) {
+	if !math.IsNaN(value) && !math.IsInf(value, 0) {
+		signals[s.Name] = value
+	}
+}
+
+// next 输入一个样本，返回该时间点的派生信号
+func (s *derivedState) next(ts int64, signals map[string]float64) (float64, bool) {
+	if s.expr != nil {
+		return s.expr.Eval(signals)
+	}
+	value, ok := signals[s.Source]
+	if !ok {
+		return 0, false
+	}
+	first := !s.started
+	dt := float64(ts-s.lastTs) / 1000
+	if !first && dt <= 0 {
+		// 时间戳重复或回退，保持上一次的状态
+		return 0, false
+	}
+	prev := s.lastValue
+	s.lastTs, s.lastValue, s.started = ts, value, true
+
+	switch s.Kind {
+	case DerivedDerivative:
+		if first {
+			return 0, false
+		}
+		return (value - prev) / dt, true
+	case DerivedIntegral:
+		if !first {
+			s.integral += (value + prev) / 2 * dt
+		}
+		return s.integral, true
+	case DerivedMean, DerivedMin, DerivedMax:
+		s.window = append(s.window, resamplePoint{ts, value})
+		from := ts - s.Window.Milliseconds()
+		i := 0
+		for i < len(s.window) && s.window[i].ts <= from {
+			i++
+		}
+		s.window = s.window[i:]
+		return s.aggregate(), true
+	default:
+		return s.filter.next(value), true
+	}
+}
+
+// aggregate 返回窗口内样本的平均值、最小值或最大值
+func (s *derivedState) aggregate() float64 {
+	result := s.window[0].value
+	sum := 0.0
+	for _, p := range s.window {
+		sum += p.value
+		switch s.Kind {
+		case DerivedMin:
+			result = math.Min(result, p.value)
+		case DerivedMax:
+			result = math.Max(result, p.value)
+		}
+	}
+	if s.Kind == DerivedMean {
+		return sum / float64(len(s.window))
+	}
+	return result
+}
+
+// butterworth 二阶 Butterworth 低通滤波器，按双线性变换在设计频率处预畸变，设计频率处衰减 3dB。
+// 单次滤波是因果的，输出相对输入有相位滞后；cfc 再反向滤波一次抵消相位。
+type butterworth struct {
+	a0, a1, a2, b1, b2 float64
+	x1, x2, y1, y2     float64
+	started            bool
+}
+
+// newButterworth 按设计频率 fc（Hz）和采样周期 T（秒）创建滤波器
+func newButterworth(fc, T float64) (*butterworth, error) {
+	if fc >= 0.5/T {
+		return nil, fmt.Errorf("滤波频率 %gHz 超过采样频率的一半 %gHz", fc, 0.5/T)
+	}
+	wa := math.Tan(math.Pi * fc * T)
+	norm := 1 + math.Sqrt2*wa + wa*wa
+	f := &butterworth{a0: wa * wa / norm}
+	f.a1, f.a2 = 2*f.a0, f.a0
+	f.b1 = -2 * (wa*wa - 1) / norm
+	f.b2 = (-1 + math.Sqrt2*wa - wa*wa) / norm
+	return f, nil
+}
+
+// next 输入一个样本返回滤波结果，第一个样本用于初始化历史值，避免起始阶跃
+func (f *butterworth) next(x float64) float64 {
+	if !f.started {
+		f.x1, f.x2, f.y1, f.y2 = x, x, x, x
+		f.started = true
+	}
+	y := f.a0*x + f.a1*f.x1 + f.a2*f.x2 + f.b1*f.y1 + f.b2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
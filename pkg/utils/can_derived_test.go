@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileSignalExpr(t *testing.T) {
+	tests := []struct {
+		expr string
+		want float64
+	}{
+		{"sqrt(ax^2 + ay^2)", 5},
+		{"-ax^2", -9},
+		{"2^-1 * ay", 2},
+		{"(ax + ay) / 2 - 1e-1", 3.4},
+		{"max(abs(ax - ay), hypot(ax, ay)) * 10", 50},
+	}
+	signals := map[string]float64{"ax": 3, "ay": 4}
+	for _, tt := range tests {
+		expr, err := CompileSignalExpr(tt.expr)
+		require.NoError(t, err, tt.expr)
+		got, ok := expr.Eval(signals)
+		require.True(t, ok, tt.expr)
+		assert.InDelta(t, tt.want, got, 1e-9, tt.expr)
+	}
+
+	expr, err := CompileSignalExpr("sqrt(ax*ax + ay*ay + az*az)")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ax", "ay", "az"}, expr.Vars())
+	_, ok := expr.Eval(signals)
+	assert.False(t, ok, "缺少 az 时不输出")
+
+	for _, bad := range []string{"", "ax +", "sqrt(ax, ay)", "foo(ax)", "(ax", "ax ay", "1.2.3", "ax # 2"} {
+		_, err := CompileSignalExpr(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+// deriveAll 按10ms周期输入 values，返回每个样本的派生信号 name
+func deriveAll(t *testing.T, d *CANDeriver, source, name string, values ...float64) []float64 {
+	t.Helper()
+	var got []float64
+	for i, v := range values {
+		signals := map[string]float64{source: v}
+		d.Apply(int64(1000+10*i), signals)
+		value, ok := signals[name]
+		if !ok {
+			value = math.NaN()
+		}
+		got = append(got, value)
+	}
+	return got
+}
+
+func TestCANDeriver(t *testing.T) {
+	defs := []DerivedSignal{
+		{Name: "Jerk", Kind: DerivedDerivative, Source: "Accel"},
+		{Name: "DeltaV", Kind: DerivedIntegral, Source: "Accel"},
+		{Name: "Mean", Kind: DerivedMean, Source: "Accel", Window: 20 * time.Millisecond},
+		{Name: "Peak", Kind: DerivedMax, Source: "Accel", Window: 20 * time.Millisecond},
+		{Name: "Low", Kind: DerivedMin, Source: "Accel", Window: 20 * time.Millisecond},
+		{Name: "JerkAbs", Kind: DerivedExpr, Expr: "abs(Jerk) / 1000"},
+	}
+	d, err := NewCANDeriver(defs, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Accel"}, d.Inputs())
+
+	values := []float64{0, 1, 3, 2}
+	var rows []map[string]float64
+	for i, v := range values {
+		signals := map[string]float64{"Accel": v}
+		d.Apply(int64(1000+10*i), signals)
+		rows = append(rows, signals)
+	}
+	assert.NotContains(t, rows[0], "Jerk", "第一个样本没有导数")
+	assert.NotContains(t, rows[0], "JerkAbs")
+	assert.InDelta(t, 100, rows[1]["Jerk"], 1e-9)
+	assert.InDelta(t, -100, rows[3]["Jerk"], 1e-9)
+	assert.InDelta(t, 0.1, rows[3]["JerkAbs"], 1e-9)
+	assert.InDelta(t, (0.5+2+2.5)*0.01, rows[3]["DeltaV"], 1e-9)
+	// 20ms 窗口包含当前和上一个样本
+	assert.InDelta(t, 2.5, rows[3]["Mean"], 1e-9)
+	assert.Equal(t, 3.0, rows[3]["Peak"])
+	assert.Equal(t, 2.0, rows[3]["Low"])
+
+	// 输入缺失的样本不输出，状态保持不变
+	signals := map[string]float64{}
+	d.Apply(1040, signals)
+	assert.Empty(t, signals)
+
+	// ApplyAll 与逐个样本调用 Apply 的结果相同
+	d, err = NewCANDeriver(defs, 0)
+	require.NoError(t, err)
+	samples := make([]map[string]float64, len(values))
+	timestamps := make([]int64, len(values))
+	for i, v := range values {
+		timestamps[i], samples[i] = int64(1000+10*i), map[string]float64{"Accel": v}
+	}
+	d.ApplyAll(timestamps, samples)
+	assert.Equal(t, rows, samples)
+}
+
+// filterGain 返回派生滤波器对频率为 freq（Hz）的正弦输入在稳态下的幅值增益，样本周期为 period。
+// 用 ApplyAll 计算全部样本，首尾各 settle 个样本为正向和反向滤波的过渡段，不计入增益
+func filterGain(t *testing.T, def DerivedSignal, period time.Duration, freq float64) float64 {
+	t.Helper()
+	d, err := NewCANDeriver([]DerivedSignal{def}, period)
+	require.NoError(t, err)
+	const settle, n = 1000, 8000
+	timestamps := make([]int64, 2*settle+n)
+	samples := make([]map[string]float64, len(timestamps))
+	for i := range samples {
+		timestamps[i] = int64(i) * period.Milliseconds()
+		samples[i] = map[string]float64{def.Source: math.Sin(2 * math.Pi * freq * float64(i) * period.Seconds())}
+	}
+	d.ApplyAll(timestamps, samples)
+	var sum float64
+	for _, signals := range samples[settle : settle+n] {
+		sum += signals[def.Name] * signals[def.Name]
+	}
+	// 正弦的幅值为均方根的 √2 倍
+	return math.Sqrt(2 * sum / n)
+}
+
+func TestCANDeriverCFC(t *testing.T) {
+	cfc60 := DerivedSignal{Name: "Filtered", Kind: DerivedCFC, Source: "Accel", Class: 60}
+	fc := 60 * cfcCutoffRatio
+	for _, tc := range []struct {
+		freq  float64
+		gain  float64
+		delta float64
+	}{
+		{freq: 10, gain: 1, delta: 0.005},               // 通带内基本不衰减
+		{freq: 100, gain: math.Sqrt2 / 2, delta: 0.02},  // J211 的 CFC60 在约 100Hz 处衰减 3dB
+		{freq: fc, gain: 0.5, delta: 0.005},             // 正反两次滤波，设计频率处衰减 6dB
+		{freq: 400, gain: 0.018 * 0.018, delta: 0.0005}, // 接近奈奎斯特频率时大幅衰减
+	} {
+		assert.InDelta(t, tc.gain, filterGain(t, cfc60, time.Millisecond, tc.freq), tc.delta, "%gHz", tc.freq)
+	}
+
+	// lowpass 在 cutoff 处衰减 3dB，与采样周期无关
+	lowpass := DerivedSignal{Name: "Filtered", Kind: DerivedLowPass, Source: "Accel", Cutoff: 5}
+	assert.InDelta(t, math.Sqrt2/2, filterGain(t, lowpass, 10*time.Millisecond, 5), 0.005)
+	assert.InDelta(t, math.Sqrt2/2, filterGain(t, lowpass, time.Millisecond, 5), 0.005)
+
+	// 采样周期须小于 1/(2×设计频率)，CFC60 的设计频率约 124.65Hz，周期须小于约 4.01ms
+	// 正反两次滤波没有相位滞后：对称脉冲滤波后的峰值仍在原位置
+	d, err := NewCANDeriver([]DerivedSignal{cfc60}, time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, d.Buffered())
+	timestamps := make([]int64, 201)
+	samples := make([]map[string]float64, len(timestamps))
+	for i := range samples {
+		timestamps[i] = int64(i)
+		samples[i] = map[string]float64{"Accel": math.Max(0, 10-math.Abs(float64(i-100)))}
+	}
+	d.ApplyAll(timestamps, samples)
+	peak := 0
+	for i, signals := range samples {
+		if signals["Filtered"] > samples[peak]["Filtered"] {
+			peak = i
+		}
+	}
+	assert.Equal(t, 100, peak)
+	assert.InDelta(t, samples[90]["Filtered"], samples[110]["Filtered"], 1e-3)
+	// 逐个样本计算时无法反向滤波，不输出 cfc
+	signals := map[string]float64{"Accel": 1}
+	d.Apply(0, signals)
+	assert.NotContains(t, signals, "Filtered")
+
+	_, err = NewCANDeriver([]DerivedSignal{cfc60}, 5*time.Millisecond)
+	assert.Error(t, err)
+	_, err = NewCANDeriver([]DerivedSignal{cfc60}, 4*time.Millisecond)
+	assert.NoError(t, err)
+	_, err = NewCANDeriver([]DerivedSignal{lowpass}, 0)
+	assert.Error(t, err, "滤波需要固定的采样周期")
+}
+
+func TestCANDeriverValidate(t *testing.T) {
+	for _, defs := range [][]DerivedSignal{
+		{{Name: "A", Kind: "median", Source: "X"}},
+		{{Name: "A", Kind: DerivedMean, Source: "X"}},
+		{{Name: "A", Kind: DerivedDerivative}},
+		{{Name: "A", Kind: DerivedExpr, Expr: "X +"}},
+		{{Name: "A", Kind: DerivedDerivative, Source: "A"}},
+		{{Name: "A", Kind: DerivedDerivative, Source: "X"}, {Name: "A", Kind: DerivedIntegral, Source: "X"}},
+	} {
+		_, err := NewCANDeriver(defs, 0)
+		assert.Error(t, err, "%+v", defs)
+	}
+
+	// 派生信号可以引用之前定义的派生信号，只有原始信号需要解码
+	d, err := NewCANDeriver([]DerivedSignal{
+		{Name: "Resultant", Kind: DerivedExpr, Expr: "sqrt(Ax^2 + Ay^2)"},
+		{Name: "ResultantMean", Kind: DerivedMean, Source: "Resultant", Window: 50 * time.Millisecond},
+	}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Ax", "Ay"}, d.Inputs())
+}
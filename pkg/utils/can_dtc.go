@@ -0,0 +1,288 @@
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// DiagnosticPair 诊断请求/响应 CAN ID 对，响应按 ISO-TP 重组后解码 UDS 和 OBD-II 故障码。
+// 配置的 ID 不再按 DBC 解码，也不计入未定义 ID。
+type DiagnosticPair struct {
+	ECU      string `yaml:"ecu" json:"ecu"`           // ECU 名称，如 ACU
+	Request  uint32 `yaml:"request" json:"request"`   // 诊断仪请求 ID，如 0x7E0，0 表示不识别请求帧
+	Response uint32 `yaml:"response" json:"response"` // ECU 响应 ID，如 0x7E8
+	Extended bool   `yaml:"extended" json:"extended"` // 是否为29位ID，超出11位范围的ID自动按扩展帧处理
+	Channel  int    `yaml:"channel" json:"channel"`   // 总线通道，0 表示所有通道
+
+	// 冻结帧中各 DID 的数据长度（字节），key 为 DID，如 0xF190: 17。
+	// 响应中的 DID 都配置了长度时才能确定记录边界，按记录拆分冻结帧，否则只保存原始数据
+	SnapshotDIDs map[uint16]int `yaml:"snapshot_dids" json:"snapshot_dids,omitempty"`
+}
+
+// 诊断服务的肯定响应
+const (
+	udsReadDTCResponse = 0x59 // UDS ReadDTCInformation(0x19)
+	obdStoredDTCs      = 0x43 // OBD-II Mode 03 已确认故障码
+	obdPendingDTCs     = 0x47 // OBD-II Mode 07 待定故障码
+	obdPermanentDTCs   = 0x4A // OBD-II Mode 0A 永久故障码
+)
+
+// UDS ReadDTCInformation 子功能
+const (
+	udsReportDTCByStatusMask      = 0x02
+	udsReportDTCSnapshotRecord    = 0x04
+	udsReportSupportedDTC         = 0x0A
+	udsReportFirstTestFailedDTC   = 0x0B
+	udsReportFirstConfirmedDTC    = 0x0C
+	udsReportMostRecentTestFailed = 0x0D
+	udsReportMostRecentConfirmed  = 0x0E
+	udsReportMirrorMemoryDTC      = 0x0F
+	udsReportEmissionsDTC         = 0x13
+	udsReportPermanentDTC         = 0x15
+	udsReportUserMemoryDTC        = 0x17
+)
+
+// DiagnosticDTC 从诊断响应中提取的一个故障码
+type DiagnosticDTC struct {
+	ECU       string              `json:"ecu"`
+	Protocol  string              `json:"protocol"`            // uds 或 obd
+	Service   byte                `json:"service"`             // UDS 为 0x19 的子功能，OBD-II 为模式号
+	Code      string              `json:"code"`                // SAE J2012 格式，UDS 带故障类型字节，如 B1A00-17
+	Status    byte                `json:"status,omitempty"`    // UDS 状态掩码，bit0 testFailed，bit3 confirmedDTC
+	Snapshots []UDSSnapshotRecord `json:"snapshots,omitempty"` // UDS 冻结帧，按 DiagnosticPair.SnapshotDIDs 拆分的各条记录
+	// 无法拆分的冻结帧原始数据（十六进制），从第一条记录的记录号开始。
+	// 请求全部记录（记录号 0xFF）时响应中有多条记录首尾相连，DID 的数据长度由 ECU 定义，未配置时无法确定记录边界
+	SnapshotData string `json:"snapshot_data,omitempty"`
+	Timestamp    int64  `json:"timestamp"` // 最后一次上报的时间（Unix 毫秒）
+}
+
+// UDSSnapshotRecord UDS 冻结帧中的一条记录，各 DID 不拆分，按十六进制原样保存
+type UDSSnapshotRecord struct {
+	Number      byte   `json:"number"`      // 记录号
+	Identifiers byte   `json:"identifiers"` // 记录中的 DID 个数
+	Data        string `json:"data"`        // 记录中各 DID 及其数据
+}
+
+// DiagnosticReport 诊断报文统计和提取的故障码
+type DiagnosticReport struct {
+	Frames          int             `json:"frames"`           // 诊断请求和响应帧数
+	Responses       int             `json:"responses"`        // 重组完成的响应报文数
+	TransportErrors int             `json:"transport_errors"` // ISO-TP 序号错误、超时或长度错误
+	DTCs            []DiagnosticDTC `json:"dtcs"`             // 按首次出现顺序排列，同一故障码保留最后一次上报
+}
+
+// dtcKey 同一 ECU 同一协议的故障码只保留一条
+type dtcKey struct {
+	ecu, protocol, code string
+}
+
+// diagnosticState 解码器中的诊断状态
+type diagnosticState struct {
+	pairs  []DiagnosticPair
+	isotp  *isotpState
+	frames int
+	dtcs   []DiagnosticDTC
+	index  map[dtcKey]int
+}
+
+// SetDiagnostics 配置诊断请求/响应 ID 对，响应报文中的故障码在解析报告的 diagnostics 中输出
+func (d *CANDecoder) SetDiagnostics(pairs []DiagnosticPair) error {
+	if len(pairs) == 0 {
+		d.diag = nil
+		return nil
+	}
+	s := &diagnosticState{isotp: newISOTPState(), index: make(map[dtcKey]int)}
+	for _, p := range pairs {
+		if p.Response == 0 {
+			return fmt.Errorf("诊断 ECU %s 未配置响应 ID", p.ECU)
+		}
+		if p.Request == p.Response {
+			return fmt.Errorf("诊断 ECU %s 的请求 ID 与响应 ID 相同: %X", p.ECU, p.Response)
+		}
+		p.Extended = p.Extended || p.Request > canMaxStandardID || p.Response > canMaxStandardID
+		if p.ECU == "" {
+			p.ECU = canIDKey(p.Response, p.Extended)
+		}
+		for did, n := range p.SnapshotDIDs {
+			if n <= 0 {
+				return fmt.Errorf("诊断 ECU %s 的 DID %04X 数据长度必须大于0: %d", p.ECU, did, n)
+			}
+		}
+		s.pairs = append(s.pairs, p)
+	}
+	d.diag = s
+	return nil
+}
+
+// diagnostic 处理配置的诊断报文，返回 false 表示该帧不是诊断报文，需要按 DBC 解码
+func (d *CANDecoder) diagnostic(frame *CANFrame) bool {
+	if d.diag == nil {
+		return false
+	}
+	return d.diag.handle(frame)
+}
+
+// diagnosticReport 返回诊断统计，未配置诊断 ID 时返回 nil
+func (d *CANDecoder) diagnosticReport() *DiagnosticReport {
+	if d.diag == nil {
+		return nil
+	}
+	s := d.diag
+	r := &DiagnosticReport{
+		Frames:          s.frames,
+		Responses:       s.isotp.messages,
+		TransportErrors: s.isotp.errors,
+		DTCs:            make([]DiagnosticDTC, len(s.dtcs)),
+	}
+	copy(r.DTCs, s.dtcs)
+	return r
+}
+
+func (s *diagnosticState) handle(frame *CANFrame) bool {
+	extended := frame.Extended || frame.ID > canMaxStandardID
+	for i := range s.pairs {
+		p := &s.pairs[i]
+		if p.Extended != extended || p.Channel != 0 && p.Channel != frame.Channel {
+			continue
+		}
+		switch {
+		case frame.ID == p.Request && p.Request != 0:
+			s.frames++
+			return true
+		case frame.ID == p.Response:
+			s.frames++
+			key := isotpKey{frame.Channel, frame.ID, extended}
+			if payload, ok := s.isotp.receive(key, frame.Data, frame.Timestamp); ok {
+				s.decode(p, payload, frameMillis(frame.Timestamp))
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// decode 解码一个诊断响应，否定响应和其他服务忽略
+func (s *diagnosticState) decode(p *DiagnosticPair, payload []byte, ts int64) {
+	if len(payload) < 2 {
+		return
+	}
+	var dtcs []DiagnosticDTC
+	switch payload[0] {
+	case udsReadDTCResponse:
+		dtcs = decodeUDSDTCs(payload, p.SnapshotDIDs)
+	case obdStoredDTCs, obdPendingDTCs, obdPermanentDTCs:
+		dtcs = decodeOBDDTCs(payload)
+	}
+	for _, dtc := range dtcs {
+		dtc.ECU, dtc.Timestamp = p.ECU, ts
+		s.record(dtc)
+	}
+}
+
+// record 记录故障码，已出现过的故障码更新状态和时间，新的冻结帧替换旧的
+func (s *diagnosticState) record(dtc DiagnosticDTC) {
+	key := dtcKey{dtc.ECU, dtc.Protocol, dtc.Code}
+	i, ok := s.index[key]
+	if !ok {
+		s.index[key] = len(s.dtcs)
+		s.dtcs = append(s.dtcs, dtc)
+		return
+	}
+	old := &s.dtcs[i]
+	if dtc.Snapshots == nil && dtc.SnapshotData == "" {
+		dtc.Snapshots, dtc.SnapshotData = old.Snapshots, old.SnapshotData
+	}
+	*old = dtc
+}
+
+// decodeUDSDTCs 解码 ReadDTCInformation 肯定响应，didLengths 为冻结帧中各 DID 的数据长度。
+// 状态为0的故障码（ECU 支持但未检测到故障）不输出。
+func decodeUDSDTCs(payload []byte, didLengths map[uint16]int) []DiagnosticDTC {
+	sub := payload[1]
+	var records []byte
+	switch sub {
+	case udsReportDTCByStatusMask, udsReportSupportedDTC, udsReportFirstTestFailedDTC, udsReportFirstConfirmedDTC,
+		udsReportMostRecentTestFailed, udsReportMostRecentConfirmed, udsReportMirrorMemoryDTC,
+		udsReportEmissionsDTC, udsReportPermanentDTC:
+		// 子功能、DTC 状态可用掩码之后每4字节一个 DTC 和状态
+		records = payload[min(len(payload), 3):]
+	case udsReportUserMemoryDTC:
+		// 存储器选择字节之后是状态可用掩码
+		records = payload[min(len(payload), 4):]
+	case udsReportDTCSnapshotRecord:
+		if len(payload) < 6 {
+			return nil
+		}
+		dtc := DiagnosticDTC{Protocol: "uds", Service: sub, Code: udsDTCCode(payload[2:5]), Status: payload[5]}
+		if rest := payload[6:]; len(rest) > 0 {
+			var ok bool
+			if dtc.Snapshots, ok = splitUDSSnapshots(rest, didLengths); !ok {
+				dtc.SnapshotData = fmt.Sprintf("%X", rest)
+			}
+		}
+		return []DiagnosticDTC{dtc}
+	default:
+		return nil
+	}
+
+	var dtcs []DiagnosticDTC
+	for i := 0; i+4 <= len(records); i += 4 {
+		if records[i+3] == 0 {
+			continue
+		}
+		dtcs = append(dtcs, DiagnosticDTC{Protocol: "uds", Service: sub, Code: udsDTCCode(records[i : i+3]), Status: records[i+3]})
+	}
+	return dtcs
+}
+
+// splitUDSSnapshots 按 DID 数据长度把首尾相连的冻结帧记录拆分为各条记录，
+// 有未配置长度的 DID 或数据长度不符时返回 false
+func splitUDSSnapshots(data []byte, didLengths map[uint16]int) ([]UDSSnapshotRecord, bool) {
+	if len(didLengths) == 0 {
+		return nil, false
+	}
+	var records []UDSSnapshotRecord
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, false
+		}
+		pos := 2
+		for range int(data[1]) {
+			if pos+2 > len(data) {
+				return nil, false
+			}
+			n, ok := didLengths[binary.BigEndian.Uint16(data[pos:])]
+			if !ok || pos+2+n > len(data) {
+				return nil, false
+			}
+			pos += 2 + n
+		}
+		records = append(records, UDSSnapshotRecord{Number: data[0], Identifiers: data[1], Data: fmt.Sprintf("%X", data[2:pos])})
+		data = data[pos:]
+	}
+	return records, true
+}
+
+// decodeOBDDTCs 解码 OBD-II 模式 03/07/0A 响应。CAN 上的响应第二个字节为故障码个数，之后每2字节一个故障码。
+func decodeOBDDTCs(payload []byte) []DiagnosticDTC {
+	mode := payload[0] - 0x40
+	count := int(payload[1])
+	var dtcs []DiagnosticDTC
+	for i := 2; i+2 <= len(payload) && len(dtcs) < count; i += 2 {
+		if payload[i] == 0 && payload[i+1] == 0 {
+			continue
+		}
+		dtcs = append(dtcs, DiagnosticDTC{Protocol: "obd", Service: mode, Code: j2012Code(payload[i], payload[i+1])})
+	}
+	return dtcs
+}
+
+// j2012Code 按 SAE J2012 把2字节故障码格式化为 P/C/B/U 加4位十六进制，如 P0301
+func j2012Code(hi, lo byte) string {
+	return fmt.Sprintf("%c%X%03X", "PCBU"[hi>>6], hi>>4&0x3, uint16(hi&0xF)<<8|uint16(lo))
+}
+
+// udsDTCCode 3字节 UDS 故障码，前2字节按 SAE J2012 格式化，第3字节为故障类型
+func udsDTCCode(b []byte) string {
+	return fmt.Sprintf("%s-%02X", j2012Code(b[0], b[1]), b[2])
+}
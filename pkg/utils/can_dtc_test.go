@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeDiagnosticDTCs(t *testing.T) {
+	// 状态为0的故障码不输出
+	dtcs := decodeUDSDTCs([]byte{0x59, 0x02, 0xFF, 0x9A, 0x00, 0x17, 0x09, 0x42, 0x10, 0x00, 0x00}, nil)
+	assert.Equal(t, []DiagnosticDTC{{Protocol: "uds", Service: 0x02, Code: "B1A00-17", Status: 0x09}}, dtcs)
+
+	// 记录号 0xFF 的响应中两条记录首尾相连，按 DID 长度拆分
+	snapshot := []byte{0x59, 0x04, 0x9A, 0x00, 0x17, 0x09, 0x01, 0x01, 0xF1, 0x90, 0x41, 0x02, 0x02, 0xF1, 0x90, 0x42, 0x01, 0x00, 0x12, 0x34}
+	lengths := map[uint16]int{0xF190: 1, 0x0100: 2}
+	dtcs = decodeUDSDTCs(snapshot, lengths)
+	assert.Equal(t, []DiagnosticDTC{{Protocol: "uds", Service: 0x04, Code: "B1A00-17", Status: 0x09, Snapshots: []UDSSnapshotRecord{
+		{Number: 1, Identifiers: 1, Data: "F19041"},
+		{Number: 2, Identifiers: 2, Data: "F1904201001234"},
+	}}}, dtcs)
+
+	// 没有 DID 长度、有未配置长度的 DID 或长度不符时无法确定记录边界，只保存原始数据
+	for _, lengths := range []map[uint16]int{nil, {0xF190: 1}, {0xF190: 1, 0x0100: 3}} {
+		dtcs = decodeUDSDTCs(snapshot, lengths)
+		require.Len(t, dtcs, 1)
+		assert.Nil(t, dtcs[0].Snapshots, "%v", lengths)
+		assert.Equal(t, "0101F190410202F1904201001234", dtcs[0].SnapshotData, "%v", lengths)
+	}
+
+	// 故障码个数之后的填充不输出
+	dtcs = decodeOBDDTCs([]byte{0x43, 0x02, 0x03, 0x01, 0xC1, 0x23, 0x01, 0x33})
+	assert.Equal(t, []DiagnosticDTC{{Protocol: "obd", Service: 0x03, Code: "P0301"}, {Protocol: "obd", Service: 0x03, Code: "U0123"}}, dtcs)
+
+	assert.Nil(t, decodeUDSDTCs([]byte{0x59, 0x14, 0xFF}, nil))
+}
+
+func TestStreamCANLogDiagnostics(t *testing.T) {
+	decoder := newTestDecoder(t, "LongitudinalAcceleration")
+	assert.Error(t, decoder.SetDiagnostics([]DiagnosticPair{{ECU: "ACU", Request: 0x7E2}}))
+	assert.Error(t, decoder.SetDiagnostics([]DiagnosticPair{{ECU: "ACU", Request: 0x7E2, Response: 0x7EA, SnapshotDIDs: map[uint16]int{0xF190: 0}}}))
+	require.NoError(t, decoder.SetDiagnostics([]DiagnosticPair{
+		{ECU: "ACU", Request: 0x7E2, Response: 0x7EA},
+		{ECU: "ECM", Request: 0x7E0, Response: 0x7E8, Channel: 1},
+	}))
+
+	path := writeTestFile(t, "trace.can", `(1620000000.001000) can0 123#01
+(1620000000.002000) can0 7E2#0319020900000000
+(1620000000.003000) can0 7EA#100B5902FF9A0017
+(1620000000.004000) can0 7E2#3000000000000000
+(1620000000.005000) can0 7EA#2109D100872FAAAA
+(1620000000.006000) can0 7E8#0643020301013300
+(1620000000.007000) can1 7E8#0643020301013300
+(1620000000.008000) can0 7EA#100B5902FF9A0017
+(1620000000.009000) can0 7EA#2109D10087AFAAAA
+`)
+	report, err := StreamCANLogWithPolicy(path, decoder, CANParsePolicy{Mode: CANParseSkip}, func(*CANSample) bool { return true })
+	require.NoError(t, err)
+	require.NotNil(t, report.Diagnostics)
+	assert.Equal(t, 7, report.Diagnostics.Frames)
+	assert.Equal(t, 3, report.Diagnostics.Responses)
+	// can1（通道2）上的 0x7E8 不属于诊断配置，按 DBC 解码
+	assert.Equal(t, map[string]int{"0x7E8": 1}, report.UnknownIDs)
+	assert.Equal(t, []DiagnosticDTC{
+		{ECU: "ACU", Protocol: "uds", Service: 0x02, Code: "B1A00-17", Status: 0x09, Timestamp: 1620000000009},
+		{ECU: "ACU", Protocol: "uds", Service: 0x02, Code: "U1100-87", Status: 0xAF, Timestamp: 1620000000009},
+		{ECU: "ECM", Protocol: "obd", Service: 0x03, Code: "P0301", Timestamp: 1620000000006},
+		{ECU: "ECM", Protocol: "obd", Service: 0x03, Code: "P0133", Timestamp: 1620000000006},
+	}, report.Diagnostics.DTCs)
+}
@@ -0,0 +1,332 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.einride.tech/can/pkg/dbc"
+)
+
+// E2EProfile AUTOSAR E2E 保护的配置文件（Profile）编号
+type E2EProfile int
+
+const (
+	E2EProfile1 E2EProfile = 1 // CRC8 SAE J1850 + 4位计数器，Data ID 高低字节都参与计算
+	E2EProfile2 E2EProfile = 2 // CRC8H2F + 4位计数器，按计数器从 Data ID 列表中取值参与计算
+	E2EProfile5 E2EProfile = 5 // CRC16 CCITT + 8位计数器
+)
+
+// E2EAction E2E 校验失败时对该帧的处理方式
+type E2EAction string
+
+const (
+	E2EDiscard E2EAction = "discard" // 丢弃该帧的全部信号（默认）
+	E2EFlag    E2EAction = "flag"    // 保留信号值，但作为 e2e 类型的传感器故障输出，不参与阈值判断
+)
+
+// E2EConfig 单个报文的 E2E 保护参数，偏移量以位为单位
+type E2EConfig struct {
+	Profile         E2EProfile `yaml:"profile" json:"profile"`
+	DataID          uint16     `yaml:"data_id" json:"data_id"`                     // Profile 1/5 的 Data ID
+	DataIDList      []uint8    `yaml:"data_id_list" json:"data_id_list"`           // Profile 2 的16个 Data ID
+	CRCOffset       int        `yaml:"crc_offset" json:"crc_offset"`               // CRC 起始位，默认0
+	CounterOffset   int        `yaml:"counter_offset" json:"counter_offset"`       // 计数器起始位，0 表示使用 Profile 默认位置
+	MaxDeltaCounter int        `yaml:"max_delta_counter" json:"max_delta_counter"` // 相邻两帧计数器允许的最大增量，默认1
+	Action          E2EAction  `yaml:"action" json:"action"`                       // 校验失败时的处理方式，默认 discard
+}
+
+// Validate 检查配置并补全默认值
+func (c *E2EConfig) Validate() error {
+	switch c.Profile {
+	case E2EProfile1:
+		if c.CRCOffset%8 != 0 || c.CounterOffset%4 != 0 {
+			return fmt.Errorf("E2E Profile 1 的 CRC 偏移必须按字节对齐、计数器偏移必须按半字节对齐")
+		}
+		if c.CounterOffset == 0 {
+			c.CounterOffset = 8
+		}
+	case E2EProfile2:
+		if len(c.DataIDList) != 16 {
+			return fmt.Errorf("E2E Profile 2 需要16个 Data ID，实际为 %d 个", len(c.DataIDList))
+		}
+		if c.CRCOffset != 0 || c.CounterOffset != 0 && c.CounterOffset != 8 {
+			return fmt.Errorf("E2E Profile 2 的 CRC 和计数器位置固定，不能配置偏移")
+		}
+		c.CounterOffset = 8
+	case E2EProfile5:
+		if c.CRCOffset%8 != 0 || c.CounterOffset%8 != 0 {
+			return fmt.Errorf("E2E Profile 5 的 CRC 和计数器偏移必须按字节对齐")
+		}
+		if c.CounterOffset == 0 {
+			c.CounterOffset = c.CRCOffset + 16
+		}
+	default:
+		return fmt.Errorf("不支持的 E2E Profile: %d", c.Profile)
+	}
+	if c.CRCOffset < 0 || c.CounterOffset < 0 {
+		return fmt.Errorf("E2E 偏移不能为负数")
+	}
+	if c.MaxDeltaCounter < 0 || c.MaxDeltaCounter >= c.counterModulo() {
+		return fmt.Errorf("E2E 计数器最大增量无效: %d", c.MaxDeltaCounter)
+	}
+	if c.MaxDeltaCounter == 0 {
+		c.MaxDeltaCounter = 1
+	}
+	switch c.Action {
+	case "":
+		c.Action = E2EDiscard
+	case E2EDiscard, E2EFlag:
+	default:
+		return fmt.Errorf("未知的 E2E 失败处理方式 '%s'，可选 discard、flag", c.Action)
+	}
+	return nil
+}
+
+// counterModulo 计数器的取值个数；Profile 1 的计数器取值0~14，15为无效值
+func (c *E2EConfig) counterModulo() int {
+	switch c.Profile {
+	case E2EProfile1:
+		return 15
+	case E2EProfile2:
+		return 16
+	default:
+		return 256
+	}
+}
+
+// minLength 报文至少需要的字节数
+func (c *E2EConfig) minLength() int {
+	crcEnd := c.CRCOffset/8 + 1
+	if c.Profile == E2EProfile5 {
+		crcEnd++
+	}
+	counterEnd := c.CounterOffset/8 + 1
+	return max(crcEnd, counterEnd)
+}
+
+// E2EFailureKind E2E 校验失败的类型
+type E2EFailureKind string
+
+const (
+	E2EWrongCRC       E2EFailureKind = "crc"       // CRC 不匹配
+	E2ERepeated       E2EFailureKind = "repeated"  // 计数器与上一帧相同，数据未更新
+	E2EWrongSequence  E2EFailureKind = "sequence"  // 计数器跳变超过允许的增量，中间有帧丢失
+	E2EInvalidCounter E2EFailureKind = "counter"   // 计数器取值无效
+	E2EShortFrame     E2EFailureKind = "too_short" // 数据长度不足以容纳 CRC 和计数器
+)
+
+// E2EFailure 一帧 E2E 校验失败的信息
+type E2EFailure struct {
+	ID       uint32
+	Extended bool
+	Kind     E2EFailureKind
+	Action   E2EAction
+}
+
+// key 返回报告中使用的统计键，如 0x1A0/crc
+func (f *E2EFailure) key() string {
+	return canIDKey(f.ID, f.Extended) + "/" + string(f.Kind)
+}
+
+func (f *E2EFailure) String() string {
+	return fmt.Sprintf("CAN ID %X E2E 校验失败: %s", f.ID, f.Kind)
+}
+
+// e2eCounterKey 计数器状态按报文和通道分别记录
+type e2eCounterKey struct {
+	msg     *compiledMessage
+	channel int
+}
+
+// e2eCheck 校验一帧报文并更新计数器状态，通过时返回空字符串。
+// CRC 不匹配的帧不更新计数器；计数器异常的帧以新计数器值重新同步。
+func e2eCheck(cfg *E2EConfig, data []byte, last map[e2eCounterKey]int, key e2eCounterKey) E2EFailureKind {
+	if len(data) < cfg.minLength() {
+		return E2EShortFrame
+	}
+	if e2eCRC(cfg, data) != e2eStoredCRC(cfg, data) {
+		return E2EWrongCRC
+	}
+
+	var counter int
+	switch cfg.Profile {
+	case E2EProfile5:
+		counter = int(data[cfg.CounterOffset/8])
+	default:
+		counter = int(data[cfg.CounterOffset/8] >> (cfg.CounterOffset % 8) & 0x0F)
+	}
+	modulo := cfg.counterModulo()
+	if counter >= modulo {
+		return E2EInvalidCounter
+	}
+	previous, seen := last[key]
+	last[key] = counter
+	if !seen {
+		return ""
+	}
+	switch delta := (counter - previous + modulo) % modulo; {
+	case delta == 0:
+		return E2ERepeated
+	case delta > cfg.MaxDeltaCounter:
+		return E2EWrongSequence
+	}
+	return ""
+}
+
+// e2eStoredCRC 读取报文中携带的 CRC，Profile 5 为小端16位
+func e2eStoredCRC(cfg *E2EConfig, data []byte) uint16 {
+	i := cfg.CRCOffset / 8
+	if cfg.Profile == E2EProfile5 {
+		return uint16(data[i]) | uint16(data[i+1])<<8
+	}
+	return uint16(data[i])
+}
+
+// e2eCRC 按 Profile 计算报文的 CRC，CRC 所在字节不参与计算。
+// AUTOSAR Crc 库在非首次调用时会抵消上一段的结果异或，分段计算等价于下面的连续计算。
+func e2eCRC(cfg *E2EConfig, data []byte) uint16 {
+	crcIndex := cfg.CRCOffset / 8
+	switch cfg.Profile {
+	case E2EProfile1:
+		// Data ID 模式为 BOTH：先低字节后高字节
+		crc := crc8(0x1D, 0x00, []byte{byte(cfg.DataID), byte(cfg.DataID >> 8)})
+		crc = crc8(0x1D, crc, data[:crcIndex])
+		return uint16(crc8(0x1D, crc, data[crcIndex+1:]))
+	case E2EProfile2:
+		counter := data[1] & 0x0F
+		// Crc_CalculateCRC8H2F 首次调用起始值为 0xFF
+		crc := crc8(0x2F, 0xFF, data[1:])
+		return uint16(crc8(0x2F, crc, []byte{cfg.DataIDList[counter]}) ^ 0xFF)
+	default:
+		crc := crc16CCITT(0xFFFF, data[:crcIndex])
+		crc = crc16CCITT(crc, data[crcIndex+2:])
+		return crc16CCITT(crc, []byte{byte(cfg.DataID), byte(cfg.DataID >> 8)})
+	}
+}
+
+// crc8 不反射、不做结果异或的 CRC8
+func crc8(poly, crc byte, data []byte) byte {
+	for _, b := range data {
+		crc ^= b
+		for range 8 {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// crc16CCITT 多项式 0x1021、不反射、不做结果异或的 CRC16
+func crc16CCITT(crc uint16, data []byte) uint16 {
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// DBC 中描述 E2E 保护的报文属性
+const (
+	dbcAttrE2EProfile         = "E2EProfile"         // 1、2、5 或 P01、P02、P05
+	dbcAttrE2EDataID          = "E2EDataID"          // Profile 1/5 的 Data ID
+	dbcAttrE2EDataIDList      = "E2EDataIDList"      // Profile 2 的 Data ID 列表，逗号分隔
+	dbcAttrE2ECRCOffset       = "E2ECRCOffset"       // CRC 起始位
+	dbcAttrE2ECounterOffset   = "E2ECounterOffset"   // 计数器起始位
+	dbcAttrE2EMaxDeltaCounter = "E2EMaxDeltaCounter" // 计数器允许的最大增量
+)
+
+// dbcMessageAttributes 按报文ID收集 BA_ 定义的报文属性
+func dbcMessageAttributes(db *dbc.File) map[dbc.MessageID]map[string]*dbc.AttributeValueForObjectDef {
+	attrs := make(map[dbc.MessageID]map[string]*dbc.AttributeValueForObjectDef)
+	for _, def := range db.Defs {
+		a, ok := def.(*dbc.AttributeValueForObjectDef)
+		if !ok || a.ObjectType != dbc.ObjectTypeMessage {
+			continue
+		}
+		if attrs[a.MessageID] == nil {
+			attrs[a.MessageID] = make(map[string]*dbc.AttributeValueForObjectDef)
+		}
+		attrs[a.MessageID][string(a.AttributeName)] = a
+	}
+	return attrs
+}
+
+// attributeInt 读取整数属性，字符串形式的值按十进制或 0x 十六进制解析
+func attributeInt(a *dbc.AttributeValueForObjectDef) (int64, error) {
+	if a.StringValue == "" {
+		if a.FloatValue != 0 {
+			return int64(a.FloatValue), nil
+		}
+		return a.IntValue, nil
+	}
+	s := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(a.StringValue)), "P")
+	return strconv.ParseInt(strings.ToLower(s), 0, 64)
+}
+
+// e2eConfigFromAttributes 从 DBC 报文属性读取 E2E 配置，未配置 E2EProfile 时返回 nil
+func e2eConfigFromAttributes(attrs map[string]*dbc.AttributeValueForObjectDef) (*E2EConfig, error) {
+	profile, ok := attrs[dbcAttrE2EProfile]
+	if !ok {
+		return nil, nil
+	}
+	var cfg E2EConfig
+	n, err := attributeInt(profile)
+	if err != nil {
+		return nil, fmt.Errorf("属性 %s 无效: %w", dbcAttrE2EProfile, err)
+	}
+	cfg.Profile = E2EProfile(n)
+	for name, field := range map[string]*int{
+		dbcAttrE2ECRCOffset:       &cfg.CRCOffset,
+		dbcAttrE2ECounterOffset:   &cfg.CounterOffset,
+		dbcAttrE2EMaxDeltaCounter: &cfg.MaxDeltaCounter,
+	} {
+		if a, ok := attrs[name]; ok {
+			n, err := attributeInt(a)
+			if err != nil {
+				return nil, fmt.Errorf("属性 %s 无效: %w", name, err)
+			}
+			*field = int(n)
+		}
+	}
+	if a, ok := attrs[dbcAttrE2EDataID]; ok {
+		n, err := attributeInt(a)
+		if err == nil && (n < 0 || n > 0xFFFF) {
+			err = fmt.Errorf("超出16位范围: %d", n)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("属性 %s 无效: %w", dbcAttrE2EDataID, err)
+		}
+		cfg.DataID = uint16(n)
+	}
+	if a, ok := attrs[dbcAttrE2EDataIDList]; ok {
+		for _, item := range strings.Split(a.StringValue, ",") {
+			n, err := strconv.ParseUint(strings.TrimSpace(item), 0, 8)
+			if err != nil {
+				return nil, fmt.Errorf("属性 %s 无效: %w", dbcAttrE2EDataIDList, err)
+			}
+			cfg.DataIDList = append(cfg.DataIDList, uint8(n))
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// E2EMessageConfig 在 DBC 之外为某个报文配置 E2E 保护，覆盖 DBC 属性中的配置
+type E2EMessageConfig struct {
+	ID        uint32 `yaml:"id"`       // CAN ID，超出11位时按扩展帧处理
+	Extended  bool   `yaml:"extended"` // 是否为扩展帧
+	Channel   int    `yaml:"channel"`  // 报文所在总线，0 表示所有通道
+	E2EConfig `yaml:",inline"`
+}
@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const e2eTestDBC = `VERSION ""
+
+BO_ 160 Airbag: 8 ACU
+ SG_ CrashDetected : 16|8@1+ (1,0) [0|1] "" Vector__XXX
+
+BO_ 161 Restraint: 8 ACU
+ SG_ BeltTension : 24|8@1+ (1,0) [0|200] "N" Vector__XXX
+
+BA_DEF_ BO_ "E2EProfile" STRING ;
+BA_DEF_ BO_ "E2EDataID" INT 0 65535;
+BA_ "E2EProfile" BO_ 160 "P01";
+BA_ "E2EDataID" BO_ 160 288;
+`
+
+func TestE2ECRCAlgorithms(t *testing.T) {
+	check := []byte("123456789")
+	// 标准校验值：CRC-8/SAE-J1850、CRC-8/AUTOSAR(0x2F)、CRC-16/CCITT-FALSE
+	assert.Equal(t, byte(0x4B), crc8(0x1D, 0xFF, check)^0xFF)
+	assert.Equal(t, byte(0xDF), crc8(0x2F, 0xFF, check)^0xFF)
+	assert.Equal(t, uint16(0x29B1), crc16CCITT(0xFFFF, check))
+
+	// AUTOSAR SWS_Crc 中的校验值表
+	for _, tc := range []struct {
+		data  string
+		crc8  byte
+		crc8H byte
+		crc16 uint16
+	}{
+		{"00000000", 0x59, 0x12, 0x84C0},
+		{"F20183", 0x37, 0xC2, 0xD374},
+		{"0FAA0055", 0x79, 0xC6, 0x2023},
+		{"00FF5511", 0xB8, 0x77, 0xB8F9},
+		{"332255AABBCCDDEEFF", 0xCB, 0x11, 0xF53F},
+		{"926B55", 0x8C, 0x33, 0x0745},
+		{"FFFFFFFF", 0x74, 0x6C, 0x1D0F},
+	} {
+		data, err := hex.DecodeString(tc.data)
+		require.NoError(t, err)
+		assert.Equal(t, tc.crc8, crc8(0x1D, 0xFF, data)^0xFF, tc.data)
+		assert.Equal(t, tc.crc8H, crc8(0x2F, 0xFF, data)^0xFF, tc.data)
+		assert.Equal(t, tc.crc16, crc16CCITT(0xFFFF, data), tc.data)
+	}
+}
+
+func TestE2EReferenceFrames(t *testing.T) {
+	// CRC 由按 AUTOSAR E2E_P01/P02/P05Protect 调用顺序实现的独立参考程序计算，不使用 e2eCRC
+	dataIDList := make([]uint8, 16)
+	for i := range dataIDList {
+		dataIDList[i] = uint8(0x10 + i)
+	}
+	for _, tc := range []struct {
+		name  string
+		cfg   E2EConfig
+		frame string
+	}{
+		{"P01", E2EConfig{Profile: E2EProfile1, DataID: 0x0120}, "9503112233445566"},
+		{"P02", E2EConfig{Profile: E2EProfile2, DataIDList: dataIDList}, "F805112233445566"},
+		{"P05", E2EConfig{Profile: E2EProfile5, DataID: 0x1234}, "39CF071122334455"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, tc.cfg.Validate())
+			data, err := hex.DecodeString(tc.frame)
+			require.NoError(t, err)
+			assert.Equal(t, e2eStoredCRC(&tc.cfg, data), e2eCRC(&tc.cfg, data))
+			assert.Empty(t, e2eCheck(&tc.cfg, data, map[e2eCounterKey]int{}, e2eCounterKey{}))
+
+			data[len(data)-1] ^= 0x01
+			assert.Equal(t, E2EWrongCRC, e2eCheck(&tc.cfg, data, map[e2eCounterKey]int{}, e2eCounterKey{}))
+		})
+	}
+}
+
+// e2eFrame 按配置填入计数器并计算 CRC
+func e2eFrame(t *testing.T, id uint32, cfg *E2EConfig, counter byte, payload ...byte) *CANFrame {
+	t.Helper()
+	data := make([]byte, 8)
+	copy(data[2:], payload)
+	if cfg.Profile == E2EProfile5 {
+		data[cfg.CounterOffset/8] = counter
+	} else {
+		data[1] = counter
+	}
+	crc := e2eCRC(cfg, data)
+	data[0] = byte(crc)
+	if cfg.Profile == E2EProfile5 {
+		data[1] = byte(crc >> 8)
+	}
+	return &CANFrame{ID: id, Data: data}
+}
+
+func TestCANParserE2E(t *testing.T) {
+	p := newTestParser(t, e2eTestDBC, "CrashDetected")
+	cfg := p.db.messages[messageKey{id: 160}].e2e
+	require.NotNil(t, cfg)
+	assert.Equal(t, E2EConfig{Profile: E2EProfile1, DataID: 288, CounterOffset: 8, MaxDeltaCounter: 1, Action: E2EDiscard}, *cfg)
+
+	parse := func(frame *CANFrame) (map[string]float64, E2EFailureKind) {
+		signals, err := p.ParseFrame(frame)
+		require.NoError(t, err)
+		if f := p.E2EFailure(); f != nil {
+			return signals, f.Kind
+		}
+		return signals, ""
+	}
+
+	signals, kind := parse(e2eFrame(t, 160, cfg, 14, 0))
+	assert.Equal(t, map[string]float64{"CrashDetected": 0}, signals)
+	assert.Empty(t, kind)
+	// Profile 1 计数器 14 之后回绕到 0
+	_, kind = parse(e2eFrame(t, 160, cfg, 0, 0))
+	assert.Empty(t, kind)
+
+	corrupt := e2eFrame(t, 160, cfg, 1, 0)
+	corrupt.Data[2] = 1 // CRC 计算后篡改碰撞信号
+	signals, kind = parse(corrupt)
+	assert.Empty(t, signals)
+	assert.Equal(t, E2EWrongCRC, kind)
+
+	_, kind = parse(e2eFrame(t, 160, cfg, 1, 0))
+	assert.Empty(t, kind)
+	_, kind = parse(e2eFrame(t, 160, cfg, 1, 0))
+	assert.Equal(t, E2ERepeated, kind)
+	_, kind = parse(e2eFrame(t, 160, cfg, 3, 1))
+	assert.Equal(t, E2EWrongSequence, kind)
+	_, kind = parse(e2eFrame(t, 160, cfg, 15, 1))
+	assert.Equal(t, E2EInvalidCounter, kind)
+	_, kind = parse(&CANFrame{ID: 160, Data: []byte{0}})
+	assert.Equal(t, E2EShortFrame, kind)
+}
+
+func TestCANDecoderE2EConfig(t *testing.T) {
+	db, err := ParseDBC("e2e.dbc", []byte(e2eTestDBC))
+	require.NoError(t, err)
+	decoder, err := NewCANDecoder([]DBCBinding{{DBC: CompileDBC(db)}}, []string{"BeltTension"}, nil)
+	require.NoError(t, err)
+
+	assert.Error(t, decoder.SetE2EConfig([]E2EMessageConfig{{ID: 0x7FF, E2EConfig: E2EConfig{Profile: E2EProfile5}}}))
+	assert.Error(t, decoder.SetE2EConfig([]E2EMessageConfig{{ID: 161, E2EConfig: E2EConfig{Profile: E2EProfile2}}}))
+	cfg := E2EConfig{Profile: E2EProfile5, DataID: 0x1234, Action: E2EFlag}
+	require.NoError(t, decoder.SetE2EConfig([]E2EMessageConfig{{ID: 161, E2EConfig: cfg}}))
+	require.NoError(t, cfg.Validate())
+
+	ok := e2eFrame(t, 161, &cfg, 7, 0, 100)
+	bad := e2eFrame(t, 161, &cfg, 8, 0, 100)
+	bad.Data[0] ^= 0xFF
+	path := writeTestFile(t, "trace.can", "(1620000000.001000) can0 0A1#"+fmt.Sprintf("%X", ok.Data)+"\n"+
+		"(1620000000.002000) can0 0A1#"+fmt.Sprintf("%X", bad.Data)+"\n")
+
+	var samples []*CANSample
+	report, err := StreamCANLogWithPolicy(path, decoder, CANParsePolicy{}, func(sample *CANSample) bool {
+		samples = append(samples, sample)
+		return true
+	})
+	require.NoError(t, err)
+	require.Len(t, samples, 2)
+	assert.Equal(t, 100.0, samples[0].Signals["BeltTension"])
+	assert.Empty(t, samples[1].Signals)
+	assert.Equal(t, SignalFault{Kind: SignalFaultE2E, Value: 100, Label: string(E2EWrongCRC)}, samples[1].Faults["BeltTension"])
+	assert.Equal(t, map[string]int{"0xA1/crc": 1}, report.E2EFailures)
+}
@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CANExportFormat 解码结果的导出格式
+type CANExportFormat string
+
+const (
+	CANExportCSV     CANExportFormat = "csv"
+	CANExportJSONL   CANExportFormat = "jsonl"
+	CANExportParquet CANExportFormat = "parquet"
+)
+
+// CANExportLayout 解码结果的导出布局
+type CANExportLayout string
+
+const (
+	CANExportWide CANExportLayout = "wide" // 每个时间点一行，每个信号一列
+	CANExportLong CANExportLayout = "long" // 每个信号值一行：timestamp, signal, value
+)
+
+// CANExportFormatFromPath 按输出文件扩展名推断导出格式，无法识别时返回 csv
+func CANExportFormatFromPath(p string) CANExportFormat {
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".jsonl", ".ndjson":
+		return CANExportJSONL
+	case ".parquet":
+		return CANExportParquet
+	default:
+		return CANExportCSV
+	}
+}
+
+// CANSampleWriter 把解码后的样本按指定格式写出
+type CANSampleWriter interface {
+	WriteSample(sample *CANSample) error
+	// Close 写出缓冲数据和文件尾，不关闭底层 io.Writer
+	Close() error
+}
+
+// NewCANSampleWriter 创建导出写入器。signals 为宽表的列顺序，长表中只输出这些信号。
+func NewCANSampleWriter(w io.Writer, format CANExportFormat, layout CANExportLayout, signals []string) (CANSampleWriter, error) {
+	if layout != CANExportWide && layout != CANExportLong {
+		return nil, fmt.Errorf("未知的导出布局 '%s'", layout)
+	}
+	switch format {
+	case CANExportCSV:
+		return newCSVSampleWriter(w, layout, signals)
+	case CANExportJSONL:
+		return &jsonlSampleWriter{w: bufio.NewWriter(w), layout: layout, signals: signals}, nil
+	case CANExportParquet:
+		return newParquetSampleWriter(w, layout, signals), nil
+	default:
+		return nil, fmt.Errorf("未知的导出格式 '%s'", format)
+	}
+}
+
+// csvSampleWriter 以 CSV 写出样本，宽表中样本缺少的信号留空
+type csvSampleWriter struct {
+	w       *csv.Writer
+	layout  CANExportLayout
+	signals []string
+	row     []string
+}
+
+func newCSVSampleWriter(w io.Writer, layout CANExportLayout, signals []string) (*csvSampleWriter, error) {
+	c := &csvSampleWriter{w: csv.NewWriter(w), layout: layout, signals: signals}
+	header := []string{"timestamp", "signal", "value"}
+	if layout == CANExportWide {
+		header = append([]string{"timestamp"}, signals...)
+	}
+	if err := c.w.Write(header); err != nil {
+		return nil, fmt.Errorf("写入 CSV 表头失败: %w", err)
+	}
+	return c, nil
+}
+
+func (c *csvSampleWriter) WriteSample(sample *CANSample) error {
+	ts := strconv.FormatInt(sample.Timestamp, 10)
+	if c.layout == CANExportWide {
+		c.row = append(c.row[:0], ts)
+		for _, name := range c.signals {
+			value, ok := sample.Signals[name]
+			if !ok {
+				c.row = append(c.row, "")
+				continue
+			}
+			c.row = append(c.row, strconv.FormatFloat(value, 'g', -1, 64))
+		}
+		return c.w.Write(c.row)
+	}
+	for _, name := range c.signals {
+		value, ok := sample.Signals[name]
+		if !ok {
+			continue
+		}
+		if err := c.w.Write([]string{ts, name, strconv.FormatFloat(value, 'g', -1, 64)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *csvSampleWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonlSampleWriter 以 JSON Lines 写出样本，宽表每行一个对象，信号名为键；NaN 和无穷大写为 null
+type jsonlSampleWriter struct {
+	w       *bufio.Writer
+	layout  CANExportLayout
+	signals []string
+	line    []byte
+}
+
+func (j *jsonlSampleWriter) WriteSample(sample *CANSample) error {
+	if j.layout == CANExportWide {
+		j.line = append(j.line[:0], `{"timestamp":`...)
+		j.line = strconv.AppendInt(j.line, sample.Timestamp, 10)
+		for _, name := range j.signals {
+			value, ok := sample.Signals[name]
+			if !ok {
+				continue
+			}
+			j.line = append(j.line, ',')
+			j.line = appendJSONString(j.line, name)
+			j.line = append(j.line, ':')
+			j.line = appendJSONFloat(j.line, value)
+		}
+		j.line = append(j.line, "}\n"...)
+		_, err := j.w.Write(j.line)
+		return err
+	}
+	for _, name := range j.signals {
+		value, ok := sample.Signals[name]
+		if !ok {
+			continue
+		}
+		j.line = append(j.line[:0], `{"timestamp":`...)
+		j.line = strconv.AppendInt(j.line, sample.Timestamp, 10)
+		j.line = append(j.line, `,"signal":`...)
+		j.line = appendJSONString(j.line, name)
+		j.line = append(j.line, `,"value":`...)
+		j.line = appendJSONFloat(j.line, value)
+		j.line = append(j.line, "}\n"...)
+		if _, err := j.w.Write(j.line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *jsonlSampleWriter) Close() error {
+	return j.w.Flush()
+}
+
+func appendJSONString(b []byte, s string) []byte {
+	quoted, _ := json.Marshal(s)
+	return append(b, quoted...)
+}
+
+func appendJSONFloat(b []byte, v float64) []byte {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return append(b, "null"...)
+	}
+	return strconv.AppendFloat(b, v, 'g', -1, 64)
+}
+
+// MatchSignalNames 按过滤规则从 names 中选出信号，保持原有顺序。
+// 规则为 glob 通配符（如 Wheel*），以 re: 开头时为正则表达式；没有规则时返回全部信号。
+func MatchSignalNames(names, patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		return names, nil
+	}
+	matchers := make([]func(string) bool, 0, len(patterns))
+	for _, p := range patterns {
+		if expr, ok := strings.CutPrefix(p, "re:"); ok {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("信号过滤正则表达式无效 '%s': %w", expr, err)
+			}
+			matchers = append(matchers, re.MatchString)
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("信号过滤通配符无效 '%s': %w", p, err)
+		}
+		matchers = append(matchers, func(name string) bool {
+			ok, _ := path.Match(p, name)
+			return ok
+		})
+	}
+
+	var matched []string
+	for _, name := range names {
+		for _, match := range matchers {
+			if match(name) {
+				matched = append(matched, name)
+				break
+			}
+		}
+	}
+	return matched, nil
+}
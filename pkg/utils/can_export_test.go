@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var exportTestSamples = []*CANSample{
+	{Timestamp: 1001, Signals: map[string]float64{"A": 1.5, "B": 2}},
+	{Timestamp: 1004, Signals: map[string]float64{"B": math.NaN()}},
+}
+
+func writeExportTestSamples(t *testing.T, format CANExportFormat, layout CANExportLayout) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewCANSampleWriter(&buf, format, layout, []string{"A", "B"})
+	require.NoError(t, err)
+	for _, s := range exportTestSamples {
+		require.NoError(t, w.WriteSample(s))
+	}
+	require.NoError(t, w.Close())
+	return buf.String()
+}
+
+func TestCANSampleWriterText(t *testing.T) {
+	assert.Equal(t, "timestamp,A,B\n1001,1.5,2\n1004,,NaN\n", writeExportTestSamples(t, CANExportCSV, CANExportWide))
+	assert.Equal(t, "timestamp,signal,value\n1001,A,1.5\n1001,B,2\n1004,B,NaN\n", writeExportTestSamples(t, CANExportCSV, CANExportLong))
+	assert.Equal(t, `{"timestamp":1001,"A":1.5,"B":2}
+{"timestamp":1004,"B":null}
+`, writeExportTestSamples(t, CANExportJSONL, CANExportWide))
+	assert.Equal(t, `{"timestamp":1001,"signal":"A","value":1.5}
+{"timestamp":1001,"signal":"B","value":2}
+{"timestamp":1004,"signal":"B","value":null}
+`, writeExportTestSamples(t, CANExportJSONL, CANExportLong))
+
+	_, err := NewCANSampleWriter(&bytes.Buffer{}, "xlsx", CANExportWide, nil)
+	assert.Error(t, err)
+	_, err = NewCANSampleWriter(&bytes.Buffer{}, CANExportCSV, "tall", nil)
+	assert.Error(t, err)
+	assert.Equal(t, CANExportParquet, CANExportFormatFromPath("out.PARQUET"))
+	assert.Equal(t, CANExportJSONL, CANExportFormatFromPath("out.jsonl"))
+	assert.Equal(t, CANExportCSV, CANExportFormatFromPath(""))
+}
+
+func TestMatchSignalNames(t *testing.T) {
+	names := []string{"WheelSpeedFL", "WheelSpeedFR", "LongitudinalAcceleration", "LateralAcceleration"}
+	got, err := MatchSignalNames(names, nil)
+	require.NoError(t, err)
+	assert.Equal(t, names, got)
+
+	got, err = MatchSignalNames(names, []string{"Wheel*", "re:^Lat"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"WheelSpeedFL", "WheelSpeedFR", "LateralAcceleration"}, got)
+
+	_, err = MatchSignalNames(names, []string{"re:("})
+	assert.Error(t, err)
+	_, err = MatchSignalNames(names, []string{"["})
+	assert.Error(t, err)
+}
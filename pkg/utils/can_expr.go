@@ -0,0 +1,272 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"unicode"
+)
+
+// SignalExpr 编译后的信号算术表达式，支持 + - * / ^、括号、数字、信号名和常用函数，
+// 如 sqrt(ax^2 + ay^2)、abs(yaw_rate) * 57.3
+type SignalExpr struct {
+	source string
+	vars   []string // 表达式引用的信号，按首次出现的顺序
+	eval   func(values []float64) float64
+}
+
+// exprFuncs 表达式中可用的函数及其参数个数
+var exprFuncs = map[string]struct {
+	args int
+	fn   func(args []float64) float64
+}{
+	"sqrt":  {1, func(a []float64) float64 { return math.Sqrt(a[0]) }},
+	"abs":   {1, func(a []float64) float64 { return math.Abs(a[0]) }},
+	"exp":   {1, func(a []float64) float64 { return math.Exp(a[0]) }},
+	"log":   {1, func(a []float64) float64 { return math.Log(a[0]) }},
+	"sin":   {1, func(a []float64) float64 { return math.Sin(a[0]) }},
+	"cos":   {1, func(a []float64) float64 { return math.Cos(a[0]) }},
+	"min":   {2, func(a []float64) float64 { return math.Min(a[0], a[1]) }},
+	"max":   {2, func(a []float64) float64 { return math.Max(a[0], a[1]) }},
+	"pow":   {2, func(a []float64) float64 { return math.Pow(a[0], a[1]) }},
+	"hypot": {2, func(a []float64) float64 { return math.Hypot(a[0], a[1]) }},
+	"atan2": {2, func(a []float64) float64 { return math.Atan2(a[0], a[1]) }},
+}
+
+// CompileSignalExpr 编译算术表达式
+func CompileSignalExpr(source string) (*SignalExpr, error) {
+	p := &exprParser{src: []rune(source), index: make(map[string]int)}
+	eval, err := p.expr()
+	if err == nil && p.peek() != 0 {
+		err = p.errorf("多余的字符 %q", string(p.src[p.pos:]))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("表达式 %q: %w", source, err)
+	}
+	return &SignalExpr{source: source, vars: p.vars, eval: eval}, nil
+}
+
+// Vars 返回表达式引用的信号名
+func (e *SignalExpr) Vars() []string {
+	return e.vars
+}
+
+// Eval 按信号取值计算表达式，引用的信号缺失时返回 false
+func (e *SignalExpr) Eval(signals map[string]float64) (float64, bool) {
+	values := make([]float64, len(e.vars))
+	for i, name := range e.vars {
+		v, ok := signals[name]
+		if !ok {
+			return 0, false
+		}
+		values[i] = v
+	}
+	return e.eval(values), true
+}
+
+func (e *SignalExpr) String() string {
+	return e.source
+}
+
+// exprParser 递归下降解析，运算符优先级从低到高为 + -、* /、一元负号、^（右结合）
+type exprParser struct {
+	src   []rune
+	pos   int
+	vars  []string
+	index map[string]int
+}
+
+type exprNode = func(values []float64) float64
+
+func (p *exprParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("位置%d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+// peek 跳过空白并返回下一个字符，结束时返回0
+func (p *exprParser) peek() rune {
+	for p.pos < len(p.src) && unicode.IsSpace(p.src[p.pos]) {
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *exprParser) expr() (exprNode, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == '+' {
+			left = func(v []float64) float64 { return l(v) + right(v) }
+		} else {
+			left = func(v []float64) float64 { return l(v) - right(v) }
+		}
+	}
+}
+
+func (p *exprParser) term() (exprNode, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == '*' {
+			left = func(v []float64) float64 { return l(v) * right(v) }
+		} else {
+			left = func(v []float64) float64 { return l(v) / right(v) }
+		}
+	}
+}
+
+func (p *exprParser) unary() (exprNode, error) {
+	if p.peek() == '-' {
+		p.pos++
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(v []float64) float64 { return -operand(v) }, nil
+	}
+	if p.peek() == '+' {
+		p.pos++
+		return p.unary()
+	}
+	return p.power()
+}
+
+func (p *exprParser) power() (exprNode, error) {
+	base, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != '^' {
+		return base, nil
+	}
+	p.pos++
+	exponent, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return func(v []float64) float64 { return math.Pow(base(v), exponent(v)) }, nil
+}
+
+func (p *exprParser) primary() (exprNode, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, p.errorf("表达式不完整")
+	case c == '(':
+		p.pos++
+		inner, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.errorf("缺少 )")
+		}
+		p.pos++
+		return inner, nil
+	case unicode.IsDigit(c) || c == '.':
+		return p.number()
+	case unicode.IsLetter(c) || c == '_':
+		return p.identifier()
+	}
+	return nil, p.errorf("无法识别的字符 %q", c)
+}
+
+func (p *exprParser) number() (exprNode, error) {
+	start := p.pos
+	for p.pos < len(p.src) && (unicode.IsDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+		p.pos++
+	}
+	// 科学计数法，如 9.8e-1
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		p.pos++
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		for p.pos < len(p.src) && unicode.IsDigit(p.src[p.pos]) {
+			p.pos++
+		}
+	}
+	text := string(p.src[start:p.pos])
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("无效的数字 %q", text)
+	}
+	return func([]float64) float64 { return n }, nil
+}
+
+func (p *exprParser) identifier() (exprNode, error) {
+	start := p.pos
+	for p.pos < len(p.src) && (unicode.IsLetter(p.src[p.pos]) || unicode.IsDigit(p.src[p.pos]) || p.src[p.pos] == '_') {
+		p.pos++
+	}
+	name := string(p.src[start:p.pos])
+	if p.peek() != '(' {
+		i, ok := p.index[name]
+		if !ok {
+			i = len(p.vars)
+			p.index[name] = i
+			p.vars = append(p.vars, name)
+		}
+		return func(v []float64) float64 { return v[i] }, nil
+	}
+
+	fn, ok := exprFuncs[name]
+	if !ok {
+		p.pos = start
+		return nil, p.errorf("未知函数 %s", name)
+	}
+	p.pos++
+	var args []exprNode
+	for {
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+	if p.peek() != ')' {
+		return nil, p.errorf("函数 %s 缺少 )", name)
+	}
+	p.pos++
+	if len(args) != fn.args {
+		return nil, p.errorf("函数 %s 需要 %d 个参数，实际 %d 个", name, fn.args, len(args))
+	}
+	return func(v []float64) float64 {
+		values := make([]float64, len(args))
+		for i, arg := range args {
+			values[i] = arg(v)
+		}
+		return fn.fn(values)
+	}, nil
+}
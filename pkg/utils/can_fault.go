@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+
+	"go.einride.tech/can/pkg/dbc"
+)
+
+// SignalFaultKind 信号值被判为传感器故障的类型
+type SignalFaultKind string
+
+const (
+	SignalFaultOutOfRange SignalFaultKind = "out_of_range" // 超出 DBC 定义的物理范围
+	SignalFaultInvalid    SignalFaultKind = "invalid"      // 取值为 VAL_ 中标记为 SNA/无效的值
+	SignalFaultSaturated  SignalFaultKind = "saturated"    // 原始值停在编码范围的上限或下限
+	SignalFaultNotFinite  SignalFaultKind = "not_finite"   // 浮点信号为 NaN 或无穷大
+	SignalFaultE2E        SignalFaultKind = "e2e"          // 所在报文 E2E 校验失败（action 为 flag 时）
+)
+
+// SignalFault 一个被判为传感器故障的信号值。故障值不会出现在解码结果中，不参与阈值判断。
+type SignalFault struct {
+	Kind  SignalFaultKind `json:"kind"`
+	Value float64         `json:"value"`           // 解码出的物理值
+	Min   float64         `json:"min,omitempty"`   // DBC 定义的物理范围，仅 out_of_range 时有效
+	Max   float64         `json:"max,omitempty"`   // DBC 定义的物理范围，仅 out_of_range 时有效
+	Label string          `json:"label,omitempty"` // invalid 时为 VAL_ 标签，e2e 时为失败类型
+}
+
+func (f SignalFault) String() string {
+	switch f.Kind {
+	case SignalFaultOutOfRange:
+		return fmt.Sprintf("取值 %g 超出DBC范围[%g, %g]", f.Value, f.Min, f.Max)
+	case SignalFaultInvalid:
+		return fmt.Sprintf("取值 %g 为无效值(%s)", f.Value, f.Label)
+	case SignalFaultSaturated:
+		return fmt.Sprintf("取值 %g 为编码范围极值，传感器饱和或卡死", f.Value)
+	case SignalFaultE2E:
+		return fmt.Sprintf("取值 %g 所在报文 E2E 校验失败(%s)", f.Value, f.Label)
+	default:
+		return fmt.Sprintf("取值 %g 不是有效数值", f.Value)
+	}
+}
+
+// invalidLabelPattern 匹配表示信号不可用的 VAL_ 标签，如 SNA、Invalid、Not Available
+var invalidLabelPattern = regexp.MustCompile(`(?i)(\bSNA\b|invalid|not[ _]?available|无效)`)
+
+// signalSaturationMinSize 只对至少8位的信号检查原始值极值，更短的信号极值通常是正常取值
+const signalSaturationMinSize = 8
+
+// signalValidity 编译时从 DBC 计算出的信号有效性条件
+type signalValidity struct {
+	ranged   bool // DBC 定义了物理范围，[0|0] 表示未定义
+	minimum  float64
+	maximum  float64
+	margin   float64            // 范围比较的容差，取半个分辨率，避免 DBC 中范围取整造成误判
+	invalid  map[float64]string // 标记为无效的物理值及其标签
+	railLow  uint64             // 原始值的编码下限，rails 为真时检查
+	railHigh uint64             // 原始值的编码上限
+	rails    bool
+}
+
+// newSignalValidity 按信号定义和 VAL_ 标签计算有效性条件。
+// 原始值极值只对双极性（有符号或偏移为负）且没有取值标签的整数信号检查：
+// 这类信号通常是加速度、角速度等测量值，原始值停在编码极值表示传感器饱和。
+func newSignalValidity(sig *dbc.SignalDef, valueType dbc.SignalValueType, labels map[float64]string) signalValidity {
+	v := signalValidity{
+		ranged:  sig.Minimum != 0 || sig.Maximum != 0,
+		minimum: sig.Minimum,
+		maximum: sig.Maximum,
+		margin:  math.Abs(sig.Factor) / 2,
+	}
+	for value, label := range labels {
+		if invalidLabelPattern.MatchString(label) {
+			if v.invalid == nil {
+				v.invalid = make(map[float64]string)
+			}
+			v.invalid[value] = label
+		}
+	}
+	size := int(sig.Size)
+	if valueType == dbc.SignalValueTypeInt && len(labels) == 0 && size >= signalSaturationMinSize && size <= 64 {
+		switch {
+		case sig.IsSigned:
+			v.rails = true
+			v.railLow = 1 << (size - 1)
+			v.railHigh = v.railLow - 1
+		case sig.Offset < 0:
+			v.rails = true
+			v.railHigh = 1<<size - 1
+		}
+	}
+	return v
+}
+
+// check 检查解码出的物理值是否有效，有效时返回 nil
+func (v *signalValidity) check(bits uint64, value float64) *SignalFault {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return &SignalFault{Kind: SignalFaultNotFinite, Value: value}
+	}
+	if label, ok := v.invalid[value]; ok {
+		return &SignalFault{Kind: SignalFaultInvalid, Value: value, Label: label}
+	}
+	if v.rails && (bits == v.railLow || bits == v.railHigh) {
+		return &SignalFault{Kind: SignalFaultSaturated, Value: value}
+	}
+	if v.ranged && (value < v.minimum-v.margin || value > v.maximum+v.margin) {
+		return &SignalFault{Kind: SignalFaultOutOfRange, Value: value, Min: v.minimum, Max: v.maximum}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const faultTestDBC = `VERSION ""
+
+BO_ 256 Accel: 8 ACU
+ SG_ AccelX : 0|16@1- (0.000122,0) [-4|4] "g" Vector__XXX
+ SG_ Speed : 16|8@1+ (1,0) [0|250] "km/h" Vector__XXX
+ SG_ Status : 24|2@1+ (1,0) [0|3] "" Vector__XXX
+ SG_ Temp : 32|8@1+ (1,-40) [-40|215] "C" Vector__XXX
+
+BO_ 257 Yaw: 4 ACU
+ SG_ YawRate : 0|32@1- (1,0) [0|0] "deg/s" Vector__XXX
+
+SIG_VALTYPE_ 257 YawRate : 1;
+VAL_ 256 Status 0 "Off" 1 "On" 3 "SNA" ;
+`
+
+func TestCANParserSensorFaults(t *testing.T) {
+	p := newTestParser(t, faultTestDBC, "AccelX", "Speed", "Status", "Temp", "YawRate")
+
+	accel := func(raw uint16, speed, status, temp byte) []byte {
+		data := make([]byte, 8)
+		binary.LittleEndian.PutUint16(data, raw)
+		data[2], data[3], data[4] = speed, status, temp
+		return data
+	}
+
+	signals, err := p.ParseFrame(&CANFrame{ID: 0x100, Data: accel(0x2000, 100, 1, 60)})
+	require.NoError(t, err)
+	assert.InDelta(t, 0.999424, signals["AccelX"], 1e-9)
+	assert.Equal(t, 20.0, signals["Temp"])
+	assert.Empty(t, p.Faults())
+
+	// 0x7FFF 换算后约 4g，仍在 DBC 范围内，但原始值停在编码上限，按饱和处理
+	signals, err = p.ParseFrame(&CANFrame{ID: 0x100, Data: accel(0x7FFF, 251, 3, 0xFF)})
+	require.NoError(t, err)
+	assert.Empty(t, signals)
+	faults := p.Faults()
+	require.Len(t, faults, 4)
+	assert.Equal(t, SignalFaultSaturated, faults["AccelX"].Kind)
+	assert.Equal(t, SignalFault{Kind: SignalFaultOutOfRange, Value: 251, Min: 0, Max: 250}, faults["Speed"])
+	assert.Equal(t, SignalFault{Kind: SignalFaultInvalid, Value: 3, Label: "SNA"}, faults["Status"])
+	// 偏移为负的无符号信号同样检查编码极值
+	assert.Equal(t, SignalFaultSaturated, faults["Temp"].Kind)
+
+	_, err = p.ParseFrame(&CANFrame{ID: 0x100, Data: accel(0x8000, 0, 0, 0)})
+	require.NoError(t, err)
+	assert.Equal(t, SignalFaultSaturated, p.Faults()["AccelX"].Kind)
+	assert.Equal(t, SignalFaultSaturated, p.Faults()["Temp"].Kind)
+	assert.NotContains(t, p.Faults(), "Speed")
+
+	yaw := binary.LittleEndian.AppendUint32(nil, math.Float32bits(float32(math.NaN())))
+	signals, err = p.ParseFrame(&CANFrame{ID: 0x101, Data: yaw})
+	require.NoError(t, err)
+	assert.Empty(t, signals)
+	assert.Equal(t, SignalFaultNotFinite, p.Faults()["YawRate"].Kind)
+}
+
+func TestCANSampleStreamSensorFaults(t *testing.T) {
+	db, err := ParseDBC("fault.dbc", []byte(faultTestDBC))
+	require.NoError(t, err)
+	decoder, err := NewCANDecoder([]DBCBinding{{DBC: CompileDBC(db)}}, []string{"AccelX", "Speed"}, nil)
+	require.NoError(t, err)
+
+	path := writeTestFile(t, "trace.can", `(1620000000.001000) can0 100#0020640000000000
+(1620000000.002000) can0 100#FF7F640000000000
+(1620000000.003000) can0 100#FF7FFB0000000000
+`)
+	var samples []*CANSample
+	report, err := StreamCANLogWithPolicy(path, decoder, CANParsePolicy{}, func(sample *CANSample) bool {
+		samples = append(samples, sample)
+		return true
+	})
+	require.NoError(t, err)
+	require.Len(t, samples, 3)
+	assert.Nil(t, samples[0].Faults)
+	assert.Equal(t, map[string]float64{"Speed": 100}, samples[1].Signals)
+	assert.Equal(t, SignalFaultSaturated, samples[1].Faults["AccelX"].Kind)
+	assert.Empty(t, samples[2].Signals)
+	assert.Len(t, samples[2].Faults, 2)
+	assert.Equal(t, map[string]int{"AccelX": 2, "Speed": 1}, report.SensorFaults)
+	assert.Equal(t, 3, report.FramesDecoded)
+}
@@ -0,0 +1,111 @@
+package utils
+
+// ISO-TP（ISO 15765-2）协议控制信息类型，取首字节高4位
+const (
+	isotpSingleFrame      = 0
+	isotpFirstFrame       = 1
+	isotpConsecutiveFrame = 2
+	isotpFlowControl      = 3
+)
+
+// isotpTimeout 连续帧之间的最大间隔（N_Cr，1000ms），单位微秒
+const isotpTimeout = 1_000_000
+
+// isotpMaxSize 接收的最大报文长度，超过时视为异常帧，避免按错误的长度分配内存
+const isotpMaxSize = 1 << 16
+
+// isotpKey 重组会话按通道和 CAN ID 区分
+type isotpKey struct {
+	channel  int
+	id       uint32
+	extended bool
+}
+
+// isotpSession 进行中的多帧接收
+type isotpSession struct {
+	size int
+	data []byte
+	next byte  // 期望的下一个连续帧序号，0~15 循环
+	last int64 // 上一帧的时间戳
+}
+
+// isotpState 按正常寻址重组 ISO-TP 报文，扩展寻址和混合寻址的首字节为地址，不支持
+type isotpState struct {
+	sessions map[isotpKey]*isotpSession
+	messages int // 接收完成的报文数
+	errors   int // 序号错误、超时、长度错误或被新的首帧打断的传输
+}
+
+func newISOTPState() *isotpState {
+	return &isotpState{sessions: make(map[isotpKey]*isotpSession)}
+}
+
+// receive 处理一帧，报文接收完成时返回完整的应用层数据。流控帧由接收方发出，不影响重组。
+func (s *isotpState) receive(key isotpKey, data []byte, ts int64) ([]byte, bool) {
+	if len(data) == 0 {
+		return nil, false
+	}
+	switch data[0] >> 4 {
+	case isotpSingleFrame:
+		size, offset := int(data[0]&0xF), 1
+		if size == 0 && len(data) > canMaxClassicLen {
+			// CAN FD 单帧：长度在第二个字节
+			size, offset = int(data[1]), 2
+		}
+		if size == 0 || offset+size > len(data) {
+			s.errors++
+			return nil, false
+		}
+		s.messages++
+		return data[offset : offset+size], true
+
+	case isotpFirstFrame:
+		if _, busy := s.sessions[key]; busy {
+			s.errors++
+		}
+		if len(data) < 2 {
+			delete(s.sessions, key)
+			s.errors++
+			return nil, false
+		}
+		size, offset := int(data[0]&0xF)<<8|int(data[1]), 2
+		if size == 0 && len(data) >= 6 {
+			// 超过4095字节的报文使用32位长度
+			size, offset = int(data[2])<<24|int(data[3])<<16|int(data[4])<<8|int(data[5]), 6
+		}
+		if size <= len(data)-offset || size > isotpMaxSize {
+			delete(s.sessions, key)
+			s.errors++
+			return nil, false
+		}
+		session := &isotpSession{size: size, data: make([]byte, 0, size), next: 1, last: ts}
+		session.data = append(session.data, data[offset:]...)
+		s.sessions[key] = session
+		return nil, false
+
+	case isotpConsecutiveFrame:
+		session, ok := s.sessions[key]
+		if !ok {
+			return nil, false
+		}
+		if data[0]&0xF != session.next || ts-session.last > isotpTimeout {
+			delete(s.sessions, key)
+			s.errors++
+			return nil, false
+		}
+		session.data = append(session.data, data[1:min(len(data), 1+session.size-len(session.data))]...)
+		session.next = (session.next + 1) & 0xF
+		session.last = ts
+		if len(session.data) < session.size {
+			return nil, false
+		}
+		delete(s.sessions, key)
+		s.messages++
+		return session.data, true
+
+	case isotpFlowControl:
+		return nil, false
+	}
+	s.errors++
+	return nil, false
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestISOTPReceive(t *testing.T) {
+	s := newISOTPState()
+	key := isotpKey{id: 0x7E8}
+
+	payload, ok := s.receive(key, []byte{0x03, 0x59, 0x02, 0xFF, 0xAA, 0xAA, 0xAA, 0xAA}, 0)
+	assert.True(t, ok)
+	assert.Equal(t, []byte{0x59, 0x02, 0xFF}, payload)
+
+	// CAN FD 单帧的长度在第二个字节
+	fd := append([]byte{0x00, 9}, make([]byte, 10)...)
+	payload, ok = s.receive(key, fd, 0)
+	assert.True(t, ok)
+	assert.Len(t, payload, 9)
+
+	// 首帧 + 连续帧，最后一帧的填充字节不计入
+	_, ok = s.receive(key, []byte{0x10, 0x0B, 1, 2, 3, 4, 5, 6}, 1000)
+	assert.False(t, ok)
+	_, ok = s.receive(key, []byte{0x30, 0x00, 0x00}, 2000) // 流控帧
+	assert.False(t, ok)
+	payload, ok = s.receive(key, []byte{0x21, 7, 8, 9, 10, 11, 0xAA, 0xAA}, 3000)
+	assert.True(t, ok)
+	assert.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, payload)
+	assert.Equal(t, 3, s.messages)
+
+	// 序号错误和超时都中止接收
+	s.receive(key, []byte{0x10, 0x14, 1, 2, 3, 4, 5, 6}, 10000)
+	_, ok = s.receive(key, []byte{0x22, 7, 8, 9, 10, 11, 12, 13}, 11000)
+	assert.False(t, ok)
+	s.receive(key, []byte{0x10, 0x14, 1, 2, 3, 4, 5, 6}, 20000)
+	_, ok = s.receive(key, []byte{0x21, 7, 8, 9, 10, 11, 12, 13}, 20000+isotpTimeout+1)
+	assert.False(t, ok)
+	// 首帧长度不超过单帧容量
+	s.receive(key, []byte{0x10, 0x05, 1, 2, 3, 4, 5, 6}, 30000)
+	assert.Equal(t, 3, s.errors)
+	assert.Empty(t, s.sessions)
+}
@@ -0,0 +1,270 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+
+	"go.einride.tech/can/pkg/dbc"
+)
+
+// J1939 参数组编号（PGN）
+const (
+	j1939PGNTPCM = 0xEC00 // 传输协议连接管理 TP.CM
+	j1939PGNTPDT = 0xEB00 // 传输协议数据传输 TP.DT
+	j1939PGNDM1  = 0xFECA // 当前故障码 DM1
+)
+
+// TP.CM 控制字节，接收方发出的 CTS 和应答不影响重组，不单独处理
+const (
+	j1939TPRTS   = 16
+	j1939TPBAM   = 32
+	j1939TPAbort = 255
+)
+
+// j1939GlobalAddress BAM 广播使用的目标地址
+const j1939GlobalAddress = 0xFF
+
+// j1939TPTimeout TP.DT 数据包之间的最大间隔（J1939-21 T1，750ms），单位微秒
+const j1939TPTimeout = 750_000
+
+// j1939MaxTPSize 传输协议允许的最大数据长度
+const j1939MaxTPSize = 1785
+
+// j1939ID 29位标识符中的 J1939 字段
+type j1939ID struct {
+	priority uint8
+	pgn      uint32
+	source   uint8
+	dest     uint8 // PDU1 格式的目标地址，PDU2 格式为全局地址
+}
+
+// parseJ1939ID 拆分29位标识符。PDU1 格式（PF < 240）的 PS 字段为目标地址，不属于 PGN。
+func parseJ1939ID(id uint32) j1939ID {
+	j := j1939ID{
+		priority: uint8(id >> 26 & 0x7),
+		pgn:      id >> 8 & 0x3FFFF,
+		source:   uint8(id),
+		dest:     j1939GlobalAddress,
+	}
+	if pf := j.pgn >> 8 & 0xFF; pf < 240 {
+		j.dest = uint8(j.pgn)
+		j.pgn &^= 0xFF
+	}
+	return j
+}
+
+// canID 按 PGN 和地址重新组成29位标识符
+func (j j1939ID) canID() uint32 {
+	pgn := j.pgn
+	if pgn>>8&0xFF < 240 {
+		pgn |= uint32(j.dest)
+	}
+	return uint32(j.priority)<<26 | pgn<<8 | uint32(j.source)
+}
+
+// isJ1939DBC 判断 DBC 是否描述 J1939 网络：全局属性 ProtocolType 为 J1939，或报文的 VFrameFormat 为 J1939PG
+func isJ1939DBC(db *dbc.File) bool {
+	for _, def := range db.Defs {
+		a, ok := def.(*dbc.AttributeValueForObjectDef)
+		if !ok {
+			continue
+		}
+		switch {
+		case a.ObjectType == dbc.ObjectTypeUnspecified && a.AttributeName == "ProtocolType":
+			if strings.EqualFold(a.StringValue, "J1939") {
+				return true
+			}
+		case a.ObjectType == dbc.ObjectTypeMessage && a.AttributeName == "VFrameFormat":
+			if strings.Contains(strings.ToUpper(a.StringValue), "J1939") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// J1939DTC DM1 报文中的一个当前故障码
+type J1939DTC struct {
+	Source          uint8  `json:"source"` // 发送故障码的 ECU 源地址
+	SPN             uint32 `json:"spn"`    // 可疑参数编号
+	FMI             uint8  `json:"fmi"`    // 故障模式标识
+	OccurrenceCount uint8  `json:"occurrence_count"`
+}
+
+// J1939Lamps DM1 报文中的故障灯状态，0 关 1 开
+type J1939Lamps struct {
+	Source          uint8 `json:"source"`
+	MalfunctionLamp uint8 `json:"mil"`
+	RedStopLamp     uint8 `json:"red_stop"`
+	AmberWarning    uint8 `json:"amber_warning"`
+	ProtectLamp     uint8 `json:"protect"`
+}
+
+// decodeDM1 解码 DM1 数据：2字节故障灯状态，之后每4字节一个故障码。
+// 全0或全1的故障码表示没有故障，不输出。
+func decodeDM1(source uint8, data []byte) (J1939Lamps, []J1939DTC) {
+	var lamps J1939Lamps
+	lamps.Source = source
+	if len(data) < 2 {
+		return lamps, nil
+	}
+	lamps.MalfunctionLamp = data[0] >> 6 & 0x3
+	lamps.RedStopLamp = data[0] >> 4 & 0x3
+	lamps.AmberWarning = data[0] >> 2 & 0x3
+	lamps.ProtectLamp = data[0] & 0x3
+
+	var dtcs []J1939DTC
+	for i := 2; i+4 <= len(data); i += 4 {
+		b := data[i : i+4]
+		if b[0]|b[1]|b[2]|b[3] == 0 || b[0]&b[1]&b[2]&b[3] == 0xFF {
+			continue
+		}
+		dtcs = append(dtcs, J1939DTC{
+			Source:          source,
+			SPN:             uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2]>>5)<<16,
+			FMI:             b[2] & 0x1F,
+			OccurrenceCount: b[3] & 0x7F,
+		})
+	}
+	return lamps, dtcs
+}
+
+// J1939Report J1939 传输协议和故障码统计
+type J1939Report struct {
+	Transfers       int          `json:"transfers"`        // 重组完成的多包报文数
+	TransportErrors int          `json:"transport_errors"` // 中止、超时、序号错误或未完成的多包传输
+	ActiveFaults    []J1939DTC   `json:"active_faults"`    // 各 ECU 最后一次 DM1 中的当前故障码
+	Lamps           []J1939Lamps `json:"lamps,omitempty"`  // 各 ECU 最后一次 DM1 中的故障灯状态
+}
+
+// j1939SessionKey 多包传输会话按通道、源地址和目标地址区分
+type j1939SessionKey struct {
+	channel int
+	source  uint8
+	dest    uint8
+}
+
+// j1939Session 进行中的多包传输
+type j1939Session struct {
+	pgn     uint32
+	size    int
+	packets int
+	next    int // 期望的下一个序号
+	data    []byte
+	last    int64 // 上一个数据包的时间戳
+}
+
+// j1939State 解析器中的 J1939 状态：多包传输会话和 DM1 故障码
+type j1939State struct {
+	sessions map[j1939SessionKey]*j1939Session
+	dm1      map[uint8][]J1939DTC
+	lamps    map[uint8]J1939Lamps
+	report   J1939Report
+}
+
+func newJ1939State() *j1939State {
+	return &j1939State{
+		sessions: make(map[j1939SessionKey]*j1939Session),
+		dm1:      make(map[uint8][]J1939DTC),
+		lamps:    make(map[uint8]J1939Lamps),
+	}
+}
+
+// connect 处理 TP.CM：RTS 和 BAM 开始新的传输，Abort 结束传输
+func (s *j1939State) connect(key j1939SessionKey, data []byte, ts int64) {
+	if len(data) < 8 {
+		s.report.TransportErrors++
+		return
+	}
+	switch data[0] {
+	case j1939TPRTS, j1939TPBAM:
+		if _, busy := s.sessions[key]; busy {
+			// 上一次传输未完成就开始了新的传输
+			s.report.TransportErrors++
+		}
+		size := int(data[1]) | int(data[2])<<8
+		packets := int(data[3])
+		if size < 9 || size > j1939MaxTPSize || packets != (size+6)/7 {
+			delete(s.sessions, key)
+			s.report.TransportErrors++
+			return
+		}
+		s.sessions[key] = &j1939Session{
+			pgn:     uint32(data[5]) | uint32(data[6])<<8 | uint32(data[7])<<16,
+			size:    size,
+			packets: packets,
+			next:    1,
+			data:    make([]byte, 0, packets*7),
+			last:    ts,
+		}
+	case j1939TPAbort:
+		if _, busy := s.sessions[key]; busy {
+			delete(s.sessions, key)
+			s.report.TransportErrors++
+		}
+	}
+}
+
+// transfer 处理 TP.DT 数据包，传输完成时返回包含 PGN 和重组数据的会话
+func (s *j1939State) transfer(key j1939SessionKey, data []byte, ts int64) (*j1939Session, bool) {
+	session, ok := s.sessions[key]
+	if !ok || len(data) < 2 {
+		return nil, false
+	}
+	if int(data[0]) != session.next || ts-session.last > j1939TPTimeout {
+		delete(s.sessions, key)
+		s.report.TransportErrors++
+		return nil, false
+	}
+	session.data = append(session.data, data[1:min(len(data), 8)]...)
+	session.next++
+	session.last = ts
+	if session.next <= session.packets {
+		return nil, false
+	}
+	delete(s.sessions, key)
+	if len(session.data) < session.size {
+		s.report.TransportErrors++
+		return nil, false
+	}
+	session.data = session.data[:session.size]
+	s.report.Transfers++
+	return session, true
+}
+
+// recordDM1 记录某个 ECU 最新的 DM1，替换该 ECU 之前的当前故障码
+func (s *j1939State) recordDM1(source uint8, data []byte) {
+	lamps, dtcs := decodeDM1(source, data)
+	s.lamps[source] = lamps
+	s.dm1[source] = dtcs
+}
+
+// snapshot 返回当前统计，故障码按源地址、SPN、FMI 排序
+func (s *j1939State) snapshot() *J1939Report {
+	r := s.report
+	r.ActiveFaults = []J1939DTC{}
+	r.Lamps = nil
+	for _, dtcs := range s.dm1 {
+		r.ActiveFaults = append(r.ActiveFaults, dtcs...)
+	}
+	sort.Slice(r.ActiveFaults, func(i, j int) bool {
+		a, b := r.ActiveFaults[i], r.ActiveFaults[j]
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.SPN != b.SPN {
+			return a.SPN < b.SPN
+		}
+		return a.FMI < b.FMI
+	})
+	for _, lamps := range s.lamps {
+		r.Lamps = append(r.Lamps, lamps)
+	}
+	sort.Slice(r.Lamps, func(i, j int) bool { return r.Lamps[i].Source < r.Lamps[j].Source })
+	return &r
+}
+
+// isJ1939Transport 判断是否为由 J1939 解析器处理、但通常不在 DBC 中定义的报文
+func isJ1939Transport(pgn uint32) bool {
+	return pgn == j1939PGNTPCM || pgn == j1939PGNTPDT || pgn == j1939PGNDM1
+}
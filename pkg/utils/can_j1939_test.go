@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const j1939TestDBC = `VERSION ""
+
+BO_ 2364539904 EEC1: 8 Engine
+ SG_ EngineSpeed : 24|16@1+ (0.125,0) [0|8031.875] "rpm" Vector__XXX
+
+BO_ 2566841088 EngineConfig: 20 Engine
+ SG_ TorqueLimit : 144|16@1+ (1,0) [0|64255] "Nm" Vector__XXX
+
+BO_ 2565799936 PropA: 10 Engine
+ SG_ PropValue : 72|8@1+ (1,0) [0|250] "" Vector__XXX
+
+BA_DEF_  "ProtocolType" STRING ;
+BA_ "ProtocolType" "J1939";
+`
+
+func TestJ1939ID(t *testing.T) {
+	id := parseJ1939ID(0x18EF0321)
+	assert.Equal(t, j1939ID{priority: 6, pgn: 0xEF00, source: 0x21, dest: 0x03}, id)
+	assert.Equal(t, uint32(0x18EF0321), id.canID())
+
+	id = parseJ1939ID(0x0CF00401)
+	assert.Equal(t, j1939ID{priority: 3, pgn: 0xF004, source: 0x01, dest: j1939GlobalAddress}, id)
+	assert.Equal(t, uint32(0x0CF00401), id.canID())
+}
+
+func TestCANParserJ1939(t *testing.T) {
+	p := newTestParser(t, j1939TestDBC, "EngineSpeed", "TorqueLimit", "PropValue")
+	require.NotNil(t, p.j1939)
+	parse := func(id uint32, ts int64, data ...byte) map[string]float64 {
+		signals, err := p.ParseFrame(&CANFrame{ID: id, Extended: true, Timestamp: ts, Data: data})
+		require.NoError(t, err)
+		return signals
+	}
+
+	// 同一 PGN 由不同源地址、不同优先级发送时都按 EEC1 解码
+	assert.Equal(t, map[string]float64{"EngineSpeed": 1000}, parse(0x0CF00400, 0, 0, 0, 0, 0x40, 0x1F, 0, 0, 0))
+	assert.Equal(t, map[string]float64{"EngineSpeed": 1000}, parse(0x18F00417, 0, 0, 0, 0, 0x40, 0x1F, 0, 0, 0))
+
+	// BAM 广播 20 字节的 EngineConfig，最后一个数据包到达时才输出信号
+	assert.Empty(t, parse(0x1CECFF00, 1000, j1939TPBAM, 20, 0, 3, 0xFF, 0xE3, 0xFE, 0))
+	assert.Empty(t, parse(0x1CEBFF00, 51000, 1, 1, 2, 3, 4, 5, 6, 7))
+	assert.Empty(t, parse(0x1CEBFF00, 101000, 2, 8, 9, 10, 11, 12, 13, 14))
+	assert.Equal(t, map[string]float64{"TorqueLimit": 0x0201}, parse(0x1CEBFF00, 151000, 3, 15, 16, 17, 18, 1, 2, 0xFF))
+
+	// RTS/CTS 点对点传输 PDU1 格式的 PGN，目标地址不参与匹配
+	assert.Empty(t, parse(0x1CEC0321, 200000, j1939TPRTS, 10, 0, 2, 0xFF, 0x00, 0xEF, 0))
+	assert.Empty(t, parse(0x1CEB0321, 210000, 1, 0, 0, 0, 0, 0, 0, 0))
+	assert.Equal(t, map[string]float64{"PropValue": 42}, parse(0x1CEB0321, 220000, 2, 0, 0, 42, 0xFF, 0xFF, 0xFF, 0xFF))
+	assert.Equal(t, 2, p.J1939Report().Transfers)
+
+	// 序号跳变、超时和中止都计为传输错误，不输出信号
+	parse(0x1CECFF00, 300000, j1939TPBAM, 20, 0, 3, 0xFF, 0xE3, 0xFE, 0)
+	assert.Empty(t, parse(0x1CEBFF00, 310000, 2, 0, 0, 0, 0, 0, 0, 0))
+	parse(0x1CECFF00, 400000, j1939TPBAM, 20, 0, 3, 0xFF, 0xE3, 0xFE, 0)
+	assert.Empty(t, parse(0x1CEBFF00, 2000000, 1, 0, 0, 0, 0, 0, 0, 0))
+	parse(0x1CEC0321, 3000000, j1939TPRTS, 10, 0, 2, 0xFF, 0x00, 0xEF, 0)
+	parse(0x1CEC0321, 3010000, j1939TPAbort, 0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0xEF, 0)
+	assert.Equal(t, 3, p.J1939Report().TransportErrors)
+}
+
+func TestCANParserJ1939DM1(t *testing.T) {
+	p := newTestParser(t, j1939TestDBC, "EngineSpeed")
+	parse := func(id uint32, data ...byte) {
+		_, err := p.ParseFrame(&CANFrame{ID: id, Extended: true, Data: data})
+		require.NoError(t, err)
+	}
+
+	// 单帧 DM1：故障灯 MIL 和琥珀灯点亮，SPN 100 FMI 1 出现2次
+	parse(0x18FECA00, 0x44, 0xFF, 0x64, 0x00, 0x01, 0x02, 0xFF, 0xFF)
+	// 多个故障码通过 BAM 发送：SPN 110 FMI 0 和 SPN 524287 FMI 31
+	parse(0x1CECFF3D, j1939TPBAM, 10, 0, 2, 0xFF, 0xCA, 0xFE, 0)
+	parse(0x1CEBFF3D, 1, 0x10, 0xFF, 0x6E, 0x00, 0x00, 0x01, 0xFF)
+	parse(0x1CEBFF3D, 2, 0xFF, 0xFF, 0x01, 0xFF, 0xFF, 0xFF, 0xFF)
+
+	report := p.J1939Report()
+	assert.Equal(t, []J1939DTC{
+		{Source: 0x00, SPN: 100, FMI: 1, OccurrenceCount: 2},
+		{Source: 0x3D, SPN: 110, FMI: 0, OccurrenceCount: 1},
+		{Source: 0x3D, SPN: 0x7FFFF, FMI: 31, OccurrenceCount: 1},
+	}, report.ActiveFaults)
+	assert.Equal(t, []J1939Lamps{
+		{Source: 0x00, MalfunctionLamp: 1, AmberWarning: 1},
+		{Source: 0x3D, RedStopLamp: 1},
+	}, report.Lamps)
+
+	// 新的 DM1 替换该 ECU 之前的故障码，全0表示故障已清除
+	parse(0x18FECA00, 0x00, 0xFF, 0, 0, 0, 0, 0xFF, 0xFF)
+	assert.Len(t, p.J1939Report().ActiveFaults, 2)
+}
+
+func TestStreamCANLogJ1939(t *testing.T) {
+	db, err := ParseDBC("j1939.dbc", []byte(j1939TestDBC))
+	require.NoError(t, err)
+	decoder, err := NewCANDecoder([]DBCBinding{{DBC: CompileDBC(db)}}, []string{"EngineSpeed", "TorqueLimit"}, nil)
+	require.NoError(t, err)
+
+	path := writeTestFile(t, "trace.can", `(1620000000.001000) can0 0CF00400#000000401F000000
+(1620000000.002000) can0 1CECFF00#20140003FFE3FE00
+(1620000000.003000) can0 1CEBFF00#0101020304050607
+(1620000000.004000) can0 1CEBFF00#0208090A0B0C0D0E
+(1620000000.005000) can0 1CEBFF00#0315161718E803FF
+(1620000000.006000) can0 18FECA00#04FF6400010EFFFF
+`)
+	var samples []*CANSample
+	report, err := StreamCANLogWithPolicy(path, decoder, CANParsePolicy{}, func(sample *CANSample) bool {
+		samples = append(samples, sample)
+		return true
+	})
+	require.NoError(t, err)
+	require.Len(t, samples, 2)
+	assert.Equal(t, 1000.0, samples[0].Signals["EngineSpeed"])
+	assert.Equal(t, 1000.0, samples[1].Signals["TorqueLimit"])
+	assert.Empty(t, report.UnknownIDs)
+	require.NotNil(t, report.J1939)
+	assert.Equal(t, 1, report.J1939.Transfers)
+	assert.Equal(t, []J1939DTC{{Source: 0, SPN: 100, FMI: 1, OccurrenceCount: 14}}, report.J1939.ActiveFaults)
+}
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CANFrame 表示从任意格式日志中读出的一帧原始CAN报文
+type CANFrame struct {
+	Timestamp int64  // 时间戳（Unix 微秒），日志未给出开始时间且未设置 SetStartTime 时为相对日志开始的偏移，可以为0
+	NoTime    bool   // 日志未记录该帧的时间戳，此时 Timestamp 无意义
+	Channel   int    // 通道号，日志未记录时为0
+	ID        uint32 // CAN ID（不含扩展帧标志位）
+	Extended  bool   // 是否为29位扩展帧
+	Tx        bool   // 是否为发送方向
+	FD        bool   // 是否为 CAN FD 帧
+	BRS       bool   // CAN FD 比特率切换标志
+	ESI       bool   // CAN FD 错误状态指示标志
+	Remote    bool   // 是否为远程帧（无数据段）
+	Error     bool   // 是否为错误帧
+	Data      []byte // 数据段，CAN FD 帧最长64字节
+}
+
+// CAN ID 相关常量
+const (
+	canIDExtendedFlag = 0x80000000 // 二进制日志格式中 CAN ID 最高位表示扩展帧
+	canMaxStandardID  = 0x7FF      // 11位标准帧的最大ID
+	canMaxClassicLen  = 8          // 经典CAN帧最大数据长度
+	canMaxFDLen       = 64         // CAN FD 帧最大数据长度
+)
+
+// canFDLengths CAN FD 的 DLC 到数据长度映射
+var canFDLengths = [16]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 12, 16, 20, 24, 32, 48, 64}
+
+// validFDLength 判断数据长度是否为 CAN FD 允许的长度
+func validFDLength(n int) bool {
+	for _, l := range canFDLengths {
+		if l == n {
+			return true
+		}
+	}
+	return false
+}
+
+// setID 解析带扩展帧标志位的 CAN ID
+func (f *CANFrame) setID(id uint32) {
+	f.Extended = id&canIDExtendedFlag != 0
+	f.ID = id &^ canIDExtendedFlag
+}
+
+// CANLogReader 按顺序读取CAN日志中的报文帧
+type CANLogReader interface {
+	// Next 返回下一帧报文，读到文件末尾时返回 io.EOF
+	Next() (*CANFrame, error)
+}
+
+// CANLogFormat 描述一种可插拔的CAN日志格式
+type CANLogFormat struct {
+	Name       string                                  // 格式名称
+	Extensions []string                                // 对应的文件扩展名（小写，含点）
+	Detect     func(header []byte) bool                // 根据文件头判断是否为该格式，可为 nil
+	NewReader  func(r io.Reader) (CANLogReader, error) // 创建该格式的顺序读取器
+	// NewReaderAt 为需要随机访问的格式（如 MF4）创建读取器，可为 nil。
+	// 打开本地文件时优先使用该函数，避免把整个文件读入内存。
+	NewReaderAt func(r io.ReaderAt, size int64) (CANLogReader, error)
+}
+
+// canLogHeaderSize 格式探测时读取的文件头字节数
+const canLogHeaderSize = 4096
+
+var canLogFormats []*CANLogFormat
+
+// RegisterCANLogFormat 注册一种CAN日志格式，同名格式会被替换
+func RegisterCANLogFormat(format *CANLogFormat) {
+	for i, f := range canLogFormats {
+		if f.Name == format.Name {
+			canLogFormats[i] = format
+			return
+		}
+	}
+	canLogFormats = append(canLogFormats, format)
+}
+
+// LookupCANLogFormat 按名称查找已注册的CAN日志格式
+func LookupCANLogFormat(name string) (*CANLogFormat, bool) {
+	for _, f := range canLogFormats {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// DetectCANLogFormat 根据文件头和扩展名判断CAN日志格式。
+// 文件头特征优先，其次是扩展名，都无法识别时按 candump 格式处理。
+func DetectCANLogFormat(path string, header []byte) (*CANLogFormat, error) {
+	if f := detectCANLogFormat(path, header); f != nil {
+		return f, nil
+	}
+	if f, ok := LookupCANLogFormat("candump"); ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("无法识别CAN日志格式 '%s'", path)
+}
+
+// detectCANLogFormat 按文件头特征和扩展名识别格式，无法识别时返回 nil
+func detectCANLogFormat(path string, header []byte) *CANLogFormat {
+	for _, f := range canLogFormats {
+		if f.Detect != nil && f.Detect(header) {
+			return f
+		}
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, f := range canLogFormats {
+		for _, e := range f.Extensions {
+			if e == ext {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// CANLogFile 是一个已打开的CAN日志文件
+type CANLogFile struct {
+	CANLogReader
+	Format    *CANLogFormat // 探测到的日志格式，zip 归档中有多种格式时名称以 + 连接
+	Container string        // 压缩或归档格式（gzip、zstd、zip），未压缩时为空
+	file      *os.File
+	closers   []io.Closer // 解压器、归档成员等需要在文件之前关闭的资源
+	start     int64       // 相对时间戳的起点（Unix 微秒），0 表示不换算
+}
+
+// OpenCANLog 打开CAN日志文件并自动探测其格式。
+// gzip、zstd 压缩的日志透明解压；zip 归档中的每个日志视为一路总线，按时间戳合并为一个读取器。
+func OpenCANLog(path string) (*CANLogFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开 CAN 日志文件 '%s' 失败: %w", path, err)
+	}
+	header := make([]byte, canLogHeaderSize)
+	n, err := file.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		file.Close()
+		return nil, fmt.Errorf("读取 CAN 日志文件头 '%s' 失败: %w", path, err)
+	}
+	header = header[:n]
+
+	if bytes.HasPrefix(header, zipMagic) {
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("读取 CAN 日志文件头 '%s' 失败: %w", path, err)
+		}
+		reader, format, closers, err := openCANLogArchive(file, info.Size())
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("打开 CAN 日志归档 '%s' 失败: %w", path, err)
+		}
+		return &CANLogFile{CANLogReader: reader, Format: format, Container: "zip", file: file, closers: closers}, nil
+	}
+
+	if detectCompression(header) == nil {
+		format, err := DetectCANLogFormat(path, header)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if format.NewReaderAt != nil {
+			var info os.FileInfo
+			var reader CANLogReader
+			if info, err = file.Stat(); err == nil {
+				reader, err = format.NewReaderAt(file, info.Size())
+			}
+			if err != nil {
+				file.Close()
+				return nil, fmt.Errorf("创建 %s 读取器失败: %w", format.Name, err)
+			}
+			return &CANLogFile{CANLogReader: reader, Format: format, file: file}, nil
+		}
+	}
+
+	reader, format, compression, closer, err := openCANLogStream(path, file, false)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	canLog := &CANLogFile{CANLogReader: reader, Format: format, file: file}
+	if compression != nil {
+		canLog.Container = compression.name
+		canLog.closers = []io.Closer{closer}
+	}
+	return canLog, nil
+}
+
+// Name 返回日志格式名称，压缩或归档的日志带有容器格式前缀，如 zip:candump
+func (f *CANLogFile) Name() string {
+	if f.Container == "" {
+		return f.Format.Name
+	}
+	return f.Container + ":" + f.Format.Name
+}
+
+// SetStartTime 设置日志开始时间，相对时间戳的帧换算为以此为起点的 Unix 时间
+func (f *CANLogFile) SetStartTime(t time.Time) {
+	f.start = t.UnixMicro()
+}
+
+// Next 返回下一帧报文，相对时间戳按 SetStartTime 设置的开始时间换算
+func (f *CANLogFile) Next() (*CANFrame, error) {
+	frame, err := f.CANLogReader.Next()
+	if err == nil && f.start != 0 && isRelativeTimestamp(frame.Timestamp) {
+		frame.Timestamp += f.start
+	}
+	return frame, err
+}
+
+// Close 关闭日志文件
+func (f *CANLogFile) Close() error {
+	for _, c := range f.closers {
+		c.Close()
+	}
+	return f.file.Close()
+}
+
+// firstContentLine 返回文件头中第一个非空行
+func firstContentLine(header []byte) string {
+	for _, line := range strings.Split(string(header), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
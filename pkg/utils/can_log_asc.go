@@ -0,0 +1,280 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterCANLogFormat(&CANLogFormat{
+		Name:       "asc",
+		Extensions: []string{".asc"},
+		Detect: func(header []byte) bool {
+			line := strings.ToLower(firstContentLine(header))
+			return strings.HasPrefix(line, "date ") || strings.HasPrefix(line, "base ")
+		},
+		NewReader: func(r io.Reader) (CANLogReader, error) {
+			return newASCReader(r), nil
+		},
+	})
+}
+
+// ascDateLayouts Vector ASC 文件头中 date 行可能出现的时间格式
+var ascDateLayouts = []string{
+	"Mon Jan 2 3:04:05.000 pm 2006",
+	"Mon Jan 2 15:04:05.000 2006",
+	"Mon Jan 2 3:04:05 pm 2006",
+	"Mon Jan 2 15:04:05 2006",
+}
+
+// ascReader 读取 Vector ASCII (.asc) 日志
+type ascReader struct {
+	scanner    *bufio.Scanner
+	lineNumber int
+	startTime  int64 // 测量开始时间（Unix 微秒），文件头未给出时为0
+	hexBase    bool  // ID 和数据是否为十六进制
+	relative   bool  // 时间戳是否相对于上一条事件
+	lastOffset int64 // 相对时间戳模式下累计的偏移（微秒）
+}
+
+func newASCReader(r io.Reader) *ascReader {
+	return &ascReader{scanner: bufio.NewScanner(r), hexBase: true}
+}
+
+// Next 返回下一帧报文，跳过文件头、注释和非报文事件
+func (r *ascReader) Next() (*CANFrame, error) {
+	for r.scanner.Scan() {
+		r.lineNumber++
+		line := strings.TrimSpace(r.scanner.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if r.parseHeader(fields) {
+			continue
+		}
+		frame, ok, err := r.parseFrame(fields)
+		if err != nil {
+			return nil, &CANLogLineError{Line: r.lineNumber, Err: err}
+		}
+		if ok {
+			return frame, nil
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// parseHeader 处理文件头关键字行，返回该行是否为文件头
+func (r *ascReader) parseHeader(fields []string) bool {
+	switch strings.ToLower(fields[0]) {
+	case "date":
+		if ts, ok := parseASCDate(fields[1:]); ok {
+			r.startTime = ts
+		}
+		return true
+	case "base":
+		for i, f := range fields {
+			switch strings.ToLower(f) {
+			case "hex":
+				r.hexBase = true
+			case "dec":
+				r.hexBase = false
+			case "timestamps":
+				if i+1 < len(fields) {
+					r.relative = strings.EqualFold(fields[i+1], "relative")
+				}
+			}
+		}
+		return true
+	case "begin":
+		// Begin Triggerblock 行可能带有更精确的开始时间
+		if len(fields) > 2 {
+			if ts, ok := parseASCDate(fields[2:]); ok {
+				r.startTime = ts
+			}
+		}
+		return true
+	case "end", "internal", "no":
+		return true
+	}
+	return false
+}
+
+// parseFrame 解析报文行，支持以下事件：
+//
+//	<时间> <通道> <ID>[x] <Rx|Tx> d <DLC> <数据...>
+//	<时间> <通道> <ID>[x] <Rx|Tx> r [DLC]
+//	<时间> <通道> ErrorFrame
+//	<时间> CANFD <通道> <Rx|Tx> <ID>[x] [名称] <BRS> <ESI> <DLC> <数据长度> <数据...>
+//
+// 其他事件（统计信息、日志事件等）返回 ok=false。
+func (r *ascReader) parseFrame(fields []string) (frame *CANFrame, ok bool, err error) {
+	if len(fields) < 3 {
+		return nil, false, nil
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, false, nil
+	}
+	// 相对时间戳模式下，所有事件（包括非报文事件）都参与累计
+	offset := int64(math.Round(seconds * 1e6))
+	if r.relative {
+		r.lastOffset += offset
+		offset = r.lastOffset
+	}
+	timestamp := r.startTime + offset
+
+	if strings.EqualFold(fields[1], "CANFD") {
+		frame, ok, err = r.parseFDFrame(fields[2:])
+		if frame != nil {
+			frame.Timestamp = timestamp
+		}
+		return frame, ok, err
+	}
+
+	channel, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, false, nil
+	}
+	if strings.EqualFold(fields[2], "ErrorFrame") {
+		return &CANFrame{Timestamp: timestamp, Channel: channel, Error: true}, true, nil
+	}
+	if len(fields) < 5 {
+		return nil, false, nil
+	}
+	frame = &CANFrame{Timestamp: timestamp, Channel: channel, Tx: strings.EqualFold(fields[3], "Tx")}
+	switch strings.ToLower(fields[4]) {
+	case "d":
+	case "r":
+		frame.Remote = true
+	default:
+		return nil, false, nil
+	}
+	if err := r.parseID(frame, fields[2]); err != nil {
+		return nil, false, err
+	}
+	if frame.Remote {
+		return frame, true, nil
+	}
+
+	if len(fields) < 6 {
+		return nil, false, fmt.Errorf("缺少DLC字段")
+	}
+	dlc, err := strconv.Atoi(fields[5])
+	if err != nil || dlc < 0 || dlc > canMaxClassicLen {
+		return nil, false, fmt.Errorf("DLC无效 '%s'", fields[5])
+	}
+	if frame.Data, err = r.parseData(fields[6:], dlc); err != nil {
+		return nil, false, err
+	}
+	return frame, true, nil
+}
+
+// parseFDFrame 解析 CANFD 关键字之后的字段
+func (r *ascReader) parseFDFrame(fields []string) (frame *CANFrame, ok bool, err error) {
+	if len(fields) < 3 {
+		return nil, false, nil
+	}
+	channel, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, false, nil
+	}
+	frame = &CANFrame{Channel: channel, Tx: strings.EqualFold(fields[1], "Tx"), FD: true}
+	if strings.EqualFold(fields[2], "ErrorFrame") {
+		frame.Error = true
+		frame.FD = false
+		return frame, true, nil
+	}
+	if err := r.parseID(frame, fields[2]); err != nil {
+		return nil, false, err
+	}
+	rest := fields[3:]
+	// ID 之后可能带有 DBC 中的报文名称
+	if len(rest) > 0 && !isDecimal(rest[0]) {
+		rest = rest[1:]
+	}
+	if len(rest) < 4 {
+		return nil, false, fmt.Errorf("CANFD 报文字段数不足")
+	}
+	frame.BRS = rest[0] == "1"
+	frame.ESI = rest[1] == "1"
+	dlc, err := strconv.ParseUint(rest[2], 16, 8)
+	if err != nil || dlc > 15 {
+		return nil, false, fmt.Errorf("DLC无效 '%s'", rest[2])
+	}
+	length, err := strconv.Atoi(rest[3])
+	if err != nil || !validFDLength(length) {
+		return nil, false, fmt.Errorf("CAN FD 数据长度无效 '%s'", rest[3])
+	}
+	if frame.Data, err = r.parseData(rest[4:], length); err != nil {
+		return nil, false, err
+	}
+	return frame, true, nil
+}
+
+// parseID 解析带可选 x 后缀（扩展帧）的 CAN ID
+func (r *ascReader) parseID(frame *CANFrame, field string) error {
+	idStr := strings.TrimRight(field, "xX")
+	id, err := strconv.ParseUint(idStr, r.numberBase(), 32)
+	if err != nil {
+		return fmt.Errorf("CAN ID解析失败 '%s': %w", field, err)
+	}
+	frame.ID = uint32(id)
+	frame.Extended = len(idStr) != len(field)
+	return nil
+}
+
+// parseData 解析 n 个数据字节
+func (r *ascReader) parseData(fields []string, n int) ([]byte, error) {
+	if len(fields) < n {
+		return nil, fmt.Errorf("数据字节数不足，期望%d个", n)
+	}
+	data := make([]byte, n)
+	for i := 0; i < n; i++ {
+		b, err := strconv.ParseUint(fields[i], r.numberBase(), 8)
+		if err != nil {
+			return nil, fmt.Errorf("CAN数据解码失败 '%s': %w", fields[i], err)
+		}
+		data[i] = byte(b)
+	}
+	return data, nil
+}
+
+// isDecimal 判断字符串是否只由十进制数字组成
+func isDecimal(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *ascReader) numberBase() int {
+	if r.hexBase {
+		return 16
+	}
+	return 10
+}
+
+// parseASCDate 解析 date 行中的时间，返回 Unix 微秒
+func parseASCDate(fields []string) (int64, bool) {
+	value := strings.Join(fields, " ")
+	for _, layout := range ascDateLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t.UnixMicro(), true
+		}
+	}
+	return 0, false
+}
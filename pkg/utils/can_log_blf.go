@@ -0,0 +1,293 @@
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+func init() {
+	RegisterCANLogFormat(&CANLogFormat{
+		Name:       "blf",
+		Extensions: []string{".blf"},
+		Detect: func(header []byte) bool {
+			return bytes.HasPrefix(header, blfFileSignature)
+		},
+		NewReader: func(r io.Reader) (CANLogReader, error) {
+			return newBLFReader(r)
+		},
+	})
+}
+
+var (
+	blfFileSignature   = []byte("LOGG")
+	blfObjectSignature = []byte("LOBJ")
+)
+
+// BLF 文件结构尺寸
+const (
+	blfFileHeaderSize    = 72 // 文件头中固定字段的长度，实际头长度由 header_size 字段给出
+	blfObjectHeaderBase  = 16 // 对象头公共部分：签名、头长度、头版本、对象长度、对象类型
+	blfLogContainerSize  = 16 // LOG_CONTAINER 对象头之后的容器描述
+	blfCANMessageSize    = 16 // CAN_MESSAGE / CAN_MESSAGE2 的公共字段
+	blfCANFDMessageSize  = 84 // CAN_FD_MESSAGE 的完整长度
+	blfCANFDMessage64Len = 40 // CAN_FD_MESSAGE_64 数据段之前的字段长度
+)
+
+// BLF 对象类型
+const (
+	blfObjCANMessage     = 1
+	blfObjCANError       = 2
+	blfObjLogContainer   = 10
+	blfObjCANErrorExt    = 73
+	blfObjCANMessage2    = 86
+	blfObjCANFDMessage   = 100
+	blfObjCANFDMessage64 = 101
+)
+
+// BLF 标志位
+const (
+	blfTimeTenMicros   = 0x1    // 对象时间戳单位为10微秒
+	blfTimeOneNanos    = 0x2    // 对象时间戳单位为1纳秒
+	blfCompressionZlib = 2      // 容器使用 zlib 压缩
+	blfCANMsgTx        = 0x01   // CAN_MESSAGE 发送方向
+	blfCANMsgRemote    = 0x80   // CAN_MESSAGE 远程帧
+	blfFDFlagEDL       = 0x1    // CAN_FD_MESSAGE: FD 帧
+	blfFDFlagBRS       = 0x2    // CAN_FD_MESSAGE: 比特率切换
+	blfFDFlagESI       = 0x4    // CAN_FD_MESSAGE: 错误状态指示
+	blfFD64Remote      = 0x0010 // CAN_FD_MESSAGE_64: 远程帧
+	blfFD64EDL         = 0x1000 // CAN_FD_MESSAGE_64: FD 帧
+	blfFD64BRS         = 0x2000 // CAN_FD_MESSAGE_64: 比特率切换
+	blfFD64ESI         = 0x4000 // CAN_FD_MESSAGE_64: 错误状态指示
+)
+
+// blfReader 读取 Vector Binary Logging Format (.blf) 文件。
+// 顶层对象通常是 LOG_CONTAINER，容器解压后的数据流中依次排列着各个报文对象，
+// 单个对象可能跨越两个容器，因此未解析完的尾部数据会保留到下一个容器。
+type blfReader struct {
+	r         io.Reader
+	startTime int64  // 测量开始时间（Unix 微秒）
+	buf       []byte // 已解压但尚未解析的对象数据
+	skip      int    // 下一个容器开头需要丢弃的填充字节数
+}
+
+func newBLFReader(r io.Reader) (*blfReader, error) {
+	header := make([]byte, blfFileHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("读取BLF文件头失败: %w", err)
+	}
+	if !bytes.Equal(header[:4], blfFileSignature) {
+		return nil, fmt.Errorf("BLF文件签名无效")
+	}
+	headerSize := binary.LittleEndian.Uint32(header[4:8])
+	if headerSize > blfFileHeaderSize {
+		if _, err := io.CopyN(io.Discard, r, int64(headerSize-blfFileHeaderSize)); err != nil {
+			return nil, fmt.Errorf("跳过BLF文件头失败: %w", err)
+		}
+	}
+	return &blfReader{r: r, startTime: parseSystemTime(header[40:56])}, nil
+}
+
+// parseSystemTime 解析 Windows SYSTEMTIME 结构，返回 Unix 微秒
+func parseSystemTime(b []byte) int64 {
+	field := func(i int) int { return int(binary.LittleEndian.Uint16(b[i*2:])) }
+	if field(0) == 0 {
+		return 0
+	}
+	t := time.Date(field(0), time.Month(field(1)), field(3), field(4), field(5), field(6),
+		field(7)*int(time.Millisecond), time.Local)
+	return t.UnixMicro()
+}
+
+// Next 返回下一帧CAN报文，跳过其他类型的对象
+func (r *blfReader) Next() (*CANFrame, error) {
+	for {
+		frame, err := r.parseBuffered()
+		if err != nil || frame != nil {
+			return frame, err
+		}
+		if err := r.readObject(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readObject 读取一个顶层对象，把其中的报文数据追加到缓冲区
+func (r *blfReader) readObject() error {
+	base := make([]byte, blfObjectHeaderBase)
+	if _, err := io.ReadFull(r.r, base); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("BLF对象头不完整: %w", err)
+		}
+		return err
+	}
+	if !bytes.Equal(base[:4], blfObjectSignature) {
+		return fmt.Errorf("BLF对象签名无效")
+	}
+	objSize := int(binary.LittleEndian.Uint32(base[8:12]))
+	objType := binary.LittleEndian.Uint32(base[12:16])
+	if objSize < blfObjectHeaderBase {
+		return fmt.Errorf("BLF对象长度无效: %d", objSize)
+	}
+	raw := make([]byte, objSize-blfObjectHeaderBase+objSize%4)
+	if _, err := io.ReadFull(r.r, raw); err != nil {
+		return fmt.Errorf("读取BLF对象失败: %w", err)
+	}
+
+	if objType != blfObjLogContainer {
+		// 未放入容器的对象连同填充字节按原样交给解析流程
+		r.appendData(append(base, raw...))
+		return nil
+	}
+	body := raw[:objSize-blfObjectHeaderBase]
+	if len(body) < blfLogContainerSize {
+		return fmt.Errorf("LOG_CONTAINER 长度不足")
+	}
+	method := binary.LittleEndian.Uint16(body[0:2])
+	payload := body[blfLogContainerSize:]
+	switch method {
+	case 0:
+		r.appendData(payload)
+	case blfCompressionZlib:
+		zr, err := zlib.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("LOG_CONTAINER 解压失败: %w", err)
+		}
+		data, err := io.ReadAll(zr)
+		zr.Close()
+		if err != nil {
+			return fmt.Errorf("LOG_CONTAINER 解压失败: %w", err)
+		}
+		r.appendData(data)
+	default:
+		return fmt.Errorf("不支持的 LOG_CONTAINER 压缩方式: %d", method)
+	}
+	return nil
+}
+
+func (r *blfReader) appendData(data []byte) {
+	if r.skip > 0 {
+		n := min(r.skip, len(data))
+		data = data[n:]
+		r.skip -= n
+	}
+	r.buf = append(r.buf, data...)
+}
+
+// parseBuffered 从缓冲区中解析出下一帧CAN报文，数据不足时返回 nil
+func (r *blfReader) parseBuffered() (*CANFrame, error) {
+	for len(r.buf) >= blfObjectHeaderBase {
+		if !bytes.HasPrefix(r.buf, blfObjectSignature) {
+			// 数据损坏时重新同步到下一个对象签名
+			idx := bytes.Index(r.buf, blfObjectSignature)
+			if idx < 0 {
+				r.buf = r.buf[len(r.buf)-len(blfObjectSignature)+1:]
+				return nil, nil
+			}
+			r.buf = r.buf[idx:]
+			continue
+		}
+		headerSize := int(binary.LittleEndian.Uint16(r.buf[4:6]))
+		objSize := int(binary.LittleEndian.Uint32(r.buf[8:12]))
+		objType := binary.LittleEndian.Uint32(r.buf[12:16])
+		if objSize < headerSize || headerSize < blfObjectHeaderBase+16 {
+			return nil, fmt.Errorf("BLF对象头长度无效: header=%d object=%d", headerSize, objSize)
+		}
+		if len(r.buf) < objSize {
+			return nil, nil
+		}
+		obj := r.buf[:objSize]
+		next := objSize
+		if objType != blfObjCANFDMessage64 {
+			next += objSize % 4
+		}
+		if next > len(r.buf) {
+			r.skip = next - len(r.buf)
+			next = len(r.buf)
+		}
+		r.buf = r.buf[next:]
+
+		frame, err := r.decodeObject(objType, obj[:headerSize], obj[headerSize:])
+		if err != nil {
+			return nil, err
+		}
+		if frame != nil {
+			// 复制数据段，避免返回的帧长期引用整个解压缓冲区
+			frame.Data = bytes.Clone(frame.Data)
+			return frame, nil
+		}
+	}
+	return nil, nil
+}
+
+// decodeObject 解码单个报文或错误帧对象，其他对象返回 nil
+func (r *blfReader) decodeObject(objType uint32, header, payload []byte) (*CANFrame, error) {
+	flags := binary.LittleEndian.Uint32(header[16:20])
+	ticks := int64(binary.LittleEndian.Uint64(header[24:32]))
+	var offset int64
+	switch flags {
+	case blfTimeTenMicros:
+		offset = ticks * 10
+	case blfTimeOneNanos:
+		offset = ticks / 1000
+	}
+	frame := &CANFrame{Timestamp: r.startTime + offset}
+
+	switch objType {
+	case blfObjCANMessage, blfObjCANMessage2:
+		if len(payload) < blfCANMessageSize {
+			return nil, fmt.Errorf("CAN_MESSAGE 长度不足")
+		}
+		msgFlags := payload[2]
+		frame.Channel = int(binary.LittleEndian.Uint16(payload[0:2]))
+		frame.Tx = msgFlags&blfCANMsgTx != 0
+		frame.Remote = msgFlags&blfCANMsgRemote != 0
+		frame.setID(binary.LittleEndian.Uint32(payload[4:8]))
+		frame.Data = payload[8:16][:min(int(payload[3]), canMaxClassicLen)]
+		if frame.Remote {
+			frame.Data = nil
+		}
+	case blfObjCANFDMessage:
+		if len(payload) < blfCANFDMessageSize {
+			return nil, fmt.Errorf("CAN_FD_MESSAGE 长度不足")
+		}
+		msgFlags := payload[2]
+		fdFlags := payload[13]
+		frame.Channel = int(binary.LittleEndian.Uint16(payload[0:2]))
+		frame.Tx = msgFlags&blfCANMsgTx != 0
+		frame.Remote = msgFlags&blfCANMsgRemote != 0
+		frame.setID(binary.LittleEndian.Uint32(payload[4:8]))
+		frame.FD = fdFlags&blfFDFlagEDL != 0
+		frame.BRS = fdFlags&blfFDFlagBRS != 0
+		frame.ESI = fdFlags&blfFDFlagESI != 0
+		frame.Data = payload[20:84][:min(int(payload[14]), canMaxFDLen)]
+	case blfObjCANFDMessage64:
+		if len(payload) < blfCANFDMessage64Len {
+			return nil, fmt.Errorf("CAN_FD_MESSAGE_64 长度不足")
+		}
+		fdFlags := binary.LittleEndian.Uint32(payload[12:16])
+		frame.Remote = fdFlags&blfFD64Remote != 0
+		frame.Channel = int(payload[0])
+		frame.Tx = payload[34] == 1
+		frame.setID(binary.LittleEndian.Uint32(payload[4:8]))
+		frame.FD = fdFlags&blfFD64EDL != 0
+		frame.BRS = fdFlags&blfFD64BRS != 0
+		frame.ESI = fdFlags&blfFD64ESI != 0
+		// 有效字节数可能大于DLC对应长度或实际数据，取三者较小值
+		n := min(int(payload[2]), canFDLengths[payload[1]&0x0F], len(payload)-blfCANFDMessage64Len)
+		frame.Data = payload[blfCANFDMessage64Len : blfCANFDMessage64Len+n]
+	case blfObjCANError, blfObjCANErrorExt:
+		if len(payload) < 2 {
+			return nil, fmt.Errorf("CAN_ERROR 长度不足")
+		}
+		frame.Channel = int(binary.LittleEndian.Uint16(payload[0:2]))
+		frame.Error = true
+	default:
+		return nil, nil
+	}
+	return frame, nil
+}
@@ -0,0 +1,164 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterCANLogFormat(&CANLogFormat{
+		Name:       "candump",
+		Extensions: []string{".can", ".log"},
+		Detect: func(header []byte) bool {
+			return strings.HasPrefix(firstContentLine(header), "(")
+		},
+		NewReader: func(r io.Reader) (CANLogReader, error) {
+			return newCandumpReader(r), nil
+		},
+	})
+}
+
+// candumpReader 读取 candump -l 格式的日志：(时间戳) 接口 ID#DATA
+type candumpReader struct {
+	scanner    *bufio.Scanner
+	lineNumber int
+}
+
+func newCandumpReader(r io.Reader) *candumpReader {
+	return &candumpReader{scanner: bufio.NewScanner(r)}
+}
+
+// Next 返回下一帧报文
+func (r *candumpReader) Next() (*CANFrame, error) {
+	for r.scanner.Scan() {
+		r.lineNumber++
+		line := strings.TrimSpace(r.scanner.Text())
+		if line == "" {
+			continue
+		}
+		frame, err := parseCandumpLine(line)
+		if err != nil {
+			return nil, &CANLogLineError{Line: r.lineNumber, Err: err}
+		}
+		return frame, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// parseCandumpLine 解析一行 candump 日志
+func parseCandumpLine(line string) (*CANFrame, error) {
+	parts := strings.Fields(line)
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("无效行格式，期望至少3个字段")
+	}
+
+	ts, err := parseLogTimestamp(strings.Trim(parts[0], "()"))
+	if err != nil {
+		return nil, err
+	}
+
+	frame, err := parseCandumpFrame(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	frame.Timestamp = ts
+	frame.Channel = candumpChannel(parts[1])
+	return frame, nil
+}
+
+// candump 错误帧在 CAN ID 中设置的标志位（linux/can.h CAN_ERR_FLAG）
+const candumpErrorFlag = 0x20000000
+
+// candump FD 帧标志字符中的位定义
+const (
+	candumpFDFlagBRS = 0x1
+	candumpFDFlagESI = 0x2
+)
+
+// parseCandumpFrame 解析 candump 的帧字段，支持以下写法：
+//
+//	123#11223344          经典数据帧
+//	123#1122334455667788_C 经典数据帧，带大于8的原始DLC
+//	123#R / 123#R4        远程帧，可带DLC
+//	123##1<数据>           CAN FD 帧，#后第一个字符为标志位
+//	20000080#...          错误帧
+func parseCandumpFrame(canFrame string) (*CANFrame, error) {
+	idStr, dataStr, found := strings.Cut(canFrame, "#")
+	if !found {
+		return nil, fmt.Errorf("CAN帧格式无效 '%s'", canFrame)
+	}
+
+	// 解析CAN ID，candump 用8位十六进制表示扩展帧
+	id, err := strconv.ParseUint(idStr, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("CAN ID解析失败 '%s': %w", idStr, err)
+	}
+	frame := &CANFrame{ID: uint32(id), Extended: len(idStr) == 8}
+	if frame.Extended && frame.ID&candumpErrorFlag != 0 {
+		frame.Error = true
+		frame.Extended = false
+		frame.ID &^= candumpErrorFlag
+	}
+
+	switch {
+	case strings.HasPrefix(dataStr, "R"):
+		if frame.Error {
+			return nil, fmt.Errorf("错误帧不能为远程帧 '%s'", canFrame)
+		}
+		frame.Remote = true
+		return frame, nil
+	case strings.HasPrefix(dataStr, "#"):
+		if len(dataStr) < 2 {
+			return nil, fmt.Errorf("CAN FD 帧缺少标志位 '%s'", canFrame)
+		}
+		flags, err := strconv.ParseUint(dataStr[1:2], 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("CAN FD 标志位解析失败 '%s': %w", dataStr[1:2], err)
+		}
+		frame.FD = true
+		frame.BRS = flags&candumpFDFlagBRS != 0
+		frame.ESI = flags&candumpFDFlagESI != 0
+		dataStr = dataStr[2:]
+	default:
+		// 经典帧的数据后可能附带 _<DLC>，只保留数据部分
+		dataStr, _, _ = strings.Cut(dataStr, "_")
+	}
+	dataStr = strings.ReplaceAll(dataStr, ".", "")
+
+	// 解码十六进制数据
+	if len(dataStr)%2 != 0 {
+		return nil, fmt.Errorf("CAN数据长度必须为偶数，当前长度%d", len(dataStr))
+	}
+	data, err := hex.DecodeString(dataStr)
+	if err != nil {
+		return nil, fmt.Errorf("CAN数据解码失败: %w", err)
+	}
+	if frame.FD && !validFDLength(len(data)) {
+		return nil, fmt.Errorf("CAN FD 数据长度无效: %d", len(data))
+	}
+	if !frame.FD && len(data) > canMaxClassicLen {
+		return nil, fmt.Errorf("经典CAN帧数据长度超过8字节: %d", len(data))
+	}
+	frame.Data = data
+	return frame, nil
+}
+
+// candumpChannel 将接口名（如 can0）换算为从1开始的通道号，无法识别时返回0
+func candumpChannel(iface string) int {
+	i := len(iface)
+	for i > 0 && iface[i-1] >= '0' && iface[i-1] <= '9' {
+		i--
+	}
+	n, err := strconv.Atoi(iface[i:])
+	if err != nil {
+		return 0
+	}
+	return n + 1
+}
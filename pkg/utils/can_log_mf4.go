@@ -0,0 +1,597 @@
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterCANLogFormat(&CANLogFormat{
+		Name:       "mf4",
+		Extensions: []string{".mf4", ".mdf"},
+		Detect: func(header []byte) bool {
+			return len(header) >= 12 && bytes.HasPrefix(header, []byte("MDF     ")) && header[8] == '4'
+		},
+		NewReader: func(r io.Reader) (CANLogReader, error) {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return nil, err
+			}
+			return newMF4Reader(bytes.NewReader(data), int64(len(data)))
+		},
+		NewReaderAt: func(r io.ReaderAt, size int64) (CANLogReader, error) {
+			return newMF4Reader(r, size)
+		},
+	})
+}
+
+// MDF4 块结构尺寸
+const (
+	mdfHeaderAddr      = 64 // HD 块固定位于 ID 块之后
+	mdfBlockHeaderSize = 24 // 块头：标识、保留字段、块长度、链接数
+)
+
+// MDF4 通道类型、数据类型和转换类型
+const (
+	mdfChannelVLSD          = 1
+	mdfChannelMaster        = 2
+	mdfChannelVirtualMaster = 3
+	mdfSyncTime             = 1
+
+	mdfDataUintLE  = 0
+	mdfDataUintBE  = 1
+	mdfDataIntLE   = 2
+	mdfDataIntBE   = 3
+	mdfDataFloatLE = 4
+	mdfDataFloatBE = 5
+
+	mdfConversionIdentity = 0
+	mdfConversionLinear   = 1
+
+	mdfCGFlagVLSD       = 0x1
+	mdfHDFlagLocalTime  = 0x1
+	mdfDZZipTranspose   = 1
+	mdfBusFrameDataName = "CAN_DataFrame"
+)
+
+// mdfBlock 是一个已读取的 MDF4 块
+type mdfBlock struct {
+	id    string
+	links []uint64
+	data  []byte
+}
+
+// mdfChannel 描述记录中某个通道的位置和编码
+type mdfChannel struct {
+	name       string
+	cnType     uint8
+	syncType   uint8
+	dataType   uint8
+	bitOffset  uint32 // 相对记录起点的位偏移
+	bitCount   uint32
+	factor     float64
+	offset     float64
+	vlsdDataAt uint64 // VLSD 通道的数据块或 VLSD 通道组地址
+}
+
+// mdfCANGroup 描述一个符合 ASAM 总线记录约定的 CAN_DataFrame 通道组
+type mdfCANGroup struct {
+	recordID   uint64
+	recordSize int
+	channel    int // 由通道组名推断的默认通道号
+	master     *mdfChannel
+	fields     map[string]*mdfChannel // CAN_DataFrame 的子通道，按 ID、IDE、DLC 等短名索引
+	sdData     []byte                 // 有序数据组中 VLSD DataBytes 的信号数据
+	vlsdGroup  uint64                 // 无序数据组中 VLSD DataBytes 所在通道组的记录ID
+	vlsdStream bool                   // DataBytes 是否存放在无序数据流的 VLSD 通道组中
+}
+
+// mf4Reader 读取 ASAM MDF4 (.mf4) 总线记录文件中的 CAN 数据帧。
+// 各数据组中的报文在打开时全部解码并按时间排序，内存占用与文件中的帧数成正比，不是流式读取；
+// 压缩或归档中的 MF4 文件还会先把整个文件读入内存。评估窗口只减少解码的帧数，不减少读取的帧数。
+type mf4Reader struct {
+	r         io.ReaderAt
+	size      int64
+	startTime int64 // 记录开始时间（Unix 微秒）
+	frames    []*CANFrame
+	next      int
+}
+
+func newMF4Reader(r io.ReaderAt, size int64) (*mf4Reader, error) {
+	m := &mf4Reader{r: r, size: size}
+	hd, err := m.readBlock(mdfHeaderAddr)
+	if err != nil {
+		return nil, err
+	}
+	if hd.id != "##HD" || len(hd.links) < 1 || len(hd.data) < 13 {
+		return nil, fmt.Errorf("MF4 文件缺少有效的 HD 块")
+	}
+	m.startTime = mdfStartTime(hd.data)
+
+	for dgAddr := hd.links[0]; dgAddr != 0; {
+		dg, err := m.readBlock(dgAddr)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.readDataGroup(dg); err != nil {
+			return nil, err
+		}
+		dgAddr = dg.links[0]
+	}
+	sort.SliceStable(m.frames, func(i, j int) bool { return m.frames[i].Timestamp < m.frames[j].Timestamp })
+	return m, nil
+}
+
+// mdfStartTime 解析 HD 块中的开始时间，返回 Unix 微秒
+func mdfStartTime(data []byte) int64 {
+	ns := int64(binary.LittleEndian.Uint64(data[0:8]))
+	if data[12]&mdfHDFlagLocalTime == 0 {
+		return ns / 1000
+	}
+	// 本地时间：把数值按墙上时间解释
+	t := time.Unix(0, ns).UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local).UnixMicro()
+}
+
+// Next 返回下一帧报文
+func (m *mf4Reader) Next() (*CANFrame, error) {
+	if m.next >= len(m.frames) {
+		return nil, io.EOF
+	}
+	frame := m.frames[m.next]
+	m.frames[m.next] = nil
+	m.next++
+	return frame, nil
+}
+
+// readBlock 读取指定地址的块
+func (m *mf4Reader) readBlock(addr uint64) (*mdfBlock, error) {
+	if int64(addr)+mdfBlockHeaderSize > m.size {
+		return nil, fmt.Errorf("MF4 块地址越界: 0x%X", addr)
+	}
+	head := make([]byte, mdfBlockHeaderSize)
+	if _, err := m.r.ReadAt(head, int64(addr)); err != nil {
+		return nil, fmt.Errorf("读取 MF4 块头 0x%X 失败: %w", addr, err)
+	}
+	if !bytes.HasPrefix(head, []byte("##")) {
+		return nil, fmt.Errorf("MF4 块 0x%X 标识无效", addr)
+	}
+	length := binary.LittleEndian.Uint64(head[8:16])
+	linkCount := binary.LittleEndian.Uint64(head[16:24])
+	if length < mdfBlockHeaderSize+linkCount*8 || int64(addr+length) > m.size {
+		return nil, fmt.Errorf("MF4 块 0x%X 长度无效", addr)
+	}
+	body := make([]byte, length-mdfBlockHeaderSize)
+	if _, err := m.r.ReadAt(body, int64(addr)+mdfBlockHeaderSize); err != nil {
+		return nil, fmt.Errorf("读取 MF4 块 0x%X 失败: %w", addr, err)
+	}
+	block := &mdfBlock{id: string(head[:4]), links: make([]uint64, linkCount)}
+	for i := range block.links {
+		block.links[i] = binary.LittleEndian.Uint64(body[i*8:])
+	}
+	block.data = body[linkCount*8:]
+	return block, nil
+}
+
+// readText 读取 TX 块中的文本
+func (m *mf4Reader) readText(addr uint64) string {
+	if addr == 0 {
+		return ""
+	}
+	block, err := m.readBlock(addr)
+	if err != nil || block.id != "##TX" {
+		return ""
+	}
+	return strings.TrimRight(string(block.data), "\x00")
+}
+
+// readData 读取 DT/SD/DZ/DL/HL 数据块，返回拼接并解压后的数据
+func (m *mf4Reader) readData(addr uint64) ([]byte, error) {
+	if addr == 0 {
+		return nil, nil
+	}
+	block, err := m.readBlock(addr)
+	if err != nil {
+		return nil, err
+	}
+	switch block.id {
+	case "##DT", "##SD", "##RD":
+		return block.data, nil
+	case "##DZ":
+		return mdfInflate(block.data)
+	case "##DL":
+		var out []byte
+		for dl := block; dl != nil; {
+			count := int(binary.LittleEndian.Uint32(dl.data[4:8]))
+			for i := 1; i <= count && i < len(dl.links); i++ {
+				part, err := m.readData(dl.links[i])
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, part...)
+			}
+			if dl.links[0] == 0 {
+				break
+			}
+			if dl, err = m.readBlock(dl.links[0]); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case "##HL":
+		return m.readData(block.links[0])
+	}
+	return nil, fmt.Errorf("不支持的 MF4 数据块 %s", block.id)
+}
+
+// mdfInflate 解压 DZ 块，必要时还原转置
+func mdfInflate(data []byte) ([]byte, error) {
+	if len(data) < 24 {
+		return nil, fmt.Errorf("DZ 块长度不足")
+	}
+	zipType := data[2]
+	columns := int(binary.LittleEndian.Uint32(data[4:8]))
+	origLen := binary.LittleEndian.Uint64(data[8:16])
+	zr, err := zlib.NewReader(bytes.NewReader(data[24:]))
+	if err != nil {
+		return nil, fmt.Errorf("DZ 块解压失败: %w", err)
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("DZ 块解压失败: %w", err)
+	}
+	if uint64(len(out)) != origLen {
+		return nil, fmt.Errorf("DZ 块解压长度不符: %d != %d", len(out), origLen)
+	}
+	if zipType == mdfDZZipTranspose && columns > 0 {
+		rows := len(out) / columns
+		plain := make([]byte, len(out))
+		for i := 0; i < rows*columns; i++ {
+			plain[(i%rows)*columns+i/rows] = out[i]
+		}
+		copy(plain[rows*columns:], out[rows*columns:])
+		out = plain
+	}
+	return out, nil
+}
+
+// readChannel 读取 CN 块及其线性转换规则
+func (m *mf4Reader) readChannel(cn *mdfBlock) (*mdfChannel, error) {
+	if len(cn.links) < 6 || len(cn.data) < 16 {
+		return nil, fmt.Errorf("MF4 CN 块不完整")
+	}
+	ch := &mdfChannel{
+		name:       m.readText(cn.links[2]),
+		cnType:     cn.data[0],
+		syncType:   cn.data[1],
+		dataType:   cn.data[2],
+		bitOffset:  binary.LittleEndian.Uint32(cn.data[4:8])*8 + uint32(cn.data[3]),
+		bitCount:   binary.LittleEndian.Uint32(cn.data[8:12]),
+		factor:     1,
+		vlsdDataAt: cn.links[5],
+	}
+	if cn.links[4] != 0 {
+		cc, err := m.readBlock(cn.links[4])
+		if err != nil {
+			return nil, err
+		}
+		if len(cc.data) >= 40 {
+			switch cc.data[0] {
+			case mdfConversionIdentity:
+			case mdfConversionLinear:
+				ch.offset = math.Float64frombits(binary.LittleEndian.Uint64(cc.data[24:32]))
+				ch.factor = math.Float64frombits(binary.LittleEndian.Uint64(cc.data[32:40]))
+			default:
+				return nil, fmt.Errorf("通道 %s 使用了不支持的转换类型 %d", ch.name, cc.data[0])
+			}
+		}
+	}
+	return ch, nil
+}
+
+// readCANGroup 解析通道组，不符合 CAN_DataFrame 约定时返回 nil
+func (m *mf4Reader) readCANGroup(cg *mdfBlock) (*mdfCANGroup, error) {
+	if len(cg.links) < 3 {
+		return nil, fmt.Errorf("MF4 CG 块不完整")
+	}
+	group := &mdfCANGroup{
+		recordID:   binary.LittleEndian.Uint64(cg.data[0:8]),
+		recordSize: int(binary.LittleEndian.Uint32(cg.data[24:28]) + binary.LittleEndian.Uint32(cg.data[28:32])),
+		channel:    mdfGroupChannel(m.readText(cg.links[2])),
+		fields:     make(map[string]*mdfChannel),
+	}
+	var frameCN *mdfBlock
+	for cnAddr := cg.links[1]; cnAddr != 0; {
+		cn, err := m.readBlock(cnAddr)
+		if err != nil {
+			return nil, err
+		}
+		ch, err := m.readChannel(cn)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case (ch.cnType == mdfChannelMaster || ch.cnType == mdfChannelVirtualMaster) && ch.syncType == mdfSyncTime:
+			group.master = ch
+		case ch.name == mdfBusFrameDataName || strings.HasSuffix(ch.name, "."+mdfBusFrameDataName):
+			frameCN = cn
+		}
+		cnAddr = cn.links[0]
+	}
+	if frameCN == nil || group.master == nil {
+		return nil, nil
+	}
+	// CAN_DataFrame 是结构通道，其组合链接指向各个子通道
+	for cnAddr := frameCN.links[1]; cnAddr != 0; {
+		cn, err := m.readBlock(cnAddr)
+		if err != nil {
+			return nil, err
+		}
+		ch, err := m.readChannel(cn)
+		if err != nil {
+			return nil, err
+		}
+		group.fields[ch.name[strings.LastIndex(ch.name, ".")+1:]] = ch
+		cnAddr = cn.links[0]
+	}
+	if group.fields["ID"] == nil || group.fields["DataBytes"] == nil {
+		return nil, fmt.Errorf("CAN_DataFrame 缺少 ID 或 DataBytes 子通道")
+	}
+	return group, nil
+}
+
+// mdfGroupChannel 从通道组名（如 CAN1）中推断通道号
+func mdfGroupChannel(name string) int {
+	name = strings.TrimPrefix(strings.ToUpper(name), "CAN")
+	n := 0
+	for _, c := range name {
+		if c < '0' || c > '9' {
+			break
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n
+}
+
+// readDataGroup 解码一个数据组中的全部 CAN 数据帧，支持有序和无序记录
+func (m *mf4Reader) readDataGroup(dg *mdfBlock) error {
+	if len(dg.links) < 3 || len(dg.data) < 1 {
+		return fmt.Errorf("MF4 DG 块不完整")
+	}
+	recIDSize := int(dg.data[0])
+	canGroups := make(map[uint64]*mdfCANGroup)
+	recordSizes := make(map[uint64]int)
+	vlsdGroups := make(map[uint64]bool)
+	vlsdByAddr := make(map[uint64]uint64)
+	for cgAddr := dg.links[1]; cgAddr != 0; {
+		cg, err := m.readBlock(cgAddr)
+		if err != nil {
+			return err
+		}
+		if len(cg.links) < 2 || len(cg.data) < 32 {
+			return fmt.Errorf("MF4 CG 块不完整")
+		}
+		recordID := binary.LittleEndian.Uint64(cg.data[0:8])
+		flags := binary.LittleEndian.Uint16(cg.data[16:18])
+		if flags&mdfCGFlagVLSD != 0 {
+			vlsdGroups[recordID] = true
+			vlsdByAddr[cgAddr] = recordID
+		} else {
+			recordSizes[recordID] = int(binary.LittleEndian.Uint32(cg.data[24:28]) + binary.LittleEndian.Uint32(cg.data[28:32]))
+			group, err := m.readCANGroup(cg)
+			if err != nil {
+				return err
+			}
+			if group != nil {
+				canGroups[recordID] = group
+			}
+		}
+		cgAddr = cg.links[0]
+	}
+	if len(canGroups) == 0 {
+		return nil
+	}
+
+	// 有序数据组中 VLSD DataBytes 的数据存放在单独的 SD 块中
+	vlsdData := make(map[uint64]map[uint64][]byte)
+	for _, group := range canGroups {
+		dataBytes := group.fields["DataBytes"]
+		if dataBytes.cnType != mdfChannelVLSD {
+			continue
+		}
+		if id, ok := vlsdByAddr[dataBytes.vlsdDataAt]; ok {
+			vlsdData[id] = make(map[uint64][]byte)
+			group.vlsdGroup = id
+			group.vlsdStream = true
+			continue
+		}
+		sd, err := m.readData(dataBytes.vlsdDataAt)
+		if err != nil {
+			return err
+		}
+		group.sdData = sd
+	}
+
+	data, err := m.readData(dg.links[2])
+	if err != nil {
+		return err
+	}
+	vlsdOffsets := make(map[uint64]uint64)
+	for pos := 0; pos < len(data); {
+		var recordID uint64
+		if recIDSize > 0 {
+			if pos+recIDSize > len(data) {
+				return fmt.Errorf("MF4 记录ID越界")
+			}
+			recordID = mdfUint(data[pos:pos+recIDSize], 0, uint32(recIDSize*8), false)
+			pos += recIDSize
+		}
+		if vlsdGroups[recordID] {
+			if pos+4 > len(data) {
+				return fmt.Errorf("MF4 VLSD 记录越界")
+			}
+			n := int(binary.LittleEndian.Uint32(data[pos : pos+4]))
+			if pos+4+n > len(data) {
+				return fmt.Errorf("MF4 VLSD 记录越界")
+			}
+			if store, ok := vlsdData[recordID]; ok {
+				store[vlsdOffsets[recordID]] = data[pos+4 : pos+4+n]
+			}
+			vlsdOffsets[recordID] += uint64(4 + n)
+			pos += 4 + n
+			continue
+		}
+		size, ok := recordSizes[recordID]
+		if !ok {
+			return fmt.Errorf("MF4 记录ID %d 未定义", recordID)
+		}
+		if pos+size > len(data) {
+			return fmt.Errorf("MF4 记录越界")
+		}
+		if group := canGroups[recordID]; group != nil {
+			frame, err := m.decodeRecord(group, data[pos:pos+size], vlsdData)
+			if err != nil {
+				return err
+			}
+			if frame != nil {
+				m.frames = append(m.frames, frame)
+			}
+		}
+		pos += size
+	}
+	return nil
+}
+
+// decodeRecord 把一条 CAN_DataFrame 记录解码为 CAN 帧
+func (m *mf4Reader) decodeRecord(group *mdfCANGroup, record []byte, vlsdData map[uint64]map[uint64][]byte) (*CANFrame, error) {
+	seconds := group.master.value(record)
+	frame := &CANFrame{
+		Timestamp: m.startTime + int64(math.Round(seconds*1e6)),
+		Channel:   group.channel,
+	}
+	frame.setID(uint32(group.fields["ID"].raw(record)))
+	if ch := group.fields["IDE"]; ch != nil && ch.raw(record) != 0 {
+		frame.Extended = true
+	}
+	if ch := group.fields["BusChannel"]; ch != nil {
+		frame.Channel = int(ch.raw(record))
+	}
+	if ch := group.fields["Dir"]; ch != nil {
+		frame.Tx = ch.raw(record) != 0
+	}
+	if ch := group.fields["EDL"]; ch != nil {
+		frame.FD = ch.raw(record) != 0
+	}
+	if ch := group.fields["BRS"]; ch != nil {
+		frame.BRS = ch.raw(record) != 0
+	}
+	if ch := group.fields["ESI"]; ch != nil {
+		frame.ESI = ch.raw(record) != 0
+	}
+
+	length := -1
+	if ch := group.fields["DataLength"]; ch != nil {
+		length = int(ch.raw(record))
+	} else if ch := group.fields["DLC"]; ch != nil {
+		dlc := int(ch.raw(record) & 0x0F)
+		length = dlc
+		if frame.FD {
+			length = canFDLengths[dlc]
+		}
+	}
+
+	dataBytes := group.fields["DataBytes"]
+	var payload []byte
+	if dataBytes.cnType == mdfChannelVLSD {
+		offset := dataBytes.raw(record)
+		if group.vlsdStream {
+			store := vlsdData[group.vlsdGroup]
+			payload = store[offset]
+			delete(store, offset)
+		} else if offset+4 <= uint64(len(group.sdData)) {
+			n := uint64(binary.LittleEndian.Uint32(group.sdData[offset:]))
+			if offset+4+n <= uint64(len(group.sdData)) {
+				payload = group.sdData[offset+4 : offset+4+n]
+			}
+		}
+	} else {
+		start := dataBytes.bitOffset / 8
+		end := start + dataBytes.bitCount/8
+		if int(end) > len(record) {
+			return nil, fmt.Errorf("DataBytes 超出记录长度")
+		}
+		payload = record[start:end]
+	}
+	if length >= 0 && length < len(payload) {
+		payload = payload[:length]
+	}
+	frame.Data = bytes.Clone(payload)
+	return frame, nil
+}
+
+// raw 读取通道的原始整数值
+func (c *mdfChannel) raw(record []byte) uint64 {
+	bigEndian := c.dataType == mdfDataUintBE || c.dataType == mdfDataIntBE || c.dataType == mdfDataFloatBE
+	return mdfUint(record, c.bitOffset, c.bitCount, bigEndian)
+}
+
+// value 读取通道的物理值
+func (c *mdfChannel) value(record []byte) float64 {
+	raw := c.raw(record)
+	var v float64
+	switch c.dataType {
+	case mdfDataIntLE, mdfDataIntBE:
+		shift := 64 - c.bitCount
+		v = float64(int64(raw<<shift) >> shift)
+	case mdfDataFloatLE, mdfDataFloatBE:
+		if c.bitCount == 32 {
+			v = float64(math.Float32frombits(uint32(raw)))
+		} else {
+			v = math.Float64frombits(raw)
+		}
+	default:
+		v = float64(raw)
+	}
+	return v*c.factor + c.offset
+}
+
+// mdfUint 从记录中按位提取无符号整数，最长64位
+func mdfUint(record []byte, bitOffset, bitCount uint32, bigEndian bool) uint64 {
+	if bitCount == 0 || bitCount > 64 {
+		return 0
+	}
+	start := int(bitOffset / 8)
+	end := int((bitOffset + bitCount + 7) / 8)
+	if end > len(record) {
+		return 0
+	}
+	var v uint64
+	if bigEndian {
+		for i := start; i < end; i++ {
+			v = v<<8 | uint64(record[i])
+		}
+		v >>= uint(end*8) - uint(bitOffset+bitCount)
+	} else {
+		// 起始位不在字节边界时，64位值可能横跨9个字节
+		for i := start; i < end; i++ {
+			shift := 8*(i-start) - int(bitOffset%8)
+			if shift >= 0 {
+				v |= uint64(record[i]) << shift
+			} else {
+				v |= uint64(record[i]) >> -shift
+			}
+		}
+	}
+	if bitCount < 64 {
+		v &= 1<<bitCount - 1
+	}
+	return v
+}
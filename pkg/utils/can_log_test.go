@@ -0,0 +1,433 @@
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDBC = `VERSION ""
+
+BO_ 291 Accel: 8 ACU
+ SG_ LongitudinalAcceleration : 0|8@1+ (0.1,0) [0|25.5] "g" Vector__XXX
+
+BO_ 2566844672 Truck: 8 ECU
+ SG_ EngineSpeed : 0|8@1+ (1,0) [0|255] "rpm" Vector__XXX
+`
+
+// writeTestFile 在临时目录中写入测试文件并返回路径
+func writeTestFile(t testing.TB, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+// readAllFrames 读取日志中的全部报文帧
+func readAllFrames(t *testing.T, path string) (string, []*CANFrame) {
+	t.Helper()
+	canLog, err := OpenCANLog(path)
+	require.NoError(t, err)
+	defer canLog.Close()
+	var frames []*CANFrame
+	for {
+		frame, err := canLog.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		frames = append(frames, frame)
+	}
+	return canLog.Name(), frames
+}
+
+func TestReadASCLog(t *testing.T) {
+	start := time.Date(2022, 1, 10, 10, 0, 0, 0, time.Local).UnixMicro()
+
+	t.Run("绝对时间戳", func(t *testing.T) {
+		path := writeTestFile(t, "trace.asc", `date Mon Jan 10 10:00:00.000 am 2022
+base hex  timestamps absolute
+internal events logged
+// version 13.0.0
+Begin Triggerblock Mon Jan 10 10:00:00.000 am 2022
+   0.000000 Start of measurement
+   0.010000 1  123             Rx   d 8 0F 00 00 00 00 00 00 00  Length = 0 BitCount = 0 ID = 291
+   0.015000 1  ErrorFrame
+   0.020000 2  18FEF100x       Tx   d 2 AA BB
+   0.030000 1  123             Rx   r
+   0.040000 CANFD   3 Rx        1A0x  ChassisFD                        1 0 9    12 00 01 02 03 04 05 06 07 08 09 0a 0b   0    0   1000 0 0 0 0 0
+   0.050000 CANFD   3 Tx        1A1                                   0 1 2     2 AA BB   0    0   1000 0 0 0 0 0
+End TriggerBlock
+`)
+		format, frames := readAllFrames(t, path)
+		assert.Equal(t, "asc", format)
+		require.Len(t, frames, 6)
+		assert.Equal(t, start+10000, frames[0].Timestamp)
+		assert.Equal(t, uint32(0x123), frames[0].ID)
+		assert.False(t, frames[0].Extended)
+		assert.Equal(t, 1, frames[0].Channel)
+		assert.Equal(t, []byte{0x0F, 0, 0, 0, 0, 0, 0, 0}, frames[0].Data)
+		assert.True(t, frames[1].Error)
+		assert.Equal(t, start+15000, frames[1].Timestamp)
+		assert.Equal(t, uint32(0x18FEF100), frames[2].ID)
+		assert.True(t, frames[2].Extended)
+		assert.True(t, frames[2].Tx)
+		assert.Equal(t, 2, frames[2].Channel)
+		assert.True(t, frames[3].Remote)
+		assert.Equal(t, uint32(0x123), frames[3].ID)
+
+		fd := frames[4]
+		assert.True(t, fd.FD)
+		assert.True(t, fd.BRS)
+		assert.False(t, fd.ESI)
+		assert.True(t, fd.Extended)
+		assert.Equal(t, uint32(0x1A0), fd.ID)
+		assert.Equal(t, 3, fd.Channel)
+		assert.Len(t, fd.Data, 12)
+		assert.Equal(t, byte(0x0B), fd.Data[11])
+		assert.True(t, frames[5].ESI)
+		assert.True(t, frames[5].Tx)
+		assert.Equal(t, []byte{0xAA, 0xBB}, frames[5].Data)
+	})
+
+	t.Run("相对时间戳与十进制", func(t *testing.T) {
+		path := writeTestFile(t, "trace.asc", `date Mon Jan 10 10:00:00.000 am 2022
+base dec  timestamps relative
+   0.010000 1  291             Rx   d 1 15
+   0.005000 1  291             Rx   d 1 16
+`)
+		_, frames := readAllFrames(t, path)
+		require.Len(t, frames, 2)
+		assert.Equal(t, start+10000, frames[0].Timestamp)
+		assert.Equal(t, start+15000, frames[1].Timestamp)
+		assert.Equal(t, uint32(0x123), frames[1].ID)
+		assert.Equal(t, []byte{16}, frames[1].Data)
+	})
+}
+
+func TestReadTRCLog(t *testing.T) {
+	// 43133.5 即 2018-02-02 12:00:00
+	start := time.Date(2018, 2, 2, 12, 0, 0, 0, time.Local).UnixMicro()
+
+	t.Run("v1.1", func(t *testing.T) {
+		path := writeTestFile(t, "trace.trc", `;$FILEVERSION=1.1
+;$STARTTIME=43133.5
+;
+;   Message Number
+;   |         Time Offset (ms)
+;---+--   ----+----  --+--  ----+---  +  -+ -- -- -- -- -- -- --
+     1)      1841.0  Rx         0123  8  0F 00 00 00 00 00 00 00
+     2)      1842.5  Rx     18FEF100  1  20
+     3)      1843.0  Warng  FFFFFFFF  4  00 00 00 08  BUSHEAVY
+`)
+		format, frames := readAllFrames(t, path)
+		assert.Equal(t, "trc", format)
+		require.Len(t, frames, 2)
+		assert.Equal(t, start+1841000, frames[0].Timestamp)
+		assert.Equal(t, uint32(0x123), frames[0].ID)
+		assert.Equal(t, start+1842500, frames[1].Timestamp)
+		assert.True(t, frames[1].Extended)
+	})
+
+	t.Run("v2.1", func(t *testing.T) {
+		path := writeTestFile(t, "trace.trc", `;$FILEVERSION=2.1
+;$STARTTIME=43133.5
+;$COLUMNS=N,O,T,B,I,d,R,L,D
+;
+      1      1059.900 DT 1      0123 Rx -  8    0F 00 00 00 00 00 00 00
+      2      1060.000 ST 1      Rx    00 00 00 08
+      3      1061.000 DT 2  18FEF100 Tx -  2    AA BB
+      4      1062.000 FB 1      01A0 Rx -  9    00 01 02 03 04 05 06 07 08 09 0A 0B
+      5      1063.000 RR 1      0123 Rx -  8
+      6      1064.000 ER 1      -    Rx -  5    04 00 08 00 00
+`)
+		_, frames := readAllFrames(t, path)
+		require.Len(t, frames, 5)
+		assert.Equal(t, start+1059900, frames[0].Timestamp)
+		assert.Equal(t, 1, frames[0].Channel)
+		assert.Equal(t, 2, frames[1].Channel)
+		assert.True(t, frames[1].Tx)
+		assert.Equal(t, []byte{0xAA, 0xBB}, frames[1].Data)
+		assert.True(t, frames[2].FD)
+		assert.True(t, frames[2].BRS)
+		assert.Len(t, frames[2].Data, 12)
+		assert.True(t, frames[3].Remote)
+		assert.Empty(t, frames[3].Data)
+		assert.True(t, frames[4].Error)
+		assert.Equal(t, start+1064000, frames[4].Timestamp)
+	})
+}
+
+func TestDetectCANLogFormat(t *testing.T) {
+	cases := []struct {
+		path   string
+		header string
+		want   string
+	}{
+		{"a.log", "(1620000000) can0 123#00", "candump"},
+		{"a.txt", "date Mon Jan 10 10:00:00.000 am 2022\n", "asc"},
+		{"a.txt", ";$FILEVERSION=2.1\n", "trc"},
+		{"a.trc", "", "trc"},
+		{"a.can", "", "candump"},
+	}
+	for _, c := range cases {
+		format, err := DetectCANLogFormat(c.path, []byte(c.header))
+		require.NoError(t, err)
+		assert.Equal(t, c.want, format.Name, c.path)
+	}
+}
+
+func TestParseCANLogWithDBCFormats(t *testing.T) {
+	dbcPath := writeTestFile(t, "test.dbc", testDBC)
+	logs := map[string]string{
+		"trace.can": "(1000) can0 123#0F00000000000000\n",
+		"trace.asc": "date Mon Jan 10 10:00:00.000 am 2022\nbase hex  timestamps absolute\n   0.010000 1  123  Rx   d 8 0F 00 00 00 00 00 00 00\n",
+		"trace.trc": ";$FILEVERSION=1.1\n;$STARTTIME=43133.5\n     1)      1841.0  Rx         0123  8  0F 00 00 00 00 00 00 00\n",
+	}
+	for name, content := range logs {
+		t.Run(strings.TrimPrefix(filepath.Ext(name), "."), func(t *testing.T) {
+			logPath := writeTestFile(t, name, content)
+			sigMap, tsList, err := ParseCANLogWithDBC(logPath, dbcPath, []string{"LongitudinalAcceleration"})
+			require.NoError(t, err)
+			require.Len(t, tsList, 1)
+			assert.InDelta(t, 1.5, sigMap[tsList[0]]["LongitudinalAcceleration"], 1e-9)
+		})
+	}
+}
+
+// blfTestObject 构造一个 v1 对象头的 BLF 对象，时间戳单位为10微秒
+func blfTestObject(objType uint32, ticks uint64, payload []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("LOBJ")
+	binary.Write(&b, binary.LittleEndian, uint16(32))
+	binary.Write(&b, binary.LittleEndian, uint16(1))
+	binary.Write(&b, binary.LittleEndian, uint32(32+len(payload)))
+	binary.Write(&b, binary.LittleEndian, objType)
+	binary.Write(&b, binary.LittleEndian, uint32(blfTimeTenMicros))
+	binary.Write(&b, binary.LittleEndian, uint16(0))
+	binary.Write(&b, binary.LittleEndian, uint16(0))
+	binary.Write(&b, binary.LittleEndian, ticks)
+	b.Write(payload)
+	b.Write(make([]byte, b.Len()%4))
+	return b.Bytes()
+}
+
+// blfTestContainer 把对象数据打包为 zlib 压缩的 LOG_CONTAINER
+func blfTestContainer(data []byte) []byte {
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(data)
+	zw.Close()
+	var b bytes.Buffer
+	size := blfObjectHeaderBase + blfLogContainerSize + z.Len()
+	b.WriteString("LOBJ")
+	binary.Write(&b, binary.LittleEndian, uint16(blfObjectHeaderBase))
+	binary.Write(&b, binary.LittleEndian, uint16(1))
+	binary.Write(&b, binary.LittleEndian, uint32(size))
+	binary.Write(&b, binary.LittleEndian, uint32(blfObjLogContainer))
+	binary.Write(&b, binary.LittleEndian, uint16(blfCompressionZlib))
+	b.Write(make([]byte, 6))
+	binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+	b.Write(make([]byte, 4))
+	b.Write(z.Bytes())
+	b.Write(make([]byte, size%4))
+	return b.Bytes()
+}
+
+func TestReadBLFLog(t *testing.T) {
+	header := make([]byte, 144)
+	copy(header, "LOGG")
+	binary.LittleEndian.PutUint32(header[4:], 144)
+	for i, v := range []uint16{2022, 1, 1, 10, 10, 0, 0, 0} {
+		binary.LittleEndian.PutUint16(header[40+i*2:], v)
+	}
+	start := time.Date(2022, 1, 10, 10, 0, 0, 0, time.Local).UnixMicro()
+
+	// CAN_MESSAGE：通道1，接收，ID 0x123
+	canMsg := make([]byte, 16)
+	binary.LittleEndian.PutUint16(canMsg[0:], 1)
+	canMsg[3] = 8
+	binary.LittleEndian.PutUint32(canMsg[4:], 0x123)
+	canMsg[8] = 0x0F
+	// CAN_FD_MESSAGE_64：通道2，发送，扩展帧，12字节数据
+	fdMsg := make([]byte, 40+12)
+	fdMsg[0], fdMsg[1], fdMsg[2] = 2, 9, 12
+	binary.LittleEndian.PutUint32(fdMsg[4:], 0x18FEF100|0x80000000)
+	binary.LittleEndian.PutUint32(fdMsg[12:], blfFD64EDL|blfFD64BRS)
+	fdMsg[34] = 1
+	for i := 0; i < 12; i++ {
+		fdMsg[40+i] = byte(i)
+	}
+	// 远程帧不带数据
+	remote := bytes.Clone(canMsg)
+	remote[2] = blfCANMsgRemote
+
+	objects := append(blfTestObject(blfObjCANMessage, 1000, canMsg), blfTestObject(blfObjCANMessage, 1500, remote)...)
+	objects = append(objects, blfTestObject(blfObjCANFDMessage64, 2000, fdMsg)...)
+	// 把对象流从中间切开放入两个容器，验证跨容器对象的拼接
+	split := len(objects) - 30
+	content := append(header, blfTestContainer(objects[:split])...)
+	content = append(content, blfTestContainer(objects[split:])...)
+
+	path := writeTestFile(t, "trace.can", string(content))
+	format, frames := readAllFrames(t, path)
+	assert.Equal(t, "blf", format)
+	require.Len(t, frames, 3)
+	assert.Equal(t, start+10000, frames[0].Timestamp)
+	assert.Equal(t, 1, frames[0].Channel)
+	assert.Equal(t, uint32(0x123), frames[0].ID)
+	assert.Equal(t, []byte{0x0F, 0, 0, 0, 0, 0, 0, 0}, frames[0].Data)
+	assert.True(t, frames[1].Remote)
+	assert.Empty(t, frames[1].Data)
+	fd := frames[2]
+	assert.Equal(t, start+20000, fd.Timestamp)
+	assert.Equal(t, uint32(0x18FEF100), fd.ID)
+	assert.True(t, fd.Extended)
+	assert.True(t, fd.FD)
+	assert.True(t, fd.BRS)
+	assert.False(t, fd.ESI)
+	assert.True(t, fd.Tx)
+	assert.Len(t, fd.Data, 12)
+}
+
+// mf4TestBuilder 按顺序追加 MDF4 块，用于构造测试文件
+type mf4TestBuilder struct {
+	buf bytes.Buffer
+}
+
+func newMF4TestBuilder() *mf4TestBuilder {
+	b := &mf4TestBuilder{}
+	id := make([]byte, 64)
+	copy(id, "MDF     4.10    Test    ")
+	binary.LittleEndian.PutUint16(id[28:], 410)
+	b.buf.Write(id)
+	return b
+}
+
+// block 追加一个块并返回其地址
+func (b *mf4TestBuilder) block(id string, links []uint64, data []byte) uint64 {
+	addr := uint64(b.buf.Len())
+	b.buf.WriteString(id)
+	b.buf.Write(make([]byte, 4))
+	binary.Write(&b.buf, binary.LittleEndian, uint64(24+8*len(links)+len(data)))
+	binary.Write(&b.buf, binary.LittleEndian, uint64(len(links)))
+	for _, l := range links {
+		binary.Write(&b.buf, binary.LittleEndian, l)
+	}
+	b.buf.Write(data)
+	b.buf.Write(make([]byte, (8-b.buf.Len()%8)%8))
+	return addr
+}
+
+// text 追加一个 TX 块
+func (b *mf4TestBuilder) text(s string) uint64 {
+	return b.block("##TX", nil, append([]byte(s), 0))
+}
+
+// channel 追加一个 CN 块
+func (b *mf4TestBuilder) channel(next, composition uint64, name string, cnType, syncType, dataType uint8, byteOffset, bitOffset, bitCount uint32) uint64 {
+	data := make([]byte, 72)
+	data[0], data[1], data[2], data[3] = cnType, syncType, dataType, uint8(bitOffset)
+	binary.LittleEndian.PutUint32(data[4:], byteOffset)
+	binary.LittleEndian.PutUint32(data[8:], bitCount)
+	return b.block("##CN", []uint64{next, composition, b.text(name), 0, 0, 0, 0, 0}, data)
+}
+
+// canGroup 追加一个 CAN_DataFrame 通道组：8字节时间、4字节ID、1字节DLC、8字节数据
+func (b *mf4TestBuilder) canGroup(next, recordID uint64) uint64 {
+	payload := b.channel(0, 0, "CAN_DataFrame.DataBytes", 0, 0, 10, 13, 0, 64)
+	dlc := b.channel(payload, 0, "CAN_DataFrame.DLC", 0, 0, mdfDataUintLE, 12, 0, 4)
+	id := b.channel(dlc, 0, "CAN_DataFrame.ID", 0, 0, mdfDataUintLE, 8, 0, 32)
+	frame := b.channel(0, id, "CAN_DataFrame", 0, 0, 10, 8, 0, 13*8)
+	master := b.channel(frame, 0, "t", mdfChannelMaster, mdfSyncTime, mdfDataFloatLE, 0, 0, 64)
+	data := make([]byte, 32)
+	binary.LittleEndian.PutUint64(data[0:], recordID)
+	binary.LittleEndian.PutUint32(data[24:], 21)
+	return b.block("##CG", []uint64{next, master, b.text("CAN1"), 0, 0, 0}, data)
+}
+
+// mf4TestRecord 构造一条 CAN_DataFrame 记录
+func mf4TestRecord(seconds float64, id uint32, data ...byte) []byte {
+	rec := make([]byte, 21)
+	binary.LittleEndian.PutUint64(rec[0:], math.Float64bits(seconds))
+	binary.LittleEndian.PutUint32(rec[8:], id)
+	rec[12] = byte(len(data))
+	copy(rec[13:], data)
+	return rec
+}
+
+func TestReadMF4Log(t *testing.T) {
+	start := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	b := newMF4TestBuilder()
+	hdData := make([]byte, 32)
+	binary.LittleEndian.PutUint64(hdData, uint64(start.UnixNano()))
+	hdAddr := b.block("##HD", make([]uint64, 6), hdData)
+
+	// 数据组1：有序记录，数据存放在 DZ 压缩块中
+	var sorted []byte
+	sorted = append(sorted, mf4TestRecord(0.02, 0x123, 0x0F)...)
+	sorted = append(sorted, mf4TestRecord(0.04, 0x18FEF100|0x80000000, 0x01, 0x02)...)
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(sorted)
+	zw.Close()
+	dzData := make([]byte, 24)
+	copy(dzData, "DT")
+	binary.LittleEndian.PutUint64(dzData[8:], uint64(len(sorted)))
+	binary.LittleEndian.PutUint64(dzData[16:], uint64(z.Len()))
+	dz := b.block("##DZ", nil, append(dzData, z.Bytes()...))
+	dg1 := b.block("##DG", []uint64{0, b.canGroup(0, 0), dz, 0}, make([]byte, 8))
+
+	// 数据组2：无序记录，1字节记录ID，混有其他通道组的记录
+	other := make([]byte, 32)
+	binary.LittleEndian.PutUint64(other[0:], 2)
+	binary.LittleEndian.PutUint32(other[24:], 3)
+	otherCG := b.block("##CG", []uint64{0, 0, 0, 0, 0, 0}, other)
+	var unsorted []byte
+	unsorted = append(unsorted, 1)
+	unsorted = append(unsorted, mf4TestRecord(0.03, 0x123, 0x1E)...)
+	unsorted = append(unsorted, 2, 0xAA, 0xBB, 0xCC)
+	unsorted = append(unsorted, 1)
+	unsorted = append(unsorted, mf4TestRecord(0.01, 0x123, 0x05)...)
+	dt := b.block("##DT", nil, unsorted)
+	dgData := make([]byte, 8)
+	dgData[0] = 1
+	dg2 := b.block("##DG", []uint64{0, b.canGroup(otherCG, 1), dt, 0}, dgData)
+
+	content := b.buf.Bytes()
+	binary.LittleEndian.PutUint64(content[hdAddr+24:], dg1)
+	binary.LittleEndian.PutUint64(content[dg1+24:], dg2)
+
+	path := writeTestFile(t, "trace.mf4", string(content))
+	format, frames := readAllFrames(t, path)
+	assert.Equal(t, "mf4", format)
+	require.Len(t, frames, 4)
+	base := start.UnixMicro()
+	for i, want := range []int64{10000, 20000, 30000, 40000} {
+		assert.Equal(t, base+want, frames[i].Timestamp)
+	}
+	assert.Equal(t, []byte{0x05}, frames[0].Data)
+	assert.Equal(t, []byte{0x0F}, frames[1].Data)
+	assert.Equal(t, 1, frames[1].Channel)
+	assert.True(t, frames[3].Extended)
+	assert.Equal(t, uint32(0x18FEF100), frames[3].ID)
+	assert.Equal(t, []byte{0x01, 0x02}, frames[3].Data)
+
+	// 帧数据经 CANParser 的 DBC 解码
+	dbcPath := writeTestFile(t, "test.dbc", testDBC)
+	sigMap, tsList, err := ParseCANLogWithDBC(path, dbcPath, []string{"LongitudinalAcceleration"})
+	require.NoError(t, err)
+	require.Len(t, tsList, 3)
+	assert.InDelta(t, 0.5, sigMap[tsList[0]]["LongitudinalAcceleration"], 1e-9)
+	assert.InDelta(t, 3.0, sigMap[tsList[2]]["LongitudinalAcceleration"], 1e-9)
+}
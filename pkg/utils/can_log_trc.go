@@ -0,0 +1,213 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterCANLogFormat(&CANLogFormat{
+		Name:       "trc",
+		Extensions: []string{".trc"},
+		Detect: func(header []byte) bool {
+			return strings.HasPrefix(firstContentLine(header), ";$FILEVERSION")
+		},
+		NewReader: func(r io.Reader) (CANLogReader, error) {
+			return newTRCReader(r), nil
+		},
+	})
+}
+
+// trcDefaultColumns 未声明 $COLUMNS 时各版本的列布局：
+// N=序号 O=偏移(ms) T=类型 B=总线 I=ID d=方向 R=保留 L=DLC l=数据长度 D=数据
+var trcDefaultColumns = map[string]string{
+	"1.1": "N,O,T,I,L,D",
+	"2.0": "N,O,T,I,d,l,D",
+	"2.1": "N,O,T,B,I,d,R,L,D",
+}
+
+// trcOLEEpoch PEAK 使用的 OLE 自动化日期起点
+var trcOLEEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.Local)
+
+// trcReader 读取 PEAK PCAN-View (.trc) 日志，支持 v1.1 与 v2.x
+type trcReader struct {
+	scanner    *bufio.Scanner
+	lineNumber int
+	version    string
+	columns    []string
+	startTime  int64 // 文件开始时间（Unix 微秒），文件头未给出时为0
+}
+
+func newTRCReader(r io.Reader) *trcReader {
+	return &trcReader{scanner: bufio.NewScanner(r), version: "1.1"}
+}
+
+// Next 返回下一帧报文，跳过注释和非数据帧记录
+func (r *trcReader) Next() (*CANFrame, error) {
+	for r.scanner.Scan() {
+		r.lineNumber++
+		line := strings.TrimSpace(r.scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, ";") {
+			r.parseHeader(line)
+			continue
+		}
+		frame, ok, err := r.parseFrame(strings.Fields(line))
+		if err != nil {
+			return nil, &CANLogLineError{Line: r.lineNumber, Err: err}
+		}
+		if ok {
+			return frame, nil
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// parseHeader 解析 ;$KEY=VALUE 形式的文件头
+func (r *trcReader) parseHeader(line string) {
+	key, value, found := strings.Cut(strings.TrimPrefix(line, ";$"), "=")
+	if !found || !strings.HasPrefix(line, ";$") {
+		return
+	}
+	value = strings.TrimSpace(value)
+	switch strings.ToUpper(strings.TrimSpace(key)) {
+	case "FILEVERSION":
+		r.version = value
+	case "STARTTIME":
+		days, err := strconv.ParseFloat(value, 64)
+		if err == nil {
+			r.startTime = trcOLEEpoch.Add(time.Duration(days * float64(24*time.Hour))).UnixMicro()
+		}
+	case "COLUMNS":
+		r.columns = strings.Split(value, ",")
+	}
+}
+
+// trcFDTypes v2.x 中 CAN FD 数据帧的类型及对应的 BRS/ESI 标志
+var trcFDTypes = map[string][2]bool{
+	"FD": {false, false},
+	"FB": {true, false},
+	"FE": {false, true},
+	"BI": {true, true},
+}
+
+// parseFrame 按列布局解析一条报文记录
+func (r *trcReader) parseFrame(fields []string) (frame *CANFrame, ok bool, err error) {
+	columns := r.columns
+	if columns == nil {
+		layout, exists := trcDefaultColumns[r.version]
+		if !exists {
+			return nil, false, fmt.Errorf("不支持的TRC版本 '%s'", r.version)
+		}
+		columns = strings.Split(layout, ",")
+	}
+
+	frame = &CANFrame{}
+	length := -1
+	for i, col := range columns {
+		if col == "D" {
+			// 错误帧的数据列是错误计数器等诊断信息，远程帧没有数据列
+			if frame.Error || frame.Remote {
+				break
+			}
+			if i < len(fields) && fields[i] == "RTR" {
+				frame.Remote = true
+				break
+			}
+			if length < 0 {
+				return nil, false, fmt.Errorf("数据列之前缺少长度列")
+			}
+			if len(fields) < i+length {
+				return nil, false, fmt.Errorf("数据字节数不足，期望%d个", length)
+			}
+			frame.Data = make([]byte, length)
+			for j := 0; j < length; j++ {
+				b, err := strconv.ParseUint(fields[i+j], 16, 8)
+				if err != nil {
+					return nil, false, fmt.Errorf("CAN数据解码失败 '%s': %w", fields[i+j], err)
+				}
+				frame.Data[j] = byte(b)
+			}
+			break
+		}
+		if i >= len(fields) {
+			return nil, false, fmt.Errorf("字段数不足，期望至少%d个", len(columns))
+		}
+		field := fields[i]
+		switch col {
+		case "O":
+			ms, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, false, fmt.Errorf("时间偏移解析失败 '%s': %w", field, err)
+			}
+			frame.Timestamp = r.startTime + int64(math.Round(ms*1e3))
+		case "T":
+			switch field {
+			case "DT", "Rx":
+			case "Tx":
+				frame.Tx = true
+			case "RR":
+				frame.Remote = true
+			case "ER":
+				frame.Error = true
+			default:
+				flags, isFD := trcFDTypes[field]
+				if !isFD {
+					// 状态、事件等记录直接跳过
+					return nil, false, nil
+				}
+				frame.FD, frame.BRS, frame.ESI = true, flags[0], flags[1]
+			}
+		case "B":
+			channel, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, false, fmt.Errorf("总线号解析失败 '%s': %w", field, err)
+			}
+			frame.Channel = channel
+		case "I":
+			if frame.Error {
+				continue
+			}
+			id, err := strconv.ParseUint(field, 16, 32)
+			if err != nil {
+				return nil, false, fmt.Errorf("CAN ID解析失败 '%s': %w", field, err)
+			}
+			frame.ID = uint32(id)
+			frame.Extended = len(field) > 4
+		case "d":
+			frame.Tx = field == "Tx"
+		case "L":
+			// L 列为 DLC，CAN FD 帧需换算为实际字节数
+			n, err := strconv.Atoi(field)
+			if err != nil || n < 0 || n > 15 {
+				return nil, false, fmt.Errorf("DLC无效 '%s'", field)
+			}
+			if frame.FD {
+				length = canFDLengths[n]
+			} else {
+				length = min(n, canMaxClassicLen)
+			}
+		case "l":
+			// l 列直接给出数据字节数
+			n, err := strconv.Atoi(field)
+			if err != nil || n < 0 || n > canMaxFDLen || (!frame.FD && n > canMaxClassicLen) {
+				return nil, false, fmt.Errorf("数据长度无效 '%s'", field)
+			}
+			length = n
+		}
+	}
+	if frame.Data == nil && !frame.Remote && !frame.Error {
+		frame.Data = []byte{}
+	}
+	return frame, true, nil
+}
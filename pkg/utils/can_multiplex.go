@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.einride.tech/can/pkg/dbc"
+)
+
+// muxCondition 是 SG_MUL_VAL_ 定义的扩展多路复用条件：
+// 开关信号本身有效且其原始值落在任一区间内时，被复用的信号才有效。
+type muxCondition struct {
+	switchName string
+	ranges     [][2]uint64
+}
+
+// dbcExtendedMuxIndicator 匹配扩展多路复用中既被复用又作为开关的 mNM 指示符
+var dbcExtendedMuxIndicator = regexp.MustCompile(`(?m)^(\s*SG_\s+\w+\s+m\d+)M(\s*:)`)
+
+// ParseDBC 解析 DBC 文本。einride 解析器不支持扩展多路复用的 mNM 指示符，
+// 这里先改写为 mN 再解析，开关之间的层级关系由 SG_MUL_VAL_ 给出。
+func ParseDBC(name string, content []byte) (*dbc.File, error) {
+	content = dbcExtendedMuxIndicator.ReplaceAll(content, []byte("$1$2"))
+	parser := dbc.NewParser(name, content)
+	if err := parser.Parse(); err != nil {
+		return nil, fmt.Errorf("解析 DBC 文件 '%s' 失败: %w", name, err)
+	}
+	if _, err := parseMuxValues(content); err != nil {
+		return nil, fmt.Errorf("解析 DBC 文件 '%s' 失败: %w", name, err)
+	}
+	return parser.File(), nil
+}
+
+// parseMuxValues 从 DBC 原始文本中解析 SG_MUL_VAL_ 定义，einride 解析器会把这些行当作未知定义丢弃。
+// 格式：SG_MUL_VAL_ <报文ID> <信号> <开关信号> <起始>-<结束>, ...;
+func parseMuxValues(content []byte) (map[signalKey][]muxCondition, error) {
+	conditions := make(map[signalKey][]muxCondition)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "SG_MUL_VAL_ ") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimSuffix(line, ";"))
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("行%d: SG_MUL_VAL_ 字段数不足", lineNumber)
+		}
+		id, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("行%d: SG_MUL_VAL_ 报文ID无效 '%s'", lineNumber, fields[1])
+		}
+		cond := muxCondition{switchName: fields[3]}
+		for _, item := range strings.Split(strings.Join(fields[4:], ""), ",") {
+			if item == "" {
+				continue
+			}
+			lo, hi, found := strings.Cut(item, "-")
+			from, err1 := strconv.ParseUint(lo, 10, 64)
+			to, err2 := strconv.ParseUint(hi, 10, 64)
+			if !found || err1 != nil || err2 != nil || from > to {
+				return nil, fmt.Errorf("行%d: SG_MUL_VAL_ 取值区间无效 '%s'", lineNumber, item)
+			}
+			cond.ranges = append(cond.ranges, [2]uint64{from, to})
+		}
+		key := signalKey{dbc.MessageID(id), fields[2]}
+		conditions[key] = append(conditions[key], cond)
+	}
+	return conditions, scanner.Err()
+}
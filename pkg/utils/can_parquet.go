@@ -0,0 +1,364 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// 只实现导出需要的 Parquet 子集：扁平 schema、PLAIN 编码、不压缩、每个列块一个 v1 数据页。
+// 元数据按 parquet.thrift 以 Thrift Compact 协议编码。
+
+// Parquet 物理类型
+const (
+	parquetInt64     int32 = 2
+	parquetDouble    int32 = 5
+	parquetByteArray int32 = 6
+)
+
+// Parquet 枚举值
+const (
+	parquetRequired        int32 = 0
+	parquetOptional        int32 = 1
+	parquetUTF8            int32 = 0 // ConvertedType.UTF8
+	parquetTimestampMillis int32 = 9 // ConvertedType.TIMESTAMP_MILLIS
+	parquetEncodingPlain   int32 = 0
+	parquetEncodingRLE     int32 = 3
+	parquetCodecNone       int32 = 0
+	parquetDataPage        int32 = 0
+)
+
+var parquetMagic = []byte("PAR1")
+
+// parquetRowGroupRows 每个行组缓冲的行数，控制导出大文件时的内存占用
+const parquetRowGroupRows = 64 * 1024
+
+// parquetColumn 一列的定义和当前行组缓冲的数据
+type parquetColumn struct {
+	name      string
+	typ       int32
+	optional  bool
+	converted int32  // 小于0表示无
+	values    []byte // PLAIN 编码后的非空值
+	defs      []bool // optional 列每行是否有值
+}
+
+func (c *parquetColumn) reset() {
+	c.values, c.defs = c.values[:0], c.defs[:0]
+}
+
+func (c *parquetColumn) appendNull() {
+	c.defs = append(c.defs, false)
+}
+
+func (c *parquetColumn) appendInt64(v int64) {
+	c.values = binary.LittleEndian.AppendUint64(c.values, uint64(v))
+	c.present()
+}
+
+func (c *parquetColumn) appendDouble(v float64) {
+	c.values = binary.LittleEndian.AppendUint64(c.values, math.Float64bits(v))
+	c.present()
+}
+
+func (c *parquetColumn) appendString(s string) {
+	c.values = binary.LittleEndian.AppendUint32(c.values, uint32(len(s)))
+	c.values = append(c.values, s...)
+	c.present()
+}
+
+func (c *parquetColumn) present() {
+	if c.optional {
+		c.defs = append(c.defs, true)
+	}
+}
+
+// parquetChunk 已写出的列块位置，用于生成文件尾元数据
+type parquetChunk struct {
+	offset    int64
+	size      int64
+	numValues int64
+}
+
+type parquetRowGroup struct {
+	chunks  []parquetChunk
+	numRows int64
+	size    int64
+}
+
+// parquetSampleWriter 以 Parquet 写出样本。
+// 宽表 schema 为 timestamp INT64(TIMESTAMP_MILLIS) 加每个信号一个可空 DOUBLE 列；
+// 长表 schema 为 timestamp、signal UTF8、value DOUBLE。
+type parquetSampleWriter struct {
+	w         *bufio.Writer
+	layout    CANExportLayout
+	signals   []string
+	columns   []*parquetColumn
+	rows      int
+	offset    int64
+	rowGroups []parquetRowGroup
+	err       error
+}
+
+func newParquetSampleWriter(w io.Writer, layout CANExportLayout, signals []string) *parquetSampleWriter {
+	p := &parquetSampleWriter{w: bufio.NewWriter(w), layout: layout, signals: signals}
+	p.columns = append(p.columns, &parquetColumn{name: "timestamp", typ: parquetInt64, converted: parquetTimestampMillis})
+	if layout == CANExportWide {
+		for _, name := range signals {
+			p.columns = append(p.columns, &parquetColumn{name: name, typ: parquetDouble, optional: true, converted: -1})
+		}
+	} else {
+		p.columns = append(p.columns,
+			&parquetColumn{name: "signal", typ: parquetByteArray, converted: parquetUTF8},
+			&parquetColumn{name: "value", typ: parquetDouble, converted: -1})
+	}
+	p.write(parquetMagic)
+	return p
+}
+
+func (p *parquetSampleWriter) WriteSample(sample *CANSample) error {
+	if p.layout == CANExportWide {
+		p.columns[0].appendInt64(sample.Timestamp)
+		for i, name := range p.signals {
+			if value, ok := sample.Signals[name]; ok {
+				p.columns[i+1].appendDouble(value)
+			} else {
+				p.columns[i+1].appendNull()
+			}
+		}
+		p.rows++
+	} else {
+		for _, name := range p.signals {
+			value, ok := sample.Signals[name]
+			if !ok {
+				continue
+			}
+			p.columns[0].appendInt64(sample.Timestamp)
+			p.columns[1].appendString(name)
+			p.columns[2].appendDouble(value)
+			p.rows++
+		}
+	}
+	if p.rows >= parquetRowGroupRows {
+		p.flushRowGroup()
+	}
+	return p.err
+}
+
+// flushRowGroup 把缓冲的行写为一个行组
+func (p *parquetSampleWriter) flushRowGroup() {
+	if p.rows == 0 {
+		return
+	}
+	group := parquetRowGroup{numRows: int64(p.rows)}
+	for _, c := range p.columns {
+		var page []byte
+		if c.optional {
+			levels := encodeParquetLevels(c.defs)
+			page = binary.LittleEndian.AppendUint32(page, uint32(len(levels)))
+			page = append(page, levels...)
+		}
+		page = append(page, c.values...)
+
+		var header thriftWriter
+		header.begin()
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(page)))
+		header.i32(3, int32(len(page)))
+		header.structBegin(5)
+		header.i32(1, int32(p.rows))
+		header.i32(2, parquetEncodingPlain)
+		header.i32(3, parquetEncodingRLE)
+		header.i32(4, parquetEncodingRLE)
+		header.structEnd()
+		header.end()
+
+		chunk := parquetChunk{offset: p.offset, size: int64(len(header.buf) + len(page)), numValues: int64(p.rows)}
+		p.write(header.buf)
+		p.write(page)
+		group.chunks = append(group.chunks, chunk)
+		group.size += chunk.size
+		c.reset()
+	}
+	p.rowGroups = append(p.rowGroups, group)
+	p.rows = 0
+}
+
+func (p *parquetSampleWriter) Close() error {
+	p.flushRowGroup()
+
+	var meta thriftWriter
+	meta.begin()
+	meta.i32(1, 1)
+	meta.listBegin(2, thriftStruct, len(p.columns)+1)
+	meta.elemBegin()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(p.columns)))
+	meta.elemEnd()
+	for _, c := range p.columns {
+		meta.elemBegin()
+		meta.i32(1, c.typ)
+		repetition := parquetRequired
+		if c.optional {
+			repetition = parquetOptional
+		}
+		meta.i32(3, repetition)
+		meta.binary(4, c.name)
+		if c.converted >= 0 {
+			meta.i32(6, c.converted)
+		}
+		meta.elemEnd()
+	}
+	var numRows int64
+	for _, g := range p.rowGroups {
+		numRows += g.numRows
+	}
+	meta.i64(3, numRows)
+	meta.listBegin(4, thriftStruct, len(p.rowGroups))
+	for _, g := range p.rowGroups {
+		meta.elemBegin()
+		meta.listBegin(1, thriftStruct, len(g.chunks))
+		for i, chunk := range g.chunks {
+			c := p.columns[i]
+			meta.elemBegin()
+			meta.i64(2, chunk.offset)
+			meta.structBegin(3)
+			meta.i32(1, c.typ)
+			meta.listBegin(2, thriftI32, 2)
+			meta.elemI32(parquetEncodingPlain)
+			meta.elemI32(parquetEncodingRLE)
+			meta.listBegin(3, thriftBinary, 1)
+			meta.elemBinary(c.name)
+			meta.i32(4, parquetCodecNone)
+			meta.i64(5, chunk.numValues)
+			meta.i64(6, chunk.size)
+			meta.i64(7, chunk.size)
+			meta.i64(9, chunk.offset)
+			meta.structEnd()
+			meta.elemEnd()
+		}
+		meta.i64(2, g.size)
+		meta.i64(3, g.numRows)
+		meta.elemEnd()
+	}
+	meta.binary(6, "AutoDataHub-monitor candecode")
+	meta.end()
+
+	p.write(meta.buf)
+	p.write(binary.LittleEndian.AppendUint32(nil, uint32(len(meta.buf))))
+	p.write(parquetMagic)
+	if p.err != nil {
+		return p.err
+	}
+	return p.w.Flush()
+}
+
+func (p *parquetSampleWriter) write(b []byte) {
+	if p.err != nil {
+		return
+	}
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	if err != nil {
+		p.err = fmt.Errorf("写入 Parquet 文件失败: %w", err)
+	}
+}
+
+// encodeParquetLevels 以 RLE/Bit-Packing 混合编码（位宽1，只使用 RLE 段）编码定义级别
+func encodeParquetLevels(defs []bool) []byte {
+	var out []byte
+	for i := 0; i < len(defs); {
+		j := i
+		for j < len(defs) && defs[j] == defs[i] {
+			j++
+		}
+		out = binary.AppendUvarint(out, uint64(j-i)<<1)
+		if defs[i] {
+			out = append(out, 1)
+		} else {
+			out = append(out, 0)
+		}
+		i = j
+	}
+	return out
+}
+
+// Thrift Compact 协议类型
+const (
+	thriftI32    byte = 5
+	thriftI64    byte = 6
+	thriftBinary byte = 8
+	thriftList   byte = 9
+	thriftStruct byte = 12
+)
+
+// thriftWriter 按 Thrift Compact 协议编码结构体，只支持 Parquet 元数据用到的类型
+type thriftWriter struct {
+	buf    []byte
+	lastID []int16 // 每层结构体上一个字段的ID，用于字段ID差值编码
+}
+
+func (w *thriftWriter) begin() { w.lastID = append(w.lastID, 0) }
+
+func (w *thriftWriter) end() {
+	w.buf = append(w.buf, 0)
+	w.lastID = w.lastID[:len(w.lastID)-1]
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	top := len(w.lastID) - 1
+	if delta := id - w.lastID[top]; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|typ)
+	} else {
+		w.buf = append(w.buf, typ)
+		w.buf = binary.AppendVarint(w.buf, int64(id))
+	}
+	w.lastID[top] = id
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.buf = binary.AppendVarint(w.buf, int64(v))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.buf = binary.AppendVarint(w.buf, v)
+}
+
+func (w *thriftWriter) binary(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.elemBinary(s)
+}
+
+func (w *thriftWriter) structBegin(id int16) {
+	w.field(id, thriftStruct)
+	w.begin()
+}
+
+func (w *thriftWriter) structEnd() { w.end() }
+
+func (w *thriftWriter) listBegin(id int16, elemType byte, n int) {
+	w.field(id, thriftList)
+	if n < 15 {
+		w.buf = append(w.buf, byte(n)<<4|elemType)
+	} else {
+		w.buf = append(w.buf, 0xF0|elemType)
+		w.buf = binary.AppendUvarint(w.buf, uint64(n))
+	}
+}
+
+// elemBegin/elemEnd 列表中的结构体元素没有字段头
+func (w *thriftWriter) elemBegin() { w.begin() }
+func (w *thriftWriter) elemEnd()   { w.end() }
+
+func (w *thriftWriter) elemI32(v int32) {
+	w.buf = binary.AppendVarint(w.buf, int64(v))
+}
+
+func (w *thriftWriter) elemBinary(s string) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
@@ -0,0 +1,294 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// thriftReader 按 Thrift Compact 协议解码任意结构体，结构体解码为按字段ID索引的 map，
+// 整数统一为 int64，binary 为 string，list 为 []any。与 thriftWriter 独立实现，用于校验写出的元数据
+type thriftReader struct {
+	t   *testing.T
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) byte() byte {
+	require.Less(r.t, r.pos, len(r.buf), "Thrift 数据不完整")
+	b := r.buf[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) varint() int64 {
+	v, n := binary.Varint(r.buf[r.pos:])
+	require.Positive(r.t, n, "varint 无效")
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	require.Positive(r.t, n, "uvarint 无效")
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) structValue() map[int16]any {
+	fields := make(map[int16]any)
+	var last int16
+	for {
+		header := r.byte()
+		if header == 0 {
+			return fields
+		}
+		typ := header & 0x0F
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.varint())
+		}
+		last = id
+		switch typ {
+		case 1, 2: // 结构体字段中的 bool 值编码在类型中
+			fields[id] = typ == 1
+		default:
+			fields[id] = r.value(typ)
+		}
+	}
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case 1, 2:
+		return r.byte() == 1
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, thriftI32, thriftI64:
+		return r.varint()
+	case 7:
+		require.LessOrEqual(r.t, r.pos+8, len(r.buf))
+		v := math.Float64frombits(binary.LittleEndian.Uint64(r.buf[r.pos:]))
+		r.pos += 8
+		return v
+	case thriftBinary:
+		n := int(r.uvarint())
+		require.LessOrEqual(r.t, r.pos+n, len(r.buf))
+		s := string(r.buf[r.pos : r.pos+n])
+		r.pos += n
+		return s
+	case thriftList, 10: // list 与 set
+		header := r.byte()
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]any, n)
+		for i := range list {
+			list[i] = r.value(header & 0x0F)
+		}
+		return list
+	case thriftStruct:
+		return r.structValue()
+	}
+	r.t.Fatalf("不支持的 Thrift 类型 %d", typ)
+	return nil
+}
+
+// parquetTestColumn 解码出的一列：schema 定义和全部行的值，空值为 nil
+type parquetTestColumn struct {
+	name      string
+	typ       int64
+	optional  bool
+	converted any
+	values    []any
+}
+
+// readParquetTestFile 按 Parquet 规范解码文件：校验首尾魔数和文件尾长度，解析元数据，
+// 再按列块偏移读取每个数据页的页头、定义级别和 PLAIN 编码的值，返回行数和各列数据
+func readParquetTestFile(t *testing.T, data []byte) (int64, []*parquetTestColumn) {
+	t.Helper()
+	require.True(t, bytes.HasPrefix(data, []byte("PAR1")))
+	require.True(t, bytes.HasSuffix(data, []byte("PAR1")))
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footerStart := len(data) - 8 - footerLen
+	require.GreaterOrEqual(t, footerStart, 4)
+	meta := &thriftReader{t: t, buf: data[footerStart : len(data)-8]}
+	file := meta.structValue()
+	require.Equal(t, len(meta.buf), meta.pos, "文件尾长度与元数据不一致")
+	assert.Equal(t, int64(1), file[1], "version")
+
+	schema := file[2].([]any)
+	root := schema[0].(map[int16]any)
+	require.Equal(t, int64(len(schema)-1), root[5], "根节点的子节点数")
+	var columns []*parquetTestColumn
+	for _, elem := range schema[1:] {
+		e := elem.(map[int16]any)
+		columns = append(columns, &parquetTestColumn{
+			name: e[4].(string), typ: e[1].(int64), optional: e[3] == int64(parquetOptional), converted: e[6],
+		})
+	}
+
+	numRows := file[3].(int64)
+	var groupRows int64
+	offset := int64(4)
+	for _, g := range file[4].([]any) {
+		group := g.(map[int16]any)
+		rows := group[3].(int64)
+		groupRows += rows
+		chunks := group[1].([]any)
+		require.Len(t, chunks, len(columns))
+		var groupSize int64
+		for i, c := range chunks {
+			col := columns[i]
+			chunk := c.(map[int16]any)
+			cm := chunk[3].(map[int16]any)
+			assert.Equal(t, col.typ, cm[1], col.name)
+			assert.Equal(t, []any{col.name}, cm[3], col.name)
+			assert.Equal(t, int64(parquetCodecNone), cm[4], col.name)
+			assert.Equal(t, rows, cm[5], col.name)
+			// 列块紧接着上一个列块写出
+			require.Equal(t, offset, cm[9], col.name)
+			require.Equal(t, offset, chunk[2], col.name)
+
+			page := &thriftReader{t: t, buf: data[:footerStart], pos: int(offset)}
+			header := page.structValue()
+			require.Equal(t, int64(parquetDataPage), header[1], col.name)
+			require.Equal(t, header[2], header[3], "未压缩时压缩前后大小相同")
+			body := data[page.pos : page.pos+int(header[3].(int64))]
+			dataPage := header[5].(map[int16]any)
+			require.Equal(t, rows, dataPage[1], col.name)
+			assert.Equal(t, int64(parquetEncodingPlain), dataPage[2], col.name)
+			size := int64(page.pos) + int64(len(body)) - offset
+			assert.Equal(t, size, cm[6], col.name)
+			assert.Equal(t, size, cm[7], col.name)
+			col.values = append(col.values, decodeParquetTestPage(t, col, body, int(rows))...)
+			offset += size
+			groupSize += size
+		}
+		assert.Equal(t, groupSize, group[2])
+	}
+	require.Equal(t, int64(footerStart), offset, "最后一个列块之后紧接文件尾")
+	require.Equal(t, numRows, groupRows)
+	return numRows, columns
+}
+
+// decodeParquetTestPage 解码一个数据页：optional 列先读长度前缀的 RLE 定义级别，再读非空值
+func decodeParquetTestPage(t *testing.T, col *parquetTestColumn, body []byte, rows int) []any {
+	t.Helper()
+	defined := make([]bool, 0, rows)
+	if col.optional {
+		n := int(binary.LittleEndian.Uint32(body))
+		levels := &thriftReader{t: t, buf: body[4 : 4+n]}
+		for levels.pos < len(levels.buf) {
+			run := levels.uvarint()
+			require.Zero(t, run&1, "只应有 RLE 段")
+			value := levels.byte()
+			for k := uint64(0); k < run>>1; k++ {
+				defined = append(defined, value == 1)
+			}
+		}
+		body = body[4+n:]
+	} else {
+		for range rows {
+			defined = append(defined, true)
+		}
+	}
+	require.Len(t, defined, rows, col.name)
+
+	values := make([]any, 0, rows)
+	for _, ok := range defined {
+		if !ok {
+			values = append(values, nil)
+			continue
+		}
+		switch col.typ {
+		case int64(parquetInt64):
+			values = append(values, int64(binary.LittleEndian.Uint64(body)))
+			body = body[8:]
+		case int64(parquetDouble):
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(body)))
+			body = body[8:]
+		case int64(parquetByteArray):
+			n := int(binary.LittleEndian.Uint32(body))
+			values = append(values, string(body[4:4+n]))
+			body = body[4+n:]
+		default:
+			t.Fatalf("不支持的物理类型 %d", col.typ)
+		}
+	}
+	require.Empty(t, body, "数据页末尾有多余的字节: %s", col.name)
+	return values
+}
+
+// assertParquetValues 比较列数据，NaN 与 NaN 视为相等
+func assertParquetValues(t *testing.T, want []any, col *parquetTestColumn) {
+	t.Helper()
+	require.Len(t, col.values, len(want), col.name)
+	for i, v := range want {
+		if f, ok := v.(float64); ok && math.IsNaN(f) {
+			got, isFloat := col.values[i].(float64)
+			assert.True(t, isFloat && math.IsNaN(got), "%s[%d]: %v", col.name, i, col.values[i])
+			continue
+		}
+		assert.Equal(t, v, col.values[i], "%s[%d]", col.name, i)
+	}
+}
+
+func TestCANSampleWriterParquet(t *testing.T) {
+	rows, columns := readParquetTestFile(t, []byte(writeExportTestSamples(t, CANExportParquet, CANExportWide)))
+	assert.Equal(t, int64(2), rows)
+	require.Len(t, columns, 3)
+	assert.Equal(t, parquetTestColumn{name: "timestamp", typ: int64(parquetInt64), converted: int64(parquetTimestampMillis)},
+		parquetTestColumn{name: columns[0].name, typ: columns[0].typ, optional: columns[0].optional, converted: columns[0].converted})
+	assert.Equal(t, []string{"A", "B"}, []string{columns[1].name, columns[2].name})
+	assert.True(t, columns[1].optional && columns[2].optional)
+	assert.Nil(t, columns[1].converted)
+	assertParquetValues(t, []any{int64(1001), int64(1004)}, columns[0])
+	assertParquetValues(t, []any{1.5, nil}, columns[1])
+	assertParquetValues(t, []any{2.0, math.NaN()}, columns[2])
+
+	rows, columns = readParquetTestFile(t, []byte(writeExportTestSamples(t, CANExportParquet, CANExportLong)))
+	assert.Equal(t, int64(3), rows)
+	require.Len(t, columns, 3)
+	assert.Equal(t, []string{"timestamp", "signal", "value"}, []string{columns[0].name, columns[1].name, columns[2].name})
+	assert.Equal(t, int64(parquetUTF8), columns[1].converted)
+	assert.False(t, columns[1].optional || columns[2].optional)
+	assertParquetValues(t, []any{int64(1001), int64(1001), int64(1004)}, columns[0])
+	assertParquetValues(t, []any{"A", "B", "B"}, columns[1])
+	assertParquetValues(t, []any{1.5, 2.0, math.NaN()}, columns[2])
+
+	// 定义级别：两个有值、一个空值
+	assert.Equal(t, []byte{0x04, 0x01, 0x02, 0x00}, encodeParquetLevels([]bool{true, true, false}))
+}
+
+func TestCANSampleWriterParquetRowGroups(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewCANSampleWriter(&buf, CANExportParquet, CANExportWide, []string{"A", "B"})
+	require.NoError(t, err)
+	const n = parquetRowGroupRows + 10
+	for i := range n {
+		sample := &CANSample{Timestamp: int64(i), Signals: map[string]float64{"A": float64(i)}}
+		if i%3 == 0 {
+			sample.Signals["B"] = -float64(i)
+		}
+		require.NoError(t, w.WriteSample(sample))
+	}
+	require.NoError(t, w.Close())
+
+	rows, columns := readParquetTestFile(t, buf.Bytes())
+	assert.Equal(t, int64(n), rows)
+	for i := range n {
+		require.Equal(t, int64(i), columns[0].values[i])
+		require.Equal(t, float64(i), columns[1].values[i])
+		if i%3 == 0 {
+			require.Equal(t, -float64(i), columns[2].values[i])
+		} else {
+			require.Nil(t, columns[2].values[i])
+		}
+	}
+}
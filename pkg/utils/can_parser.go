@@ -1,36 +1,73 @@
 package utils
 
 import (
-	"encoding/hex"
 	"fmt"
-	"strconv"
 	"strings"
 
 	"go.einride.tech/can/pkg/dbc"
 )
 
 type CANParser struct {
-	db         *dbc.File
+	db         *CompiledDBC
 	targetSigs map[string]struct{}
+	targets    map[*compiledMessage][]*compiledSignal // 每个报文中需要输出的信号
+	muxStates  []uint8                                // 当前帧各信号的多路复用状态
 	lineNumber int
 	timestamp  int64
 	canID      uint32
+	extended   bool
+	channel    int
 	data       []byte
+	faults     map[string]SignalFault // 当前帧被判为传感器故障的信号
+
+	e2eOverrides map[e2eCounterKey]*E2EConfig // 覆盖 DBC 属性的 E2E 配置，通道为0表示所有通道
+	e2eCounters  map[e2eCounterKey]int        // 各报文上一帧的 E2E 计数器
+	e2eFailure   *E2EFailure                  // 当前帧的 E2E 校验失败信息
+
+	j1939 *j1939State // J1939 多包传输和 DM1 状态，非 J1939 DBC 时为空
 }
 
 // NewCANParser 创建新的CAN解析器实例
 func NewCANParser(db *dbc.File, targetSignals []string) *CANParser {
+	return NewCompiledCANParser(CompileDBC(db), targetSignals)
+}
+
+// NewCompiledCANParser 使用已编译的 DBC 创建CAN解析器，编译结果可被多个解析器共享
+func NewCompiledCANParser(db *CompiledDBC, targetSignals []string) *CANParser {
 	targetSet := make(map[string]struct{}, len(targetSignals))
 	for _, sig := range targetSignals {
 		targetSet[sig] = struct{}{}
 	}
-	return &CANParser{
-		db:         db,
-		targetSigs: targetSet,
+	p := &CANParser{
+		db:          db,
+		targetSigs:  targetSet,
+		targets:     make(map[*compiledMessage][]*compiledSignal),
+		e2eCounters: make(map[e2eCounterKey]int),
 	}
+	if db.j1939 {
+		p.j1939 = newJ1939State()
+	}
+	return p
 }
 
-// ParseLine 解析单行CAN日志
+// SetE2EConfig 为报文配置 E2E 校验，覆盖 DBC 属性中的配置；channel 为0表示所有通道。
+// 报文未在 DBC 中定义时返回 false。
+func (p *CANParser) SetE2EConfig(id uint32, extended bool, channel int, cfg E2EConfig) (bool, error) {
+	msg := p.db.lookup(id, extended || id > canMaxStandardID)
+	if msg == nil {
+		return false, nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return true, fmt.Errorf("CAN ID %X: %w", id, err)
+	}
+	if p.e2eOverrides == nil {
+		p.e2eOverrides = make(map[e2eCounterKey]*E2EConfig)
+	}
+	p.e2eOverrides[e2eCounterKey{msg, channel}] = &cfg
+	return true, nil
+}
+
+// ParseLine 解析单行 candump 格式的CAN日志，返回的时间戳为毫秒
 func (p *CANParser) ParseLine(line string) (timestamp int64, signals map[string]float64, err error) {
 	p.lineNumber++
 	line = strings.TrimSpace(line)
@@ -38,96 +75,187 @@ func (p *CANParser) ParseLine(line string) (timestamp int64, signals map[string]
 		return 0, nil, nil
 	}
 
-	// 重置解析状态
-	p.timestamp = 0
-	p.canID = 0
-	p.data = nil
-	signals = make(map[string]float64)
-
-	if err := p.parseTimestamp(line); err != nil {
-		return 0, nil, fmt.Errorf("行%d: %w", p.lineNumber, err)
-	}
-	if err := p.parseCANFrame(line); err != nil {
+	frame, err := parseCandumpLine(line)
+	if err != nil {
 		return 0, nil, fmt.Errorf("行%d: %w", p.lineNumber, err)
 	}
-	signals, err = p.processCANMessage()
+	signals, err = p.ParseFrame(frame)
 	if err != nil {
 		return 0, nil, fmt.Errorf("行%d: %w", p.lineNumber, err)
 	}
-	return p.timestamp, signals, nil
+	return frameMillis(frame.Timestamp), signals, nil
 }
 
-func (p *CANParser) parseTimestamp(line string) error {
-	parts := strings.Fields(line)
-	if len(parts) < 3 {
-		return fmt.Errorf("无效行格式，期望至少3个字段")
+// ParseFrame 使用DBC解码一帧由日志读取器读出的CAN报文。
+// 远程帧和错误帧不携带信号数据，直接跳过并返回 nil。
+func (p *CANParser) ParseFrame(frame *CANFrame) (map[string]float64, error) {
+	if frame.Remote || frame.Error {
+		return nil, nil
+	}
+	if err := validateFrameLength(frame); err != nil {
+		return nil, err
 	}
 
-	timestampStr := strings.Trim(parts[0], "()")
-	ts, err := strconv.ParseInt(timestampStr, 10, 64)
-	if err != nil {
-		return fmt.Errorf("时间戳解析失败 '%s': %w", timestampStr, err)
+	// 重置解析状态
+	p.timestamp = frame.Timestamp
+	p.canID = frame.ID
+	// 部分日志格式不标记扩展帧，超出11位范围的ID只可能是扩展帧
+	p.extended = frame.Extended || frame.ID > canMaxStandardID
+	p.channel = frame.Channel
+	p.data = frame.Data
+	p.faults = nil
+	p.e2eFailure = nil
+	if p.j1939 != nil && p.extended {
+		return p.processJ1939()
 	}
-	p.timestamp = ts
-	return nil
+	return p.processCANMessage()
 }
 
-func (p *CANParser) parseCANFrame(line string) error {
-	parts := strings.Fields(line)
-	canFrame := parts[2]
-	frameParts := strings.Split(canFrame, "#")
-	if len(frameParts) != 2 {
-		return fmt.Errorf("CAN帧格式无效 '%s'", canFrame)
+// processJ1939 处理 J1939 扩展帧：TP.CM/TP.DT 多包传输在最后一个数据包到达时按重组后的
+// PGN 解码，DM1 报文额外解码当前故障码。传输过程中的帧不输出信号。
+func (p *CANParser) processJ1939() (map[string]float64, error) {
+	id := parseJ1939ID(p.canID)
+	key := j1939SessionKey{p.channel, id.source, id.dest}
+	switch id.pgn {
+	case j1939PGNTPCM:
+		p.j1939.connect(key, p.data, p.timestamp)
+		return map[string]float64{}, nil
+	case j1939PGNTPDT:
+		session, done := p.j1939.transfer(key, p.data, p.timestamp)
+		if !done {
+			return map[string]float64{}, nil
+		}
+		id.pgn = session.pgn
+		p.canID, p.data = id.canID(), session.data
+	}
+	if id.pgn == j1939PGNDM1 {
+		p.j1939.recordDM1(id.source, p.data)
 	}
+	if isJ1939Transport(id.pgn) && p.db.lookup(p.canID, true) == nil {
+		return map[string]float64{}, nil
+	}
+	return p.processCANMessage()
+}
 
-	idStr := frameParts[0]
-	dataStr := frameParts[1]
+// Faults 返回上一次 ParseFrame 中被判为传感器故障的信号，key 为 DBC 信号名。
+// 故障信号不会出现在 ParseFrame 的返回值中，每次解析都会返回新的 map。
+func (p *CANParser) Faults() map[string]SignalFault {
+	return p.faults
+}
 
-	// 解析CAN ID
-	id, err := strconv.ParseUint(idStr, 16, 32)
-	if err != nil {
-		return fmt.Errorf("CAN ID解析失败 '%s': %w", idStr, err)
+// E2EFailure 返回上一次 ParseFrame 的 E2E 校验失败信息，报文未配置 E2E 或校验通过时为 nil。
+// action 为 discard 时该帧不输出任何信号，为 flag 时全部目标信号作为 e2e 故障输出。
+func (p *CANParser) E2EFailure() *E2EFailure {
+	return p.e2eFailure
+}
+
+// J1939Report 返回多包传输统计和各 ECU 当前的 DM1 故障码，非 J1939 DBC 时返回 nil
+func (p *CANParser) J1939Report() *J1939Report {
+	if p.j1939 == nil {
+		return nil
 	}
-	p.canID = uint32(id)
+	return p.j1939.snapshot()
+}
 
-	// 解码十六进制数据
-	if len(dataStr)%2 != 0 {
-		return fmt.Errorf("CAN数据长度必须为偶数，当前长度%d", len(dataStr))
+// e2eConfig 返回报文适用的 E2E 配置：本通道的覆盖配置优先，其次是所有通道的覆盖配置，最后是 DBC 属性
+func (p *CANParser) e2eConfig(msg *compiledMessage) (*E2EConfig, error) {
+	if cfg, ok := p.e2eOverrides[e2eCounterKey{msg, p.channel}]; ok {
+		return cfg, nil
 	}
-	data, err := hex.DecodeString(dataStr)
-	if err != nil {
-		return fmt.Errorf("CAN数据解码失败: %w", err)
+	if cfg, ok := p.e2eOverrides[e2eCounterKey{msg, 0}]; ok {
+		return cfg, nil
+	}
+	return msg.e2e, msg.e2eErr
+}
+
+// validateFrameLength 校验经典CAN与CAN FD帧的数据长度
+func validateFrameLength(frame *CANFrame) error {
+	if frame.FD {
+		if !validFDLength(len(frame.Data)) {
+			return fmt.Errorf("CAN ID %X: CAN FD 数据长度无效: %d", frame.ID, len(frame.Data))
+		}
+		return nil
+	}
+	if len(frame.Data) > canMaxClassicLen {
+		return fmt.Errorf("CAN ID %X: 经典CAN帧数据长度超过8字节: %d", frame.ID, len(frame.Data))
 	}
-	p.data = data
 	return nil
 }
 
 func (p *CANParser) processCANMessage() (map[string]float64, error) {
-	signals := make(map[string]float64)
-	var msgDef *dbc.MessageDef
-	for _, def := range p.db.Defs {
-		if m, ok := def.(*dbc.MessageDef); ok && uint32(m.MessageID) == p.canID {
-			msgDef = m
-			break
+	// DBC 中扩展帧ID带有最高位标志，索引时同时区分ID和帧类型
+	msg := p.db.lookup(p.canID, p.extended)
+	if msg == nil {
+		return nil, &UnknownCANIDError{ID: p.canID, Extended: p.extended}
+	}
+
+	targets, ok := p.targets[msg]
+	if !ok {
+		for _, sig := range msg.signals {
+			if _, exists := p.targetSigs[sig.name]; exists {
+				targets = append(targets, sig)
+			}
 		}
+		p.targets[msg] = targets
 	}
-	if msgDef == nil {
-		return nil, fmt.Errorf("CAN ID %X 未在DBC中定义", p.canID)
+
+	signals := make(map[string]float64, len(targets))
+	if len(targets) == 0 {
+		return signals, nil
 	}
 
-	for i := range msgDef.Signals {
-		sigDef := msgDef.Signals[i]
-		if _, exists := p.targetSigs[string(sigDef.Name)]; !exists {
+	// E2E 校验只针对包含目标信号的报文，失败时按配置丢弃或标记整帧
+	cfg, err := p.e2eConfig(msg)
+	if err != nil {
+		return nil, fmt.Errorf("CAN ID %X: E2E 配置错误: %w", p.canID, err)
+	}
+	if cfg != nil {
+		if kind := e2eCheck(cfg, p.data, p.e2eCounters, e2eCounterKey{msg, p.channel}); kind != "" {
+			p.e2eFailure = &E2EFailure{ID: p.canID, Extended: p.extended, Kind: kind, Action: cfg.Action}
+			if cfg.Action == E2EDiscard {
+				return signals, nil
+			}
+		}
+	}
+
+	if cap(p.muxStates) < len(msg.signals) {
+		p.muxStates = make([]uint8, len(msg.signals))
+	}
+	states := p.muxStates[:len(msg.signals)]
+	clear(states)
+
+	for _, sig := range targets {
+		// 只输出当前多路复用值下有效的信号
+		active, err := sig.isActive(p.data, states)
+		if err != nil {
+			return nil, fmt.Errorf("CAN ID %X: %w", p.canID, err)
+		}
+		if !active {
 			continue
 		}
 
-		rawValue, err := parseSignalValue(&sigDef, p.data)
+		bits, err := sig.raw(p.data)
 		if err != nil {
-			return nil, fmt.Errorf("信号'%s'原始值解析失败: %w", sigDef.Name, err)
+			return nil, fmt.Errorf("信号'%s'解析失败: %w", sig.name, err)
 		}
-		floatValue := float64(rawValue)*sigDef.Factor + sigDef.Offset
+		value := sig.physical(bits)
 
-		signals[string(sigDef.Name)] = floatValue
+		// 超出范围、无效值和饱和值按传感器故障单独记录，不作为信号值输出
+		if fault := sig.validity.check(bits, value); fault != nil {
+			if p.faults == nil {
+				p.faults = make(map[string]SignalFault)
+			}
+			p.faults[sig.name] = *fault
+			continue
+		}
+		if p.e2eFailure != nil {
+			if p.faults == nil {
+				p.faults = make(map[string]SignalFault)
+			}
+			p.faults[sig.name] = SignalFault{Kind: SignalFaultE2E, Value: value, Label: string(p.e2eFailure.Kind)}
+			continue
+		}
+		signals[sig.name] = value
 	}
 
 	return signals, nil
@@ -156,31 +284,3 @@ func convertPhysicalToFloat(value interface{}) (float64, error) {
 		return 0, fmt.Errorf("不支持的数值类型: %T", value)
 	}
 }
-
-// parseSignalValue 从CAN数据中提取信号的原始整数值
-func parseSignalValue(sigDef *dbc.SignalDef, data []byte) (int64, error) {
-	startBit := int(sigDef.StartBit)
-	length := int(sigDef.Size)
-
-	if startBit+length > len(data)*8 {
-		return 0, fmt.Errorf("信号 %s 超出数据范围", sigDef.Name)
-	}
-
-	var value int64
-	for i := 0; i < length; i++ {
-		bitPos := startBit + i
-		bytePos := bitPos / 8
-		bitOffset := uint(7 - (bitPos % 8))
-		bitValue := (int64(data[bytePos]) >> bitOffset) & 0x01
-		value |= bitValue << (length - i - 1)
-	}
-
-	// 处理符号扩展
-	if sigDef.IsSigned {
-		if value&(1<<(length-1)) != 0 {
-			value |= ^((1 << length) - 1)
-		}
-	}
-
-	return value, nil
-}
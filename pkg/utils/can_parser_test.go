@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestParser 使用 DBC 文本创建解析器
+func newTestParser(t *testing.T, source string, signals ...string) *CANParser {
+	t.Helper()
+	db, err := ParseDBC("test.dbc", []byte(source))
+	require.NoError(t, err)
+	return NewCANParser(db, signals)
+}
+
+func TestParseCandumpFrame(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  CANFrame
+	}{
+		{"经典帧", "123#0F00", CANFrame{ID: 0x123, Data: []byte{0x0F, 0x00}}},
+		{"扩展帧", "18FEF100#AA", CANFrame{ID: 0x18FEF100, Extended: true, Data: []byte{0xAA}}},
+		{"原始DLC", "123#1122334455667788_C", CANFrame{ID: 0x123, Data: []byte{0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88}}},
+		{"远程帧", "123#R", CANFrame{ID: 0x123, Remote: true}},
+		{"带DLC的远程帧", "123#R4", CANFrame{ID: 0x123, Remote: true}},
+		{"FD帧", "1A0##300112233445566778899AABB", CANFrame{ID: 0x1A0, FD: true, BRS: true, ESI: true,
+			Data: []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xAA, 0xBB}}},
+		{"错误帧", "20000080#0000000000000000", CANFrame{ID: 0x80, Error: true, Data: make([]byte, 8)}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			frame, err := parseCandumpFrame(c.input)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, *frame)
+		})
+	}
+
+	for _, input := range []string{"1A0##1001122334455667788", "123#112233445566778899", "1A0##"} {
+		_, err := parseCandumpFrame(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestParseFrameExtendedAndSkipped(t *testing.T) {
+	p := newTestParser(t, testDBC, "LongitudinalAcceleration", "EngineSpeed")
+
+	signals, err := p.ParseFrame(&CANFrame{ID: 0x18FEF100, Extended: true, Data: []byte{100}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"EngineSpeed": 100}, signals)
+
+	// 同一数值的扩展帧ID不能匹配标准帧报文
+	_, err = p.ParseFrame(&CANFrame{ID: 0x123, Extended: true, Data: []byte{1}})
+	assert.Error(t, err)
+
+	signals, err = p.ParseFrame(&CANFrame{ID: 0x123, FD: true, BRS: true, Data: make([]byte, 12)})
+	require.NoError(t, err)
+	assert.Contains(t, signals, "LongitudinalAcceleration")
+
+	_, err = p.ParseFrame(&CANFrame{ID: 0x123, FD: true, Data: make([]byte, 10)})
+	assert.Error(t, err)
+
+	for _, frame := range []*CANFrame{{ID: 0x123, Remote: true}, {ID: 0x80, Error: true, Data: make([]byte, 8)}} {
+		signals, err = p.ParseFrame(frame)
+		assert.NoError(t, err)
+		assert.Nil(t, signals)
+	}
+
+	_, signals, err = p.ParseLine("(1000) can0 123#R")
+	assert.NoError(t, err)
+	assert.Nil(t, signals)
+}
+
+func TestParseFrameMultiplexed(t *testing.T) {
+	t.Run("简单多路复用", func(t *testing.T) {
+		p := newTestParser(t, `VERSION ""
+
+BO_ 1536 AirbagStatus: 8 ACU
+ SG_ Page M : 0|8@1+ (1,0) [0|255] "" Vector__XXX
+ SG_ FrontDeploy m1 : 8|8@1+ (1,0) [0|255] "" Vector__XXX
+ SG_ SideDeploy m2 : 8|8@1+ (1,0) [0|255] "" Vector__XXX
+ SG_ Counter : 56|8@1+ (1,0) [0|255] "" Vector__XXX
+`, "FrontDeploy", "SideDeploy", "Counter")
+
+		signals, err := p.ParseFrame(&CANFrame{ID: 0x600, Data: []byte{1, 7, 0, 0, 0, 0, 0, 9}})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]float64{"FrontDeploy": 7, "Counter": 9}, signals)
+
+		signals, err = p.ParseFrame(&CANFrame{ID: 0x600, Data: []byte{2, 5, 0, 0, 0, 0, 0, 9}})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]float64{"SideDeploy": 5, "Counter": 9}, signals)
+
+		signals, err = p.ParseFrame(&CANFrame{ID: 0x600, Data: []byte{3, 5, 0, 0, 0, 0, 0, 9}})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]float64{"Counter": 9}, signals)
+	})
+
+	t.Run("扩展多路复用", func(t *testing.T) {
+		p := newTestParser(t, `VERSION ""
+
+BO_ 1537 Diag: 8 ACU
+ SG_ Service M : 0|8@1+ (1,0) [0|255] "" Vector__XXX
+ SG_ Subfunction m34M : 8|8@1+ (1,0) [0|255] "" Vector__XXX
+ SG_ CrashCount m1 : 16|8@1+ (1,0) [0|255] "" Vector__XXX
+ SG_ Voltage m2 : 16|16@1+ (0.01,0) [0|655.35] "V" Vector__XXX
+
+SG_MUL_VAL_ 1537 Subfunction Service 34-34;
+SG_MUL_VAL_ 1537 CrashCount Subfunction 1-1, 5-6;
+SG_MUL_VAL_ 1537 Voltage Subfunction 2-4;
+`, "Subfunction", "CrashCount", "Voltage")
+
+		signals, err := p.ParseFrame(&CANFrame{ID: 0x601, Data: []byte{0x22, 5, 3, 0, 0, 0, 0, 0}})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]float64{"Subfunction": 5, "CrashCount": 3}, signals)
+
+		signals, err = p.ParseFrame(&CANFrame{ID: 0x601, Data: []byte{0x22, 3, 0xE8, 0x03, 0, 0, 0, 0}})
+		require.NoError(t, err)
+		require.Contains(t, signals, "Voltage")
+		assert.InDelta(t, 10.0, signals["Voltage"], 1e-9)
+		assert.NotContains(t, signals, "CrashCount")
+
+		// 上级开关不匹配时，下级开关及其信号都无效
+		signals, err = p.ParseFrame(&CANFrame{ID: 0x601, Data: []byte{0x10, 1, 3, 0, 0, 0, 0, 0}})
+		require.NoError(t, err)
+		assert.Empty(t, signals)
+	})
+
+	_, err := ParseDBC("bad.dbc", []byte("VERSION \"\"\n\nSG_MUL_VAL_ 1537 Voltage Subfunction 4-2;\n"))
+	assert.Error(t, err)
+}
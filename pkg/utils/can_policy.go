@@ -0,0 +1,279 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CANParseMode 遇到异常帧时的处理方式
+type CANParseMode string
+
+const (
+	CANParseStrict    CANParseMode = "strict"    // 任何异常立即返回错误
+	CANParseSkip      CANParseMode = "skip"      // 跳过异常并计数
+	CANParseThreshold CANParseMode = "threshold" // 跳过异常，异常数量或比例超限时中止
+)
+
+// canParseRateMinFrames 按比例判断中止前至少需要读取的帧数，避免文件开头的少量异常导致误判
+const canParseRateMinFrames = 100
+
+// canParseReportSamples 报告中保留的异常信息条数
+const canParseReportSamples = 10
+
+// CANParsePolicy 定义了解析 CAN 日志时的容错策略，零值等同于 strict。
+// 异常指格式错误的行和解码失败的帧；DBC 未定义的报文ID只在 strict 模式下中止，其他模式下只在报告中计数
+type CANParsePolicy struct {
+	Mode         CANParseMode `yaml:"mode" json:"mode"`                     // 处理方式
+	MaxErrors    int          `yaml:"max_errors" json:"max_errors"`         // threshold 模式下允许的最大异常数，0 表示不限制
+	MaxErrorRate float64      `yaml:"max_error_rate" json:"max_error_rate"` // threshold 模式下允许的最大异常帧比例，0 表示不限制
+}
+
+// Validate 检查策略配置
+func (p CANParsePolicy) Validate() error {
+	switch p.Mode {
+	case "", CANParseStrict, CANParseSkip:
+	case CANParseThreshold:
+		if p.MaxErrors <= 0 && p.MaxErrorRate <= 0 {
+			return fmt.Errorf("threshold 模式需要配置 max_errors 或 max_error_rate")
+		}
+	default:
+		return fmt.Errorf("未知的解析策略 '%s'", p.Mode)
+	}
+	if p.MaxErrorRate < 0 || p.MaxErrorRate > 1 {
+		return fmt.Errorf("max_error_rate 必须在0到1之间: %v", p.MaxErrorRate)
+	}
+	return nil
+}
+
+// ErrCANParseAborted 异常数量超过容错阈值，解析被中止
+var ErrCANParseAborted = errors.New("CAN 日志异常过多，解析中止")
+
+// CANParseReport 记录一次 CAN 日志解析的统计信息，用于区分日志本身的问题和规则问题
+type CANParseReport struct {
+	Format               string            `json:"format"`                // 日志格式
+	FramesRead           int               `json:"frames_read"`           // 读取的帧数（含远程帧、错误帧）
+	FramesDecoded        int               `json:"frames_decoded"`        // 成功匹配 DBC 并解码的帧数
+	RemoteFrames         int               `json:"remote_frames"`         // 远程帧数
+	ErrorFrames          int               `json:"error_frames"`          // 总线错误帧数
+	UnknownIDs           map[string]int    `json:"unknown_ids"`           // 未在 DBC 中定义的ID及出现次数，不计入异常比例
+	MalformedLines       int               `json:"malformed_lines"`       // 无法解析的日志行数
+	DecodeErrors         int               `json:"decode_errors"`         // 信号解码失败的帧数
+	TimestampRegressions int               `json:"timestamp_regressions"` // 时间戳比上一帧更早的次数
+	RelativeTime         bool              `json:"relative_time"`         // 时间戳为相对日志开始的偏移，未能换算为 Unix 时间
+	FramesOutsideWindow  int               `json:"frames_outside_window"` // 不在评估时间窗口内、未解码的帧数，读过窗口后停止读取，之后的帧不计入
+	SensorFaults         map[string]int    `json:"sensor_faults"`         // 按逻辑信号名统计的传感器故障值次数，见 SignalFault
+	E2EFailures          map[string]int    `json:"e2e_failures"`          // 按报文和失败类型统计的 E2E 校验失败帧数，如 0x1A0/crc
+	Bus                  *CANBusReport     `json:"bus,omitempty"`         // 报文周期和总线负载统计
+	J1939                *J1939Report      `json:"j1939,omitempty"`       // J1939 多包传输和 DM1 故障码，仅使用 J1939 DBC 时输出
+	Diagnostics          *DiagnosticReport `json:"diagnostics,omitempty"` // 诊断响应中的 UDS/OBD-II 故障码，仅配置诊断 ID 时输出
+	Errors               []string          `json:"errors,omitempty"`      // 前若干条异常信息
+	Aborted              bool              `json:"aborted"`               // 是否因异常过多中止
+}
+
+func newCANParseReport(format string) *CANParseReport {
+	return &CANParseReport{Format: format, UnknownIDs: make(map[string]int), SensorFaults: make(map[string]int),
+		E2EFailures: make(map[string]int)}
+}
+
+// errorCount 返回用于判断是否中止的异常总数：格式错误的行和解码失败的帧，不含未定义的ID
+func (r *CANParseReport) errorCount() int {
+	return r.MalformedLines + r.DecodeErrors
+}
+
+func (r *CANParseReport) addError(err error) {
+	if len(r.Errors) < canParseReportSamples {
+		r.Errors = append(r.Errors, err.Error())
+	}
+}
+
+// CANLogLineError 文本日志中单行格式错误，跳过该行后可以继续读取
+type CANLogLineError struct {
+	Line int
+	Err  error
+}
+
+func (e *CANLogLineError) Error() string {
+	return fmt.Sprintf("行%d: %v", e.Line, e.Err)
+}
+
+func (e *CANLogLineError) Unwrap() error {
+	return e.Err
+}
+
+// UnknownCANIDError 报文ID未在DBC中定义
+type UnknownCANIDError struct {
+	ID       uint32
+	Extended bool
+}
+
+func (e *UnknownCANIDError) Error() string {
+	return fmt.Sprintf("CAN ID %X 未在DBC中定义", e.ID)
+}
+
+func (e *UnknownCANIDError) key() string {
+	return canIDKey(e.ID, e.Extended)
+}
+
+// canIDKey 返回报告中使用的ID表示，扩展帧带 x 后缀
+func canIDKey(id uint32, extended bool) string {
+	if extended {
+		return fmt.Sprintf("0x%Xx", id)
+	}
+	return fmt.Sprintf("0x%X", id)
+}
+
+// frameSource 按容错策略读取并解码帧，同时填充解析报告
+type frameSource struct {
+	log      *CANLogFile
+	path     string
+	decoder  *CANDecoder
+	policy   CANParsePolicy
+	report   *CANParseReport
+	lastTime int64
+	window   *CANTimeWindow // 只解码该时间窗口内的帧，为空表示不限制
+	bus      *canBusStats
+	health   CANBusHealthPolicy
+}
+
+func newFrameSource(canLog *CANLogFile, path string, decoder *CANDecoder, policy CANParsePolicy) *frameSource {
+	return &frameSource{
+		log:     canLog,
+		path:    path,
+		decoder: decoder,
+		policy:  policy,
+		report:  newCANParseReport(canLog.Name()),
+		bus:     newCANBusStats(),
+	}
+}
+
+// finish 按已读取的帧生成总线、J1939 和诊断统计，写入解析报告
+func (s *frameSource) finish() {
+	s.report.Bus = s.bus.report(s.health, s.decoder.expectedMessages())
+	s.report.J1939 = s.decoder.j1939Report()
+	s.report.Diagnostics = s.decoder.diagnosticReport()
+}
+
+// next 返回下一帧及其信号和传感器故障，按策略跳过的异常帧不会返回；读完时返回 io.EOF
+func (s *frameSource) next() (*CANFrame, map[string]float64, map[string]SignalFault, error) {
+	for {
+		frame, err := s.log.Next()
+		if err == io.EOF {
+			s.finish()
+			return nil, nil, nil, s.checkRate(true)
+		}
+		if err != nil {
+			var lineErr *CANLogLineError
+			if !errors.As(err, &lineErr) {
+				return nil, nil, nil, fmt.Errorf("读取 %s 日志 '%s' 时出错: %w", s.log.Name(), s.path, err)
+			}
+			s.report.MalformedLines++
+			if err := s.tolerate(fmt.Errorf("读取 %s 日志 '%s' 时出错: %w", s.log.Name(), s.path, err)); err != nil {
+				return nil, nil, nil, err
+			}
+			continue
+		}
+
+		s.report.FramesRead++
+		if isRelativeTimestamp(frame.Timestamp) && !frame.NoTime {
+			s.report.RelativeTime = true
+			if s.window != nil {
+				return nil, nil, nil, fmt.Errorf("%w: '%s'", ErrCANRelativeTime, s.path)
+			}
+		}
+		if frame.Timestamp < s.lastTime {
+			s.report.TimestampRegressions++
+		}
+		s.lastTime = frame.Timestamp
+		if s.window.passed(frame.Timestamp) {
+			s.report.FramesOutsideWindow++
+			s.finish()
+			return nil, nil, nil, s.checkRate(true)
+		}
+		if !s.window.contains(frame.Timestamp) {
+			s.report.FramesOutsideWindow++
+			continue
+		}
+		s.bus.add(frame, s.decoder.message(frame))
+		switch {
+		case frame.Remote:
+			s.report.RemoteFrames++
+			continue
+		case frame.Error:
+			s.report.ErrorFrames++
+			continue
+		}
+		if s.decoder.diagnostic(frame) {
+			continue
+		}
+
+		signals, err := s.decoder.Decode(frame)
+		if err != nil {
+			var unknown *UnknownCANIDError
+			if errors.As(err, &unknown) {
+				// 整车日志中通常有大量 DBC 未定义的报文，skip 和 threshold 模式下只计数，不计入异常数和异常比例
+				s.report.UnknownIDs[unknown.key()]++
+				if s.policy.Mode == CANParseSkip || s.policy.Mode == CANParseThreshold {
+					continue
+				}
+			} else {
+				s.report.DecodeErrors++
+			}
+			if err := s.tolerate(fmt.Errorf("解析错误[%s]: %w", s.path, err)); err != nil {
+				return nil, nil, nil, err
+			}
+			continue
+		}
+		s.report.FramesDecoded++
+		if failure := s.decoder.E2EFailure(); failure != nil {
+			s.report.E2EFailures[failure.key()]++
+			s.report.addError(fmt.Errorf("解析错误[%s]: %s", s.path, failure))
+		}
+		faults := s.decoder.Faults()
+		for name := range faults {
+			s.report.SensorFaults[name]++
+		}
+		if err := s.checkRate(false); err != nil {
+			return nil, nil, nil, err
+		}
+		return frame, signals, faults, nil
+	}
+}
+
+// tolerate 按策略处理一个异常，需要中止时返回错误
+func (s *frameSource) tolerate(err error) error {
+	s.report.addError(err)
+	switch s.policy.Mode {
+	case CANParseSkip:
+		return nil
+	case CANParseThreshold:
+		if s.policy.MaxErrors > 0 && s.report.errorCount() > s.policy.MaxErrors {
+			s.report.Aborted = true
+			return fmt.Errorf("%w: 异常数 %d 超过上限 %d, 最近一次: %v", ErrCANParseAborted, s.report.errorCount(), s.policy.MaxErrors, err)
+		}
+		return s.checkRate(false)
+	default:
+		return err
+	}
+}
+
+// checkRate 在 threshold 模式下检查异常帧比例，atEOF 为真时不再要求最少帧数
+func (s *frameSource) checkRate(atEOF bool) error {
+	if s.policy.Mode != CANParseThreshold || s.policy.MaxErrorRate <= 0 {
+		if atEOF {
+			return io.EOF
+		}
+		return nil
+	}
+	total := s.report.FramesRead + s.report.MalformedLines
+	errs := s.report.errorCount()
+	if total > 0 && (atEOF || total >= canParseRateMinFrames) && float64(errs)/float64(total) > s.policy.MaxErrorRate {
+		s.report.Aborted = true
+		return fmt.Errorf("%w: 异常比例 %.2f%% 超过上限 %.2f%%", ErrCANParseAborted,
+			float64(errs)/float64(total)*100, s.policy.MaxErrorRate*100)
+	}
+	if atEOF {
+		return io.EOF
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// policyTestLog 包含格式错误行、未定义ID、远程帧、错误帧和时间戳回退的 candump 日志
+const policyTestLog = `(1001) can0 123#01
+(1002) can0 123#XYZ
+(1003) can0 456#01
+(1004) can0 123#R
+(1005) can0 20000004#0000000000000000
+(1000) can0 123#02
+(1006) can0 456#02
+(1007) can0 123#03
+`
+
+func TestParseCANLogPolicyStrict(t *testing.T) {
+	path := writeTestFile(t, "trace.can", policyTestLog)
+	decoder := newTestDecoder(t, "LongitudinalAcceleration")
+
+	_, _, report, err := ParseCANLogWithPolicy(path, decoder, CANParsePolicy{})
+	require.Error(t, err)
+	var lineErr *CANLogLineError
+	require.ErrorAs(t, err, &lineErr)
+	assert.Equal(t, 2, lineErr.Line)
+	assert.Equal(t, 1, report.FramesDecoded)
+	assert.Equal(t, 1, report.MalformedLines)
+
+	_, _, err = ParseCANLogWithDecoder(path, decoder)
+	assert.ErrorAs(t, err, &lineErr)
+}
+
+func TestParseCANLogPolicySkip(t *testing.T) {
+	path := writeTestFile(t, "trace.can", policyTestLog)
+	decoder := newTestDecoder(t, "LongitudinalAcceleration")
+
+	data, timestamps, report, err := ParseCANLogWithPolicy(path, decoder, CANParsePolicy{Mode: CANParseSkip})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1000, 1001, 1007}, timestamps)
+	assert.InDelta(t, 0.3, data[1007]["LongitudinalAcceleration"], 1e-9)
+
+	assert.Equal(t, "candump", report.Format)
+	assert.Equal(t, 7, report.FramesRead)
+	assert.Equal(t, 3, report.FramesDecoded)
+	assert.Equal(t, 1, report.MalformedLines)
+	assert.Equal(t, map[string]int{"0x456": 2}, report.UnknownIDs)
+	assert.Equal(t, 1, report.RemoteFrames)
+	assert.Equal(t, 1, report.ErrorFrames)
+	assert.Equal(t, 1, report.TimestampRegressions)
+	// 未定义的ID只计数，不作为异常信息记录
+	assert.Len(t, report.Errors, 1)
+	assert.False(t, report.Aborted)
+}
+
+func TestParseCANLogPolicyThreshold(t *testing.T) {
+	path := writeTestFile(t, "trace.can", policyTestLog)
+	decoder := newTestDecoder(t, "LongitudinalAcceleration")
+
+	// 未定义的ID不计入异常数: 只有1个格式错误的行
+	_, _, report, err := ParseCANLogWithPolicy(path, decoder, CANParsePolicy{Mode: CANParseThreshold, MaxErrors: 1})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"0x456": 2}, report.UnknownIDs)
+	bad := writeTestFile(t, "bad.can", policyTestLog+"(1008) can0 123#XYZ\n")
+	_, _, report, err = ParseCANLogWithPolicy(bad, decoder, CANParsePolicy{Mode: CANParseThreshold, MaxErrors: 1})
+	assert.ErrorIs(t, err, ErrCANParseAborted)
+	assert.True(t, report.Aborted)
+
+	// 文件较短时在读完后按比例判断：8行中有1个异常
+	_, _, report, err = ParseCANLogWithPolicy(path, decoder, CANParsePolicy{Mode: CANParseThreshold, MaxErrorRate: 0.1})
+	assert.ErrorIs(t, err, ErrCANParseAborted)
+	assert.True(t, report.Aborted)
+	_, _, _, err = ParseCANLogWithPolicy(path, decoder, CANParsePolicy{Mode: CANParseThreshold, MaxErrorRate: 0.2})
+	assert.NoError(t, err)
+
+	// 长文件读到足够帧数后即中止，不必读完。odd 为奇数行的帧
+	longLog := func(name, odd string) string {
+		var sb strings.Builder
+		for i := 0; i < 1000; i++ {
+			frame := "123#01"
+			if i%2 == 1 {
+				frame = odd
+			}
+			fmt.Fprintf(&sb, "(%d) can0 %s\n", 1001+i, frame)
+		}
+		return writeTestFile(t, name, sb.String())
+	}
+	_, _, report, err = ParseCANLogWithPolicy(longLog("long.can", "123#XYZ"), decoder, CANParsePolicy{Mode: CANParseThreshold, MaxErrorRate: 0.1})
+	assert.ErrorIs(t, err, ErrCANParseAborted)
+	assert.Equal(t, canParseRateMinFrames, report.FramesRead+report.MalformedLines)
+
+	// 一半的帧未在 DBC 中定义时不中止
+	_, _, report, err = ParseCANLogWithPolicy(longLog("unknown.can", "456#01"), decoder, CANParsePolicy{Mode: CANParseThreshold, MaxErrorRate: 0.1})
+	require.NoError(t, err)
+	assert.Equal(t, 500, report.FramesDecoded)
+	assert.Equal(t, map[string]int{"0x456": 500}, report.UnknownIDs)
+	assert.Empty(t, report.Errors)
+
+	_, _, _, err = ParseCANLogWithPolicy(path, decoder, CANParsePolicy{Mode: CANParseThreshold})
+	assert.Error(t, err)
+	_, _, _, err = ParseCANLogWithPolicy(path, decoder, CANParsePolicy{Mode: "lenient"})
+	assert.Error(t, err)
+}
+
+func TestStreamCANLogWithPolicy(t *testing.T) {
+	path := writeTestFile(t, "trace.can", policyTestLog)
+	decoder := newTestDecoder(t, "LongitudinalAcceleration")
+
+	var seen []int64
+	report, err := StreamCANLogWithPolicy(path, decoder, CANParsePolicy{Mode: CANParseSkip}, func(sample *CANSample) bool {
+		seen = append(seen, sample.Timestamp)
+		return true
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1000, 1001, 1007}, seen)
+	assert.Equal(t, 3, report.FramesDecoded)
+	assert.Equal(t, 1, report.MalformedLines)
+
+	// 出错前已解码的样本先输出，再返回错误
+	seen = nil
+	report, err = StreamCANLogWithPolicy(path, decoder, CANParsePolicy{}, func(sample *CANSample) bool {
+		seen = append(seen, sample.Timestamp)
+		return true
+	})
+	assert.Error(t, err)
+	assert.Equal(t, []int64{1001}, seen)
+	assert.Equal(t, 1, report.MalformedLines)
+}
@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// CANResampleMethod 重采样时网格点的取值方式
+type CANResampleMethod string
+
+const (
+	CANResampleHold   CANResampleMethod = "hold"   // 取网格点及之前最后一次收到的值（零阶保持），默认
+	CANResampleLinear CANResampleMethod = "linear" // 按网格点前后两个样本线性插值
+)
+
+// CANResamplePolicy 把来自不同报文、周期不同的信号对齐到固定周期的时间网格上
+type CANResamplePolicy struct {
+	Period       time.Duration     `yaml:"period" json:"period"`               // 网格周期，如 10ms，0 表示不重采样
+	Method       CANResampleMethod `yaml:"method" json:"method"`               // hold 或 linear，默认 hold
+	MaxStaleness time.Duration     `yaml:"max_staleness" json:"max_staleness"` // 信号超过该时长未更新时视为缺失，0 表示不限制；linear 必须配置
+}
+
+// Enabled 判断是否配置了重采样
+func (p CANResamplePolicy) Enabled() bool {
+	return p.Period > 0
+}
+
+// Validate 检查重采样配置
+func (p CANResamplePolicy) Validate() error {
+	if p.Period < 0 || p.MaxStaleness < 0 {
+		return fmt.Errorf("重采样周期和 max_staleness 不能为负数")
+	}
+	if p.Period > 0 && p.Period < time.Millisecond {
+		return fmt.Errorf("重采样周期至少为1ms: %s", p.Period)
+	}
+	switch p.Method {
+	case "", CANResampleHold:
+	case CANResampleLinear:
+		// 线性插值要等到网格点之后的样本，max_staleness 同时是等待的上限
+		if p.Enabled() && p.MaxStaleness <= 0 {
+			return fmt.Errorf("linear 插值需要配置 max_staleness")
+		}
+	default:
+		return fmt.Errorf("未知的重采样方式: %s", p.Method)
+	}
+	return nil
+}
+
+// CANResampler 把不等间隔的样本重采样到固定周期的时间网格上。
+// 每个信号在网格点上的取值只取决于该信号自己的样本，不同报文中的信号在同一网格点对齐。
+type CANResampler struct {
+	period    int64 // 毫秒
+	method    CANResampleMethod
+	staleness int64 // 毫秒，0 表示不限制
+	next      int64 // 下一个待输出的网格点
+	history   map[string][]resamplePoint
+	lastTs    int64
+	started   bool
+}
+
+// resamplePoint 单个信号的一次取值
+type resamplePoint struct {
+	ts    int64
+	value float64
+}
+
+// NewCANResampler 创建零阶保持的重采样器，period 为毫秒
+func NewCANResampler(period int64) (*CANResampler, error) {
+	if period <= 0 {
+		return nil, fmt.Errorf("重采样周期必须大于0: %d", period)
+	}
+	return &CANResampler{period: period, method: CANResampleHold, history: make(map[string][]resamplePoint)}, nil
+}
+
+// NewCANResamplerWithPolicy 按配置创建重采样器
+func NewCANResamplerWithPolicy(policy CANResamplePolicy) (*CANResampler, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	r, err := NewCANResampler(policy.Period.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	if policy.Method != "" {
+		r.method = policy.Method
+	}
+	r.staleness = policy.MaxStaleness.Milliseconds()
+	return r, nil
+}
+
+// Push 输入一个样本，把已能确定取值的网格点交给 emit。
+// linear 方式需要网格点之后的样本，网格点在输入时间超过其 max_staleness 后才输出。
+func (r *CANResampler) Push(sample *CANSample, emit func(*CANSample) error) error {
+	if !r.started {
+		// 网格从第一个样本之后的整周期开始
+		r.next = ceilDiv(sample.Timestamp, r.period) * r.period
+		r.started = true
+	}
+	lag := int64(0)
+	if r.method == CANResampleLinear {
+		lag = r.staleness
+	}
+	for r.next+lag < sample.Timestamp {
+		if err := r.emit(emit); err != nil {
+			return err
+		}
+	}
+	for name, value := range sample.Signals {
+		r.history[name] = append(r.history[name], resamplePoint{sample.Timestamp, value})
+	}
+	r.lastTs = max(r.lastTs, sample.Timestamp)
+	return nil
+}
+
+// Flush 输出最后一个样本之前剩余的网格点
+func (r *CANResampler) Flush(emit func(*CANSample) error) error {
+	for r.started && r.next <= r.lastTs {
+		if err := r.emit(emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *CANResampler) emit(emit func(*CANSample) error) error {
+	ts := r.next
+	r.next += r.period
+	signals := make(map[string]float64, len(r.history))
+	for name, points := range r.history {
+		i := sort.Search(len(points), func(k int) bool { return points[k].ts > ts }) - 1
+		if i < 0 {
+			continue
+		}
+		// 之后的网格点不再需要更早的样本
+		r.history[name] = points[i:]
+		prev := points[i]
+		if r.staleness > 0 && ts-prev.ts > r.staleness {
+			continue
+		}
+		value := prev.value
+		if r.method == CANResampleLinear && prev.ts < ts && i+1 < len(points) {
+			if next := points[i+1]; next.ts-ts <= r.staleness {
+				value += (next.value - prev.value) * float64(ts-prev.ts) / float64(next.ts-prev.ts)
+			}
+		}
+		signals[name] = value
+	}
+	return emit(&CANSample{Timestamp: ts, Signals: signals})
+}
+
+// ceilDiv 向上取整的整数除法
+func ceilDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a > 0) == (b > 0) {
+		q++
+	}
+	return q
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resampleAll 把样本依次输入重采样器，返回全部网格点
+func resampleAll(t *testing.T, r *CANResampler, samples ...*CANSample) []*CANSample {
+	t.Helper()
+	var got []*CANSample
+	emit := func(s *CANSample) error {
+		got = append(got, s)
+		return nil
+	}
+	for _, sample := range samples {
+		require.NoError(t, r.Push(sample, emit))
+	}
+	require.NoError(t, r.Flush(emit))
+	return got
+}
+
+func TestCANResampler(t *testing.T) {
+	r, err := NewCANResampler(10)
+	require.NoError(t, err)
+	got := resampleAll(t, r,
+		&CANSample{Timestamp: 1003, Signals: map[string]float64{"A": 1}},
+		&CANSample{Timestamp: 1010, Signals: map[string]float64{"B": 2}},
+		&CANSample{Timestamp: 1035, Signals: map[string]float64{"A": 3}},
+	)
+
+	require.Len(t, got, 3)
+	assert.Equal(t, &CANSample{Timestamp: 1010, Signals: map[string]float64{"A": 1, "B": 2}}, got[0])
+	assert.Equal(t, &CANSample{Timestamp: 1030, Signals: map[string]float64{"A": 1, "B": 2}}, got[2])
+
+	_, err = NewCANResampler(0)
+	assert.Error(t, err)
+}
+
+func TestCANResamplerLinear(t *testing.T) {
+	r, err := NewCANResamplerWithPolicy(CANResamplePolicy{Period: 10 * time.Millisecond, Method: CANResampleLinear, MaxStaleness: 50 * time.Millisecond})
+	require.NoError(t, err)
+	// 加速度 100Hz，车速 20Hz，对齐后每个网格点都同时有两个信号
+	var samples []*CANSample
+	for ts := int64(1000); ts <= 1100; ts += 10 {
+		samples = append(samples, &CANSample{Timestamp: ts + 1, Signals: map[string]float64{"Accel": float64(ts - 1000)}})
+		if ts%50 == 0 {
+			samples = append(samples, &CANSample{Timestamp: ts, Signals: map[string]float64{"Speed": float64(ts-1000) / 10}})
+		}
+	}
+	got := resampleAll(t, r, samples...)
+	require.Len(t, got, 10)
+	for _, sample := range got {
+		require.Len(t, sample.Signals, 2, "ts=%d", sample.Timestamp)
+		assert.InDelta(t, float64(sample.Timestamp-1000)/10, sample.Signals["Speed"], 1e-9)
+		assert.InDelta(t, float64(sample.Timestamp-1001), sample.Signals["Accel"], 1e-9)
+	}
+}
+
+func TestCANResamplerStaleness(t *testing.T) {
+	r, err := NewCANResamplerWithPolicy(CANResamplePolicy{Period: 10 * time.Millisecond, MaxStaleness: 25 * time.Millisecond})
+	require.NoError(t, err)
+	got := resampleAll(t, r,
+		&CANSample{Timestamp: 1000, Signals: map[string]float64{"A": 1, "B": 5}},
+		&CANSample{Timestamp: 1020, Signals: map[string]float64{"A": 2}},
+		&CANSample{Timestamp: 1060, Signals: map[string]float64{"A": 3}},
+	)
+	require.Len(t, got, 7)
+	assert.Equal(t, map[string]float64{"A": 2, "B": 5}, got[2].Signals)
+	// B 超过 25ms 未更新，不再输出
+	assert.Equal(t, map[string]float64{"A": 2}, got[3].Signals)
+	assert.Equal(t, map[string]float64{}, got[5].Signals)
+	assert.Equal(t, map[string]float64{"A": 3}, got[6].Signals)
+
+	// 网格点之后的样本超过 max_staleness 时退回保持，之前的样本过旧时不输出
+	r, err = NewCANResamplerWithPolicy(CANResamplePolicy{Period: 10 * time.Millisecond, Method: CANResampleLinear, MaxStaleness: 25 * time.Millisecond})
+	require.NoError(t, err)
+	got = resampleAll(t, r,
+		&CANSample{Timestamp: 1000, Signals: map[string]float64{"A": 0}},
+		&CANSample{Timestamp: 1010, Signals: map[string]float64{"A": 10}},
+		&CANSample{Timestamp: 1050, Signals: map[string]float64{"A": 100}},
+	)
+	require.Len(t, got, 6)
+	assert.Equal(t, 10.0, got[2].Signals["A"])
+	assert.InDelta(t, 55.0, got[3].Signals["A"], 1e-9)
+	assert.NotContains(t, got[4].Signals, "A")
+	assert.Equal(t, 100.0, got[5].Signals["A"])
+}
+
+func TestCANResamplePolicyValidate(t *testing.T) {
+	assert.NoError(t, CANResamplePolicy{}.Validate())
+	assert.NoError(t, CANResamplePolicy{Period: 10 * time.Millisecond, Method: CANResampleHold}.Validate())
+	assert.Error(t, CANResamplePolicy{Period: 10 * time.Millisecond, Method: CANResampleLinear}.Validate())
+	assert.Error(t, CANResamplePolicy{Period: 10 * time.Millisecond, Method: "cubic"}.Validate())
+	assert.Error(t, CANResamplePolicy{Period: time.Microsecond}.Validate())
+	assert.Error(t, CANResamplePolicy{MaxStaleness: -time.Second}.Validate())
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+
+	"go.einride.tech/can/pkg/dbc"
+)
+
+// signExtend 把 size 位补码扩展为 int64
+func signExtend(bits uint64, size int) int64 {
+	if size >= 64 {
+		return int64(bits)
+	}
+	shift := 64 - size
+	return int64(bits<<shift) >> shift
+}
+
+// LoadDBCFile 读取并解析 DBC 文件
+func LoadDBCFile(path string) (*dbc.File, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 DBC 文件 '%s' 失败: %w", path, err)
+	}
+	return ParseDBC(path, content)
+}
+
+// signalKey 唯一标识 DBC 中某个报文下的信号
+type signalKey struct {
+	messageID dbc.MessageID
+	name      string
+}
+
+// dbcSignalValueTypes 收集 SIG_VALTYPE_ 声明的浮点信号
+func dbcSignalValueTypes(db *dbc.File) map[signalKey]dbc.SignalValueType {
+	types := make(map[signalKey]dbc.SignalValueType)
+	for _, def := range db.Defs {
+		if d, ok := def.(*dbc.SignalValueTypeDef); ok {
+			types[signalKey{d.MessageID, string(d.SignalName)}] = d.SignalValueType
+		}
+	}
+	return types
+}
+
+// DBCValueLabels 返回 DBC 中 VAL_ 定义的信号取值标签。
+// 外层 key 为信号名，内层 key 为原始值按 factor/offset 换算后的物理值，
+// 与 ParseCANLogWithDBC 输出的信号值可直接比较。
+func DBCValueLabels(db *dbc.File) map[string]map[float64]string {
+	signals := make(map[signalKey]*dbc.SignalDef)
+	for _, def := range db.Defs {
+		if m, ok := def.(*dbc.MessageDef); ok {
+			for i := range m.Signals {
+				signals[signalKey{m.MessageID, string(m.Signals[i].Name)}] = &m.Signals[i]
+			}
+		}
+	}
+
+	labels := make(map[string]map[float64]string)
+	for _, def := range db.Defs {
+		d, ok := def.(*dbc.ValueDescriptionsDef)
+		if !ok || d.ObjectType != dbc.ObjectTypeSignal {
+			continue
+		}
+		sig, ok := signals[signalKey{d.MessageID, string(d.SignalName)}]
+		if !ok {
+			continue
+		}
+		table := labels[string(sig.Name)]
+		if table == nil {
+			table = make(map[float64]string, len(d.ValueDescriptions))
+			labels[string(sig.Name)] = table
+		}
+		for _, vd := range d.ValueDescriptions {
+			table[vd.Value*sig.Factor+sig.Offset] = vd.Description
+		}
+	}
+	return labels
+}
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.einride.tech/can"
+)
+
+// extractBits 逐位提取 size 位原始值，作为 bitLayout 的参考实现。
+// Intel 字节序从 start 开始逐位向高位递增；Motorola 字节序从 start（最高位）开始，
+// 在字节内向低位移动，越过字节边界后跳到下一字节的最高位。
+func extractBits(data []byte, start, size int, bigEndian bool) (uint64, error) {
+	var value uint64
+	if !bigEndian {
+		if start+size > len(data)*8 {
+			return 0, fmt.Errorf("超出数据范围: 起始位%d 长度%d 数据%d字节", start, size, len(data))
+		}
+		for i := 0; i < size; i++ {
+			pos := start + i
+			value |= uint64(data[pos/8]>>(pos%8)&0x01) << i
+		}
+		return value, nil
+	}
+
+	pos := start
+	for i := 0; i < size; i++ {
+		if pos < 0 || pos/8 >= len(data) {
+			return 0, fmt.Errorf("超出数据范围: 起始位%d 长度%d 数据%d字节", start, size, len(data))
+		}
+		value = value<<1 | uint64(data[pos/8]>>(pos%8)&0x01)
+		if pos%8 == 0 {
+			pos += 15
+		} else {
+			pos--
+		}
+	}
+	return value, nil
+}
+
+func TestExtractBitsMatchesReference(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for n := 0; n < 20000; n++ {
+		var data can.Data
+		rng.Read(data[:])
+		start := uint8(rng.Intn(64))
+		size := uint8(1 + rng.Intn(64))
+		bigEndian := rng.Intn(2) == 1
+
+		var want uint64
+		if bigEndian {
+			if can.CheckBitRangeBigEndian(8, start, size) != nil {
+				continue
+			}
+			want = data.UnsignedBitsBigEndian(start, size)
+		} else {
+			if can.CheckBitRangeLittleEndian(8, start, size) != nil {
+				continue
+			}
+			want = data.UnsignedBitsLittleEndian(start, size)
+		}
+		got, err := extractBits(data[:], int(start), int(size), bigEndian)
+		require.NoError(t, err)
+		require.Equal(t, want, got, "start=%d size=%d bigEndian=%v data=% X", start, size, bigEndian, data)
+
+		var wantSigned int64
+		if bigEndian {
+			wantSigned = data.SignedBitsBigEndian(start, size)
+		} else {
+			wantSigned = data.SignedBitsLittleEndian(start, size)
+		}
+		require.Equal(t, wantSigned, signExtend(got, int(size)))
+	}
+}
+
+func TestExtractBitsFDPayload(t *testing.T) {
+	// CAN FD 数据段超过8字节时，后半段的解码结果与等价的8字节窗口一致
+	rng := rand.New(rand.NewSource(2))
+	payload := make([]byte, 64)
+	rng.Read(payload)
+	var window can.Data
+	copy(window[:], payload[56:])
+
+	got, err := extractBits(payload, 56*8+3, 20, false)
+	require.NoError(t, err)
+	assert.Equal(t, window.UnsignedBitsLittleEndian(3, 20), got)
+
+	got, err = extractBits(payload, 56*8+7, 24, true)
+	require.NoError(t, err)
+	assert.Equal(t, window.UnsignedBitsBigEndian(7, 24), got)
+
+	_, err = extractBits(payload, 63*8, 16, false)
+	assert.Error(t, err)
+	_, err = extractBits(payload, 63*8+7, 16, true)
+	assert.Error(t, err)
+}
+
+func TestCANParserSignalTypes(t *testing.T) {
+	p := newTestParser(t, `VERSION ""
+
+BO_ 256 Chassis: 16 VCU
+ SG_ AccelX : 0|16@1- (0.001,0) [-32|32] "g" Vector__XXX
+ SG_ Speed : 23|12@0+ (0.1,0) [0|409.5] "km/h" Vector__XXX
+ SG_ YawRate : 32|32@1- (1,0) [-1000|1000] "deg/s" Vector__XXX
+ SG_ Odometer : 64|64@1+ (1,0) [0|0] "km" Vector__XXX
+
+BO_ 257 Airbag: 1 ACU
+ SG_ DeployState : 0|2@1+ (1,0) [0|3] "" Vector__XXX
+
+SIG_VALTYPE_ 256 YawRate : 1;
+SIG_VALTYPE_ 256 Odometer : 2;
+VAL_ 257 DeployState 0 "Idle" 1 "Armed" 2 "Deployed" 3 "SNA" ;
+`, "AccelX", "Speed", "YawRate", "Odometer", "DeployState")
+
+	data := make([]byte, 16)
+	binary.LittleEndian.PutUint16(data[0:], uint16(0xFC18)) // -1000
+	// Motorola：起始位23为第3字节最高位，12位跨越第3、4字节
+	data[2], data[3] = 0x4E, 0x20 // 0x4E2 = 1250
+	binary.LittleEndian.PutUint32(data[4:], math.Float32bits(-12.5))
+	binary.LittleEndian.PutUint64(data[8:], math.Float64bits(123456.75))
+
+	signals, err := p.ParseFrame(&CANFrame{ID: 0x100, FD: true, Data: data})
+	require.NoError(t, err)
+	assert.InDelta(t, -1.0, signals["AccelX"], 1e-9)
+	assert.InDelta(t, 125.0, signals["Speed"], 1e-9)
+	assert.Equal(t, -12.5, signals["YawRate"])
+	assert.Equal(t, 123456.75, signals["Odometer"])
+
+	signals, err = p.ParseFrame(&CANFrame{ID: 0x101, Data: []byte{0x02}})
+	require.NoError(t, err)
+	labels := p.db.ValueLabels()
+	assert.Equal(t, "Deployed", labels["DeployState"][signals["DeployState"]])
+	assert.Len(t, labels["DeployState"], 4)
+}
@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"container/heap"
+	"io"
+	"time"
+)
+
+// CANSample 一个时间点上解码出的信号值
+type CANSample struct {
+	Timestamp int64                  // Unix 毫秒，触发时间经 NormalizeEpochMillis 换算后与之对齐
+	Signals   map[string]float64     // key 为解码器中的逻辑信号名
+	Faults    map[string]SignalFault // 被判为传感器故障的信号，不出现在 Signals 中；无故障时为 nil
+}
+
+// DefaultReorderWindow 流式解码时默认的乱序缓冲帧数。
+// 多通道记录仪写出的帧时间戳可能有轻微交错，缓冲区内的样本按时间戳重新排序。
+const DefaultReorderWindow = 256
+
+// CANSampleStream 按时间顺序逐个返回解码后的样本，文本和 BLF 日志的内存占用只与乱序缓冲区大小有关，
+// MF4 日志在打开时读入全部帧，见 mf4Reader。
+// 与 ParseCANLogWithDecoder 相同，相同时间戳的信号合并为一个样本，既无信号也无故障或没有时间戳的帧被跳过。
+// 乱序超过缓冲窗口的帧仍按读到的顺序输出。
+type CANSampleStream struct {
+	source  *frameSource
+	window  int
+	pending sampleHeap
+	seq     uint64
+	eof     bool
+	err     error // 读取或解析中止的错误，缓冲区中已解码的样本输出完后返回
+}
+
+// OpenCANSampleStream 打开 CAN 日志并创建流式解码器
+func OpenCANSampleStream(canLogPath string, decoder *CANDecoder) (*CANSampleStream, error) {
+	canLog, err := OpenCANLog(canLogPath)
+	if err != nil {
+		return nil, err
+	}
+	return &CANSampleStream{source: newFrameSource(canLog, canLogPath, decoder, CANParsePolicy{}), window: DefaultReorderWindow}, nil
+}
+
+// SetPolicy 设置异常帧的容错策略，需在读取前调用，默认为 strict
+func (s *CANSampleStream) SetPolicy(policy CANParsePolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	s.source.policy = policy
+	return nil
+}
+
+// SetStartTime 设置日志开始时间，用于换算只记录相对时间的日志，需在读取前调用。
+// 开始时间须来自日志本身或下载信息，不能由触发时间推算，否则样本时间与实际时间不符。
+func (s *CANSampleStream) SetStartTime(t time.Time) {
+	s.source.log.SetStartTime(t)
+}
+
+// SetTimeWindow 只解码时间戳（Unix 毫秒）在 [start, end] 内的帧，窗口外的帧在解码前跳过，需在读取前调用。
+// 读到晚于 end 加 CANWindowReorderSlack 的帧后不再读取后续的帧，按读完处理。
+// 读到无法换算为 Unix 时间的相对时间戳时返回 ErrCANRelativeTime。
+func (s *CANSampleStream) SetTimeWindow(start, end int64) {
+	s.source.window = &CANTimeWindow{Start: start, End: end}
+}
+
+// SetBusHealthPolicy 设置总线健康诊断的判定阈值，需在读取前调用
+func (s *CANSampleStream) SetBusHealthPolicy(policy CANBusHealthPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	s.source.health = policy
+	return nil
+}
+
+// Report 返回截至目前的解析报告，总线、J1939 和诊断统计只包含已读取的帧
+func (s *CANSampleStream) Report() *CANParseReport {
+	s.source.finish()
+	return s.source.report
+}
+
+// SetReorderWindow 设置乱序缓冲的样本数，最小为1
+func (s *CANSampleStream) SetReorderWindow(n int) {
+	s.window = max(n, 1)
+}
+
+// Next 返回下一个样本，读到文件末尾时返回 io.EOF。
+// 读取出错或按容错策略中止时，先输出出错前已解码的样本，再返回该错误。
+func (s *CANSampleStream) Next() (*CANSample, error) {
+	for !s.eof && len(s.pending) <= s.window {
+		if err := s.fill(); err != nil {
+			s.err, s.eof = err, true
+		}
+	}
+	if len(s.pending) == 0 {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+	sample := heap.Pop(&s.pending).(pendingSample).sample
+	// 合并缓冲区中时间戳相同的样本，后读到的值覆盖先读到的值
+	for len(s.pending) > 0 && s.pending[0].sample.Timestamp == sample.Timestamp {
+		next := heap.Pop(&s.pending).(pendingSample).sample
+		for name, value := range next.Signals {
+			sample.Signals[name] = value
+			delete(sample.Faults, name)
+		}
+		for name, fault := range next.Faults {
+			if sample.Faults == nil {
+				sample.Faults = make(map[string]SignalFault)
+			}
+			sample.Faults[name] = fault
+			delete(sample.Signals, name)
+		}
+	}
+	return sample, nil
+}
+
+// fill 读取并解码一帧，有信号时放入乱序缓冲区
+func (s *CANSampleStream) fill() error {
+	frame, signals, faults, err := s.source.next()
+	if err == io.EOF {
+		s.eof = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if frame.NoTime || len(signals) == 0 && len(faults) == 0 {
+		return nil
+	}
+	if signals == nil {
+		signals = make(map[string]float64)
+	}
+	s.seq++
+	heap.Push(&s.pending, pendingSample{&CANSample{Timestamp: frameMillis(frame.Timestamp), Signals: signals, Faults: faults}, s.seq})
+	return nil
+}
+
+// Close 关闭日志文件
+func (s *CANSampleStream) Close() error {
+	return s.source.log.Close()
+}
+
+// StreamCANLog 按时间顺序把解码后的样本逐个交给 fn，fn 返回 false 时停止读取。
+// 碰撞判定需要记录评估窗口内的全部超限区间，总是读完整个窗口，流式解码只用于限制内存占用。
+// 日志中没有任何有效样本时返回 ErrNoCANSignalData。
+func StreamCANLog(canLogPath string, decoder *CANDecoder, fn func(sample *CANSample) bool) error {
+	_, err := StreamCANLogWithPolicy(canLogPath, decoder, CANParsePolicy{}, fn)
+	return err
+}
+
+// StreamCANLogWithPolicy 与 StreamCANLog 相同，但按容错策略处理异常帧并返回解析报告。
+// fn 返回 false 停止读取时报告只包含已读取部分的统计。
+func StreamCANLogWithPolicy(canLogPath string, decoder *CANDecoder, policy CANParsePolicy, fn func(sample *CANSample) bool) (*CANParseReport, error) {
+	stream, err := OpenCANSampleStream(canLogPath, decoder)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	if err := stream.SetPolicy(policy); err != nil {
+		return nil, err
+	}
+	err = stream.Each(fn)
+	return stream.Report(), err
+}
+
+// Each 按时间顺序把剩余样本逐个交给 fn，fn 返回 false 时停止读取。
+// 没有读到任何样本时返回 ErrNoCANSignalData。
+func (s *CANSampleStream) Each(fn func(sample *CANSample) bool) error {
+	for found := false; ; found = true {
+		sample, err := s.Next()
+		if err == io.EOF {
+			if !found {
+				return ErrNoCANSignalData
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !fn(sample) {
+			return nil
+		}
+	}
+}
+
+// pendingSample 乱序缓冲区中的样本，seq 为读入顺序
+type pendingSample struct {
+	sample *CANSample
+	seq    uint64
+}
+
+// sampleHeap 按时间戳排序的小顶堆，时间戳相同时按读入顺序
+type sampleHeap []pendingSample
+
+func (h sampleHeap) Len() int { return len(h) }
+func (h sampleHeap) Less(i, j int) bool {
+	if h[i].sample.Timestamp != h[j].sample.Timestamp {
+		return h[i].sample.Timestamp < h[j].sample.Timestamp
+	}
+	return h[i].seq < h[j].seq
+}
+func (h sampleHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *sampleHeap) Push(x any)   { *h = append(*h, x.(pendingSample)) }
+func (h *sampleHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = pendingSample{}
+	*h = old[:n-1]
+	return x
+}
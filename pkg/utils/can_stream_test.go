@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDecoder 使用 testDBC 创建解码器
+func newTestDecoder(t testing.TB, signals ...string) *CANDecoder {
+	t.Helper()
+	db, err := ParseDBC("test.dbc", []byte(testDBC))
+	require.NoError(t, err)
+	decoder, err := NewCANDecoder([]DBCBinding{{DBC: CompileDBC(db)}}, signals, nil)
+	require.NoError(t, err)
+	return decoder
+}
+
+func TestCANSampleStream(t *testing.T) {
+	path := writeTestFile(t, "trace.can", `(1003) can0 123#03
+(1001) can0 123#01
+(1002) can0 18FEF100#64
+(1002) can0 123#02
+(1005) can0 123#05
+(1004) can0 123#04
+`)
+	stream, err := OpenCANSampleStream(path, newTestDecoder(t, "LongitudinalAcceleration", "EngineSpeed"))
+	require.NoError(t, err)
+	defer stream.Close()
+	stream.SetReorderWindow(2)
+
+	var samples []*CANSample
+	for {
+		sample, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		samples = append(samples, sample)
+	}
+	require.Len(t, samples, 5)
+	for i, sample := range samples {
+		assert.Equal(t, int64(1001+i), sample.Timestamp)
+		assert.InDelta(t, 0.1*float64(i+1), sample.Signals["LongitudinalAcceleration"], 1e-9)
+	}
+	// 同一时间戳的两帧合并为一个样本
+	assert.Equal(t, 100.0, samples[1].Signals["EngineSpeed"])
+}
+
+func TestStreamCANLogEarlyExit(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("(1001) can0 123#01\n(1002) can0 123#10\n")
+	for i := 0; i < DefaultReorderWindow; i++ {
+		fmt.Fprintf(&sb, "(%d) can0 123#01\n", 1003+i)
+	}
+	sb.WriteString("(9999) can0 123#XYZ\n")
+	path := writeTestFile(t, "trace.can", sb.String())
+	decoder := newTestDecoder(t, "LongitudinalAcceleration")
+
+	// 最后一行格式错误，但在乱序缓冲区读到该行之前已经得出结论
+	var seen []int64
+	err := StreamCANLog(path, decoder, func(sample *CANSample) bool {
+		seen = append(seen, sample.Timestamp)
+		return sample.Signals["LongitudinalAcceleration"] <= 1.0
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1001, 1002}, seen)
+
+	err = StreamCANLog(path, decoder, func(*CANSample) bool { return true })
+	assert.Error(t, err)
+
+	empty := writeTestFile(t, "empty.can", "(1001) can0 18FEF100#01\n")
+	err = StreamCANLog(empty, decoder, func(*CANSample) bool { return true })
+	assert.ErrorIs(t, err, ErrNoCANSignalData)
+}
+
+// writeBenchmarkLog 生成 n 帧的 candump 日志，最后一帧超过阈值。
+// 规则判定会读完整个日志以记录全部超限区间，基准测试同样读取全部样本。
+func writeBenchmarkLog(b *testing.B, n int) string {
+	b.Helper()
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		value := 5
+		if i == n-1 {
+			value = 200
+		}
+		fmt.Fprintf(&sb, "(%d) can0 123#%02X00000000000000\n(%d) can0 18FEF100#%02X\n", 1000+i*10, value, 1005+i*10, i%256)
+	}
+	return writeTestFile(b, "bench.can", sb.String())
+}
+
+const benchmarkFrames = 100000
+
+func BenchmarkParseCANLogWithDecoderMap(b *testing.B) {
+	path := writeBenchmarkLog(b, benchmarkFrames)
+	decoder := newTestDecoder(b, "LongitudinalAcceleration")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sigMap, tsList, err := ParseCANLogWithDecoder(path, decoder)
+		require.NoError(b, err)
+		hits := 0
+		for _, ts := range tsList {
+			if sigMap[ts]["LongitudinalAcceleration"] > 10 {
+				hits++
+			}
+		}
+		require.Equal(b, 1, hits)
+	}
+}
+
+func BenchmarkStreamCANLog(b *testing.B) {
+	path := writeBenchmarkLog(b, benchmarkFrames)
+	decoder := newTestDecoder(b, "LongitudinalAcceleration")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hits := 0
+		err := StreamCANLog(path, decoder, func(sample *CANSample) bool {
+			if sample.Signals["LongitudinalAcceleration"] > 10 {
+				hits++
+			}
+			return true
+		})
+		require.NoError(b, err)
+		require.Equal(b, 1, hits)
+	}
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// canRelativeTimeLimit 早于 2000-01-01 的时间戳（Unix 微秒）视为相对日志开始的偏移量
+const canRelativeTimeLimit = 946684800 * int64(time.Second/time.Microsecond)
+
+// 按数值大小推断整数时间戳单位的下限，对应约 2001 年之后的 Unix 时间
+const (
+	epochSecondsMin = 1e9
+	epochMillisMin  = 1e11
+	epochMicrosMin  = 1e14
+	epochNanosMin   = 1e17
+)
+
+// parseLogTimestamp 解析文本日志中的时间戳，统一换算为微秒。
+// 带小数点的值按秒解析（如 candump 的 1620000000.123456 或 -tz 输出的 000.123456），
+// 整数值按数值大小推断为 Unix 秒、毫秒、微秒或纳秒，过小无法作为 Unix 时间的整数按相对毫秒处理。
+func parseLogTimestamp(s string) (int64, error) {
+	intPart, fracPart, fractional := strings.Cut(s, ".")
+	if fractional {
+		if intPart == "" || fracPart == "" || len(fracPart) > 9 {
+			return 0, fmt.Errorf("时间戳格式无效 '%s'", s)
+		}
+		seconds, err := strconv.ParseInt(intPart, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("时间戳解析失败 '%s': %w", s, err)
+		}
+		// 小数部分补齐到纳秒，按位解析避免浮点误差
+		nanos, err := strconv.ParseUint(fracPart+strings.Repeat("0", 9-len(fracPart)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("时间戳解析失败 '%s': %w", s, err)
+		}
+		return seconds*1e6 + int64(nanos)/1e3, nil
+	}
+
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("时间戳解析失败 '%s': %w", s, err)
+	}
+	switch {
+	case v >= epochNanosMin:
+		return v / 1e3, nil
+	case v >= epochMicrosMin:
+		return v, nil
+	case v >= epochMillisMin:
+		return v * 1e3, nil
+	case v >= epochSecondsMin:
+		return v * 1e6, nil
+	default:
+		// 相对日志开始的毫秒偏移
+		return v * 1e3, nil
+	}
+}
+
+// NormalizeEpochMillis 把秒、毫秒、微秒或纳秒的 Unix 时间戳按数值大小统一换算为毫秒，
+// 用于对齐触发时间与 CAN 样本时间。无法判断单位的较小值原样返回。
+func NormalizeEpochMillis(ts int64) int64 {
+	switch {
+	case ts >= epochNanosMin:
+		return ts / 1e6
+	case ts >= epochMicrosMin:
+		return ts / 1e3
+	case ts >= epochMillisMin:
+		return ts
+	case ts >= epochSecondsMin:
+		return ts * 1e3
+	default:
+		return ts
+	}
+}
+
+// frameMillis 把帧时间戳（微秒）换算为样本使用的毫秒时间戳
+func frameMillis(us int64) int64 {
+	return us / 1e3
+}
+
+// isRelativeTimestamp 判断帧时间戳是否为相对日志开始的偏移量
+func isRelativeTimestamp(us int64) bool {
+	return us < canRelativeTimeLimit
+}
+
+// CANWindowReorderSlack 按时间窗口读取时允许帧时间戳乱序的毫秒数。
+// 多通道记录仪写出的帧可能略有交错，读到晚于窗口结束时间加该余量的帧后认为窗口内的帧已全部读到。
+const CANWindowReorderSlack = 1000
+
+// CANTimeWindow 以 Unix 毫秒表示的闭区间时间窗口
+type CANTimeWindow struct {
+	Start int64
+	End   int64
+}
+
+// contains 判断帧时间戳（微秒）是否在窗口内，窗口为空时不过滤。
+// 相对时间戳无法与窗口对齐，由调用方在过滤前报错。
+func (w *CANTimeWindow) contains(us int64) bool {
+	if w == nil {
+		return true
+	}
+	ms := frameMillis(us)
+	return ms >= w.Start && ms <= w.End
+}
+
+// passed 判断帧时间戳（微秒）是否已晚于窗口结束时间加乱序余量，窗口为空时总是为 false
+func (w *CANTimeWindow) passed(us int64) bool {
+	return w != nil && frameMillis(us) > w.End+CANWindowReorderSlack
+}
@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLogTimestamp(t *testing.T) {
+	cases := []struct {
+		in   string
+		want int64
+	}{
+		{"1620000000.123456", 1620000000123456},
+		{"1620000000.1", 1620000000100000},
+		{"1620000000.123456789", 1620000000123456},
+		{"000.250000", 250000},
+		{"1620000000", 1620000000000000},
+		{"1620000000123", 1620000000123000},
+		{"1620000000123456", 1620000000123456},
+		{"1620000000123456789", 1620000000123456},
+		{"1001", 1001000},
+	}
+	for _, c := range cases {
+		got, err := parseLogTimestamp(c.in)
+		require.NoError(t, err, c.in)
+		assert.Equal(t, c.want, got, c.in)
+	}
+
+	for _, in := range []string{"abc", "1620000000.", ".5", "1.x", "1.1234567890"} {
+		_, err := parseLogTimestamp(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestNormalizeEpochMillis(t *testing.T) {
+	const want = int64(1620000000123)
+	assert.Equal(t, int64(1620000000000), NormalizeEpochMillis(1620000000))
+	assert.Equal(t, want, NormalizeEpochMillis(want))
+	assert.Equal(t, want, NormalizeEpochMillis(1620000000123456))
+	assert.Equal(t, want, NormalizeEpochMillis(1620000000123456789))
+	assert.Equal(t, int64(42), NormalizeEpochMillis(42))
+}
+
+func TestCANSampleStreamTimestamps(t *testing.T) {
+	decoder := newTestDecoder(t, "LongitudinalAcceleration")
+	readAll := func(stream *CANSampleStream) []int64 {
+		defer stream.Close()
+		var got []int64
+		for {
+			sample, err := stream.Next()
+			if err == io.EOF {
+				return got
+			}
+			require.NoError(t, err)
+			got = append(got, sample.Timestamp)
+		}
+	}
+
+	// candump 输出的秒级小数时间戳换算为 Unix 毫秒，与触发时间单位一致
+	path := writeTestFile(t, "abs.log", `(1620000000.123456) can0 123#01
+(1620000000.123999) can0 123#02
+(1620000000.125000) can0 123#03
+`)
+	stream, err := OpenCANSampleStream(path, decoder)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1620000000123, 1620000000125}, readAll(stream))
+
+	// 相对时间戳按设置的开始时间换算
+	rel := writeTestFile(t, "rel.log", `(000.000000) can0 123#01
+(000.010000) can0 123#02
+`)
+	stream, err = OpenCANSampleStream(rel, decoder)
+	require.NoError(t, err)
+	stream.SetStartTime(time.UnixMilli(1620000000000))
+	assert.Equal(t, []int64{1620000000000, 1620000000010}, readAll(stream))
+
+	// 未设置开始时间时保留相对偏移，偏移为0的第一帧同样保留，并在报告中标记
+	var offsets []int64
+	report, err := StreamCANLogWithPolicy(rel, decoder, CANParsePolicy{}, func(sample *CANSample) bool {
+		offsets = append(offsets, sample.Timestamp)
+		return true
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{0, 10}, offsets)
+	assert.True(t, report.RelativeTime)
+
+	sigMap, tsList, err := ParseCANLogWithDecoder(rel, decoder)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{0, 10}, tsList)
+	assert.Contains(t, sigMap[0], "LongitudinalAcceleration")
+}
+
+func TestCANSampleStreamTimeWindow(t *testing.T) {
+	path := writeTestFile(t, "window.log", `(1620000000.000000) can0 123#FF
+(1620000004.000000) can0 123#01
+(1620000001.000000) can0 456#01
+(1620000010.000000) can0 123#02
+(1620000016.000000) can0 123#FF
+`)
+	stream, err := OpenCANSampleStream(path, newTestDecoder(t, "LongitudinalAcceleration"))
+	require.NoError(t, err)
+	defer stream.Close()
+	stream.SetTimeWindow(1620000003000, 1620000015000)
+
+	var got []int64
+	require.NoError(t, stream.Each(func(sample *CANSample) bool {
+		got = append(got, sample.Timestamp)
+		return true
+	}))
+	// 窗口外的帧在解码前跳过，不会因未定义的ID出错
+	assert.Equal(t, []int64{1620000004000, 1620000010000}, got)
+	assert.Equal(t, 3, stream.Report().FramesOutsideWindow)
+	assert.Equal(t, 2, stream.Report().FramesDecoded)
+}
+
+func TestCANSampleStreamStopsAfterWindow(t *testing.T) {
+	path := writeTestFile(t, "after_window.log", `(1620000003.000000) can0 123#01
+(1620000015.500000) can0 123#02
+(1620000014.000000) can0 123#03
+(1620000017.000000) can0 123#04
+(1620000005.000000) can0 123#XYZ
+`)
+	stream, err := OpenCANSampleStream(path, newTestDecoder(t, "LongitudinalAcceleration"))
+	require.NoError(t, err)
+	defer stream.Close()
+	stream.SetTimeWindow(1620000003000, 1620000015000)
+
+	var got []int64
+	require.NoError(t, stream.Each(func(sample *CANSample) bool {
+		got = append(got, sample.Timestamp)
+		return true
+	}))
+	// 乱序余量内的帧仍会读到；读到晚于余量的帧后停止，之后格式错误的行不会被读取
+	assert.Equal(t, []int64{1620000003000, 1620000014000}, got)
+	assert.Equal(t, 4, stream.Report().FramesRead)
+	assert.Equal(t, 2, stream.Report().FramesOutsideWindow)
+	assert.Zero(t, stream.Report().MalformedLines)
+}
+
+func TestCANSampleStreamRelativeTimeWindow(t *testing.T) {
+	path := writeTestFile(t, "rel_window.log", `(000.000000) can0 123#FF
+(004.000000) can0 123#01
+(016.000000) can0 123#FF
+`)
+	stream, err := OpenCANSampleStream(path, newTestDecoder(t, "LongitudinalAcceleration"))
+	require.NoError(t, err)
+	defer stream.Close()
+	// 相对时间先换算为 Unix 时间，窗口才能过滤
+	stream.SetStartTime(time.UnixMilli(1620000000000))
+	stream.SetTimeWindow(1620000003000, 1620000015000)
+
+	var got []int64
+	require.NoError(t, stream.Each(func(sample *CANSample) bool {
+		got = append(got, sample.Timestamp)
+		return true
+	}))
+	assert.Equal(t, []int64{1620000004000}, got)
+	assert.Equal(t, 2, stream.Report().FramesOutsideWindow)
+	assert.False(t, stream.Report().RelativeTime)
+}
+
+func TestCANSampleStreamRelativeTimeWithoutStart(t *testing.T) {
+	decoder := newTestDecoder(t, "LongitudinalAcceleration")
+	// 相对时间且未设置开始时间时无法按窗口过滤，不能把偏移当作 Unix 时间
+	path := writeTestFile(t, "rel.log", `(000.000000) can0 123#01
+(004.000000) can0 123#02
+`)
+	stream, err := OpenCANSampleStream(path, decoder)
+	require.NoError(t, err)
+	defer stream.Close()
+	stream.SetTimeWindow(1620000003000, 1620000015000)
+	err = stream.Each(func(*CANSample) bool { return true })
+	assert.ErrorIs(t, err, ErrCANRelativeTime)
+	assert.True(t, stream.Report().RelativeTime)
+
+	// ASC 文件头中的 date 给出开始时间，偏移换算为 Unix 时间后按窗口过滤
+	start := time.Date(2022, 1, 10, 10, 0, 0, 0, time.Local).UnixMilli()
+	asc := writeTestFile(t, "trace.asc", `date Mon Jan 10 10:00:00.000 am 2022
+base hex  timestamps absolute
+   0.010000 1  123             Rx   d 8 01 00 00 00 00 00 00 00
+   4.000000 1  123             Rx   d 8 02 00 00 00 00 00 00 00
+`)
+	stream, err = OpenCANSampleStream(asc, decoder)
+	require.NoError(t, err)
+	defer stream.Close()
+	stream.SetTimeWindow(start+3000, start+15000)
+	var got []int64
+	require.NoError(t, stream.Each(func(sample *CANSample) bool {
+		got = append(got, sample.Timestamp)
+		return true
+	}))
+	assert.Equal(t, []int64{start + 4000}, got)
+	assert.False(t, stream.Report().RelativeTime)
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// physicalUnit 单位换算到同一量纲基准单位：基准值 = 值*scale + offset
+type physicalUnit struct {
+	dimension string
+	scale     float64
+	offset    float64
+}
+
+// physicalUnits 规则和 DBC 中常见的单位，key 为小写
+var physicalUnits = map[string]physicalUnit{
+	"g":     {"加速度", 9.80665, 0},
+	"m/s^2": {"加速度", 1, 0},
+	"m/s2":  {"加速度", 1, 0},
+	"m/s²":  {"加速度", 1, 0},
+	"m/s":   {"速度", 1, 0},
+	"km/h":  {"速度", 1 / 3.6, 0},
+	"kph":   {"速度", 1 / 3.6, 0},
+	"mph":   {"速度", 0.44704, 0},
+	"rad":   {"角度", 1, 0},
+	"deg":   {"角度", math.Pi / 180, 0},
+	"°":     {"角度", math.Pi / 180, 0},
+	"rad/s": {"角速度", 1, 0},
+	"deg/s": {"角速度", math.Pi / 180, 0},
+	"°/s":   {"角速度", math.Pi / 180, 0},
+	"rpm":   {"角速度", 2 * math.Pi / 60, 0},
+	"k":     {"温度", 1, 0},
+	"c":     {"温度", 1, 273.15},
+	"degc":  {"温度", 1, 273.15},
+	"°c":    {"温度", 1, 273.15},
+	"f":     {"温度", 5.0 / 9, 273.15 - 32*5.0/9},
+	"degf":  {"温度", 5.0 / 9, 273.15 - 32*5.0/9},
+	"°f":    {"温度", 5.0 / 9, 273.15 - 32*5.0/9},
+	"pa":    {"压力", 1, 0},
+	"kpa":   {"压力", 1e3, 0},
+	"bar":   {"压力", 1e5, 0},
+	"psi":   {"压力", 6894.757, 0},
+	"n":     {"力", 1, 0},
+	"kn":    {"力", 1e3, 0},
+	"nm":    {"扭矩", 1, 0},
+	"s":     {"时间", 1, 0},
+	"ms":    {"时间", 1e-3, 0},
+	"%":     {"比例", 1, 0},
+	"v":     {"电压", 1, 0},
+	"mv":    {"电压", 1e-3, 0},
+	"a":     {"电流", 1, 0},
+	"ma":    {"电流", 1e-3, 0},
+	"m":     {"长度", 1, 0},
+	"mm":    {"长度", 1e-3, 0},
+	"cm":    {"长度", 1e-2, 0},
+	"km":    {"长度", 1e3, 0},
+}
+
+// UnitConverter 返回把 from 单位的值换算为 to 单位的函数。单位不区分大小写，相同单位时原样返回；
+// 未知单位或量纲不同时返回错误。
+func UnitConverter(from, to string) (func(float64) float64, error) {
+	from, to = strings.ToLower(strings.TrimSpace(from)), strings.ToLower(strings.TrimSpace(to))
+	if from == to {
+		return func(v float64) float64 { return v }, nil
+	}
+	src, ok := physicalUnits[from]
+	if !ok {
+		return nil, fmt.Errorf("未知单位: %s", from)
+	}
+	dst, ok := physicalUnits[to]
+	if !ok {
+		return nil, fmt.Errorf("未知单位: %s", to)
+	}
+	if src.dimension != dst.dimension {
+		return nil, fmt.Errorf("单位 %s（%s）无法换算为 %s（%s）", from, src.dimension, to, dst.dimension)
+	}
+	return func(v float64) float64 {
+		return (v*src.scale + src.offset - dst.offset) / dst.scale
+	}, nil
+}
+
+// KnownUnit 判断单位能否参与换算
+func KnownUnit(unit string) bool {
+	_, ok := physicalUnits[strings.ToLower(strings.TrimSpace(unit))]
+	return ok
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnitConverter(t *testing.T) {
+	tests := []struct {
+		from, to string
+		in, want float64
+	}{
+		{"g", "m/s^2", 1, 9.80665},
+		{"m/s^2", "g", 19.6133, 2},
+		{"km/h", "m/s", 36, 10},
+		{"mph", "km/h", 100, 160.9344},
+		{"rad", "deg", 3.141592653589793, 180},
+		{"rpm", "rad/s", 60, 6.283185307179586},
+		{"C", "F", 100, 212},
+		{"K", "degC", 273.15, 0},
+		{"bar", "kPa", 2.5, 250},
+		{"KM/H", " km/h ", 12.5, 12.5},
+		{"unitless", "unitless", 3, 3},
+	}
+	for _, tt := range tests {
+		convert, err := UnitConverter(tt.from, tt.to)
+		require.NoError(t, err, "%s -> %s", tt.from, tt.to)
+		assert.InDelta(t, tt.want, convert(tt.in), 1e-6, "%s -> %s", tt.from, tt.to)
+	}
+
+	_, err := UnitConverter("g", "deg")
+	assert.Error(t, err)
+	_, err = UnitConverter("furlong", "m")
+	assert.Error(t, err)
+
+	assert.True(t, KnownUnit("Deg/s"))
+	assert.False(t, KnownUnit(""))
+}
+
+func TestCANDecoderUnits(t *testing.T) {
+	decoder := newTestDecoder(t, "LongitudinalAcceleration", "EngineSpeed")
+	assert.Equal(t, map[string]string{"LongitudinalAcceleration": "g", "EngineSpeed": "rpm"}, decoder.Units())
+}